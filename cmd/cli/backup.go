@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+// backupCreate writes a backup archive. The writes of a running server are
+// not stopped, use the admin endpoint to back it up.
+func backupCreate(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("backup create", flag.ContinueOnError)
+	out := fs.String("out", "", "path of the archive to create")
+	if err := parseFlags(fs, args, "out"); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := service.NewBackupService(app.db, app.storage).Backup(ctx, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// backupRestore loads a backup archive into the -db and -storage paths,
+// which must be empty
+func backupRestore(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	in := fs.String("in", "", "path of the archive to restore")
+	if err := parseFlags(fs, args, "in"); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return service.Restore(ctx, file, app.dbPath, app.storageDir)
+}
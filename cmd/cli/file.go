@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	rtsync "github.com/hiimjako/real-time-sync-obsidian-be/pkg"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+func fileLs(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("file ls", flag.ContinueOnError)
+	workspaceName := fs.String("workspace", "", "workspace name")
+	if err := parseFlags(fs, args, "workspace"); err != nil {
+		return nil, err
+	}
+
+	workspace, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := service.NewFileService(app.db, app.storage).List(ctx, workspace.ID)
+	return list(files), err
+}
+
+func fileCat(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("file cat", flag.ContinueOnError)
+	workspaceName := fs.String("workspace", "", "workspace name")
+	path := fs.String("path", "", "path of the file in the workspace")
+	if err := parseFlags(fs, args, "workspace", "path"); err != nil {
+		return nil, err
+	}
+
+	workspace, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, content, err := service.NewFileService(app.db, app.storage).Read(ctx, workspace.ID, *path)
+	if err != nil {
+		return nil, err
+	}
+
+	return rtsync.FileWithContent{
+		File:    file,
+		Content: string(content),
+	}, nil
+}
+
+// fileRm deletes the file from the database and the storage, it should not
+// be used while the server is running as it keeps the files in memory
+func fileRm(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("file rm", flag.ContinueOnError)
+	workspaceName := fs.String("workspace", "", "workspace name")
+	path := fs.String("path", "", "path of the file in the workspace")
+	if err := parseFlags(fs, args, "workspace", "path"); err != nil {
+		return nil, err
+	}
+
+	workspace, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.NewFileService(app.db, app.storage).Delete(ctx, workspace.ID, *path); err != nil {
+		return nil, err
+	}
+	return map[string]any{"deleted": *path}, nil
+}
+
+// fileExport writes the workspace as a vault archive
+func fileExport(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("file export", flag.ContinueOnError)
+	workspaceName := fs.String("workspace", "", "workspace name")
+	out := fs.String("out", "", "path of the archive to create")
+	format := fs.String("format", service.ExportZip, "archive format, zip or tar.gz")
+	if err := parseFlags(fs, args, "workspace", "out"); err != nil {
+		return nil, err
+	}
+
+	workspace, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.NewFileService(app.db, app.storage).Export(ctx, workspace.ID, file, *format, nil)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return nil, err
+	}
+
+	return map[string]string{"out": *out}, nil
+}
+
+// fileImport creates the files of an archive or a directory in the
+// workspace. Connected clients are not notified: use the endpoint while the
+// server is running.
+func fileImport(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("file import", flag.ContinueOnError)
+	workspaceName := fs.String("workspace", "", "workspace name")
+	in := fs.String("in", "", "path of the archive to import")
+	dir := fs.String("dir", "", "path of the directory to import")
+	format := fs.String("format", "", "archive format, zip, tar or tar.gz (default from the -in extension)")
+	if err := parseFlags(fs, args, "workspace"); err != nil {
+		return nil, err
+	}
+
+	if (*in == "") == (*dir == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -in and -dir is required")
+		fs.Usage()
+		return nil, errUsage
+	}
+
+	workspace, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []service.ImportEntry
+	if *dir != "" {
+		entries, err = service.ReadDir(*dir)
+	} else {
+		entries, err = readArchive(*in, *format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewFileService(app.db, app.storage).Import(ctx, workspace.ID, entries)
+}
+
+func readArchive(path, format string) ([]service.ImportEntry, error) {
+	if format == "" {
+		format = service.ExportZip
+		switch {
+		case strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz"):
+			format = service.ExportTarGz
+		case strings.HasSuffix(path, ".tar"):
+			format = service.ImportTar
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// a local archive is trusted, its size isn't bounded
+	return service.ReadArchive(file, format, 0)
+}
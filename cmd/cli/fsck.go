@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+// fsckCheck reports the inconsistencies between the database and the
+// storage without changing anything
+func fsckCheck(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("fsck check", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	return service.NewFsckService(app.db, app.storage).Run(ctx, service.FsckOptions{})
+}
+
+// fsckRepair fixes the inconsistencies which don't lose data, unless asked
+// to. It should not be used while the server is running: use the admin
+// endpoint instead, which restores the objects from the content in memory.
+func fsckRepair(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("fsck repair", flag.ContinueOnError)
+	deleteMissing := fs.Bool("delete-missing", false, "delete the files whose object is missing")
+	quarantine := fs.Bool("quarantine", false, "move orphaned and corrupted objects to the quarantine directory")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	return service.NewFsckService(app.db, app.storage).Run(ctx, service.FsckOptions{
+		Repair:        true,
+		DeleteMissing: *deleteMissing,
+		Quarantine:    *quarantine,
+	})
+}
@@ -2,69 +2,185 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
-	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
 	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/crypto/bcrypt"
 )
 
-const (
-	saltSize   = 16    // Size of salt in bytes
-	hashIter   = 10000 // Number of PBKDF2 iterations
-	hashKeyLen = 32    // Length of generated key in bytes
-)
+// command is a subcommand, it returns the value printed as JSON
+type command func(ctx context.Context, app *app, args []string) (any, error)
+
+var commands = map[string]map[string]command{
+	"workspace": {
+		"create": workspaceCreate,
+		"list":   workspaceList,
+		"delete": workspaceDelete,
+		"passwd": workspacePasswd,
+	},
+	"user": {
+		"create": userCreate,
+		"list":   userList,
+		"delete": userDelete,
+		"passwd": userPasswd,
+	},
+	"member": {
+		"add":  memberAdd,
+		"list": memberList,
+		"role": memberRole,
+		"rm":   memberRm,
+	},
+	"token": {
+		"mint": tokenMint,
+	},
+	"file": {
+		"ls":     fileLs,
+		"cat":    fileCat,
+		"rm":     fileRm,
+		"export": fileExport,
+		"import": fileImport,
+	},
+	"migrate": {
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+	},
+	"backup": {
+		"create":  backupCreate,
+		"restore": backupRestore,
+	},
+	"fsck": {
+		"check":  fsckCheck,
+		"repair": fsckRepair,
+	},
+}
+
+var errUsage = errors.New("invalid usage")
+
+type app struct {
+	db         *sql.DB
+	dbPath     string
+	storage    filestorage.Storage
+	storageDir string
+	jwtSecret  []byte
+}
 
 func main() {
-	workspaceName := flag.String("name", "", "workspace name")
-	workspacePass := flag.String("pass", "", "workspace password")
-	dbPath := flag.String("db", "", "sqlite db path")
+	dbPath := flag.String("db", envOr("SQLITE_FILEPATH", "./data/db.sqlite3"), "sqlite db path")
+	storageDir := flag.String("storage", envOr("STORAGE_DIR", "./data"), "storage directory")
+	jwtSecret := flag.String("secret", "", "secret used to sign the tokens (default $JWT_SECRET)")
+	flag.Usage = usage
 	flag.Parse()
 
-	if workspaceName == nil || *workspaceName == "" {
-		flag.PrintDefaults()
-		return
+	args := flag.Args()
+	if len(args) < 2 {
+		usage()
+		os.Exit(2)
 	}
 
-	if workspacePass == nil || *workspacePass == "" {
-		flag.PrintDefaults()
-		return
+	cmd, ok := commands[args[0]][args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
 	}
 
-	if dbPath == nil || *dbPath == "" {
-		flag.PrintDefaults()
-		return
+	if *jwtSecret == "" {
+		*jwtSecret = os.Getenv("JWT_SECRET")
 	}
 
-	dbSqlite, err := sql.Open("sqlite3", *dbPath)
+	db, err := sql.Open("sqlite3", *dbPath)
 	failOnError(err)
+	defer db.Close()
 
-	db := repository.New(dbSqlite)
+	a := &app{
+		db:         db,
+		dbPath:     *dbPath,
+		storage:    filestorage.NewDisk(*storageDir),
+		storageDir: *storageDir,
+		jwtSecret:  []byte(*jwtSecret),
+	}
 
-	salt := make([]byte, saltSize)
-	_, err = rand.Read(salt)
+	result, err := cmd(context.Background(), a, args[2:])
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
 	failOnError(err)
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(*workspacePass), bcrypt.DefaultCost)
-	failOnError(err)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	failOnError(enc.Encode(result))
+}
 
-	err = db.AddWorkspace(context.Background(), repository.AddWorkspaceParams{
-		Name:     *workspaceName,
-		Password: string(hash),
-	})
-	failOnError(err)
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] <command> <subcommand> [flags]\n\ncommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	fmt.Println("workspace created correctly")
+	for _, name := range names {
+		subcommands := make([]string, 0, len(commands[name]))
+		for sub := range commands[name] {
+			subcommands = append(subcommands, sub)
+		}
+		sort.Strings(subcommands)
+		fmt.Fprintf(os.Stderr, "  %s %s\n", name, strings.Join(subcommands, "|"))
+	}
+
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// parseFlags parses the flags of a subcommand, all the required ones must be
+// set
+func parseFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, name := range required {
+		if !set[name] {
+			fmt.Fprintf(os.Stderr, "missing required flag -%s\n", name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
 }
 
+// list returns an empty slice instead of nil, so that it is printed as []
+func list[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+// failOnError prints the error as JSON on stderr and exits
 func failOnError(err error) {
-	if err != nil {
-		fmt.Println("unable to create workspace")
-		fmt.Println(err)
-		os.Exit(1)
+	if err == nil {
+		return
 	}
+
+	_ = json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+	os.Exit(1)
 }
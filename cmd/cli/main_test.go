@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		required []string
+		wantErr  error
+	}{
+		{name: "all required set", args: []string{"-name", "n", "-pass", "p"}, required: []string{"name", "pass"}},
+		{name: "optional not set", args: []string{"-name", "n"}, required: []string{"name"}},
+		{name: "required set to empty", args: []string{"-name", ""}, required: []string{"name"}},
+		{name: "missing required", args: []string{"-name", "n"}, required: []string{"name", "pass"}, wantErr: errUsage},
+		{name: "no args", required: []string{"name"}, wantErr: errUsage},
+		{name: "help", args: []string{"-h"}, wantErr: flag.ErrHelp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("name", "", "")
+			fs.String("pass", "", "")
+
+			err := parseFlags(fs, tt.args, tt.required...)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unknown flag", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		assert.Error(t, parseFlags(fs, []string{"-unknown", "x"}))
+	})
+}
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	a := &app{
+		db:        testutils.CreateDB(t),
+		storage:   filestorage.NewDisk(t.TempDir()),
+		jwtSecret: []byte("secret"),
+	}
+
+	run := func(group, sub string, args ...string) (any, error) {
+		return commands[group][sub](ctx, a, args)
+	}
+
+	_, err := run("workspace", "create", "-name", "notes", "-pass", "password")
+	require.NoError(t, err)
+	_, err = run("user", "create", "-name", "alice", "-pass", "password")
+	require.NoError(t, err)
+	_, err = run("user", "create", "-name", "bob", "-pass", "password")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		group   string
+		sub     string
+		args    []string
+		wantErr error
+	}{
+		{name: "workspace create without pass", group: "workspace", sub: "create", args: []string{"-name", "other"}, wantErr: errUsage},
+		{name: "workspace create duplicate", group: "workspace", sub: "create", args: []string{"-name", "notes", "-pass", "p"}, wantErr: service.ErrDuplicateWorkspace},
+		{name: "workspace create unknown owner", group: "workspace", sub: "create", args: []string{"-name", "other", "-pass", "p", "-owner", "carol"}, wantErr: service.ErrUserNotFound},
+		{name: "workspace delete unknown", group: "workspace", sub: "delete", args: []string{"-name", "other"}, wantErr: service.ErrWorkspaceNotFound},
+		{name: "workspace passwd empty", group: "workspace", sub: "passwd", args: []string{"-name", "notes", "-pass", ""}, wantErr: service.ErrInvalidPassword},
+		{name: "user create invalid name", group: "user", sub: "create", args: []string{"-name", " ", "-pass", "p"}, wantErr: service.ErrInvalidName},
+		{name: "user create duplicate", group: "user", sub: "create", args: []string{"-name", "alice", "-pass", "p"}, wantErr: service.ErrDuplicateUser},
+		{name: "user passwd unknown", group: "user", sub: "passwd", args: []string{"-name", "carol", "-pass", "p"}, wantErr: service.ErrUserNotFound},
+		{name: "member add without user", group: "member", sub: "add", args: []string{"-workspace", "notes"}, wantErr: errUsage},
+		{name: "member add unknown workspace", group: "member", sub: "add", args: []string{"-workspace", "other", "-user", "alice"}, wantErr: service.ErrWorkspaceNotFound},
+		{name: "member add unknown user", group: "member", sub: "add", args: []string{"-workspace", "notes", "-user", "carol"}, wantErr: service.ErrUserNotFound},
+		{name: "member add invalid role", group: "member", sub: "add", args: []string{"-workspace", "notes", "-user", "alice", "-role", "admin"}, wantErr: service.ErrInvalidRole},
+		{name: "member add owner", group: "member", sub: "add", args: []string{"-workspace", "notes", "-user", "alice", "-role", "owner"}},
+		{name: "member add editor by default", group: "member", sub: "add", args: []string{"-workspace", "notes", "-user", "bob"}},
+		{name: "member add duplicate", group: "member", sub: "add", args: []string{"-workspace", "notes", "-user", "bob"}, wantErr: service.ErrDuplicateMember},
+		{name: "member role without role", group: "member", sub: "role", args: []string{"-workspace", "notes", "-user", "bob"}, wantErr: errUsage},
+		{name: "member role demote last owner", group: "member", sub: "role", args: []string{"-workspace", "notes", "-user", "alice", "-role", "viewer"}, wantErr: service.ErrLastOwner},
+		{name: "member rm last owner", group: "member", sub: "rm", args: []string{"-workspace", "notes", "-user", "alice"}, wantErr: service.ErrLastOwner},
+		{name: "member role promote", group: "member", sub: "role", args: []string{"-workspace", "notes", "-user", "bob", "-role", "owner"}},
+		{name: "member rm former last owner", group: "member", sub: "rm", args: []string{"-workspace", "notes", "-user", "alice"}},
+		{name: "member rm not a member", group: "member", sub: "rm", args: []string{"-workspace", "notes", "-user", "alice"}, wantErr: service.ErrMemberNotFound},
+		{name: "token mint for a non member", group: "token", sub: "mint", args: []string{"-workspace", "notes", "-user", "alice"}, wantErr: errNotMember},
+		{name: "token mint for a member", group: "token", sub: "mint", args: []string{"-workspace", "notes", "-user", "bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(tt.group, tt.sub, tt.args...)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	members, err := run("member", "list", "-workspace", "notes")
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+// memberIDs resolves the names of the workspace and of the user
+func memberIDs(ctx context.Context, app *app, workspace, user string) (int64, int64, error) {
+	w, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, workspace)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	u, err := service.NewUserService(app.db).FetchByName(ctx, user)
+	if err != nil {
+		return 0, 0, err
+	}
+	return w.ID, u.ID, nil
+}
+
+func memberAdd(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("member add", flag.ContinueOnError)
+	workspace := fs.String("workspace", "", "workspace name")
+	user := fs.String("user", "", "user name")
+	role := fs.String("role", string(middleware.RoleEditor), "role of the user (owner, editor or viewer)")
+	if err := parseFlags(fs, args, "workspace", "user"); err != nil {
+		return nil, err
+	}
+
+	workspaceID, userID, err := memberIDs(ctx, app, *workspace, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.NewMemberService(app.db).Add(ctx, workspaceID, userID, middleware.Role(*role)); err != nil {
+		return nil, err
+	}
+	return map[string]any{"workspace": *workspace, "user": *user, "role": *role}, nil
+}
+
+func memberList(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("member list", flag.ContinueOnError)
+	workspace := fs.String("workspace", "", "workspace name")
+	if err := parseFlags(fs, args, "workspace"); err != nil {
+		return nil, err
+	}
+
+	w, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := service.NewMemberService(app.db).List(ctx, w.ID)
+	return list(members), err
+}
+
+func memberRole(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("member role", flag.ContinueOnError)
+	workspace := fs.String("workspace", "", "workspace name")
+	user := fs.String("user", "", "user name")
+	role := fs.String("role", "", "new role of the user (owner, editor or viewer)")
+	if err := parseFlags(fs, args, "workspace", "user", "role"); err != nil {
+		return nil, err
+	}
+
+	workspaceID, userID, err := memberIDs(ctx, app, *workspace, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.NewMemberService(app.db).SetRole(ctx, workspaceID, userID, middleware.Role(*role)); err != nil {
+		return nil, err
+	}
+	return map[string]any{"workspace": *workspace, "user": *user, "role": *role}, nil
+}
+
+func memberRm(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("member rm", flag.ContinueOnError)
+	workspace := fs.String("workspace", "", "workspace name")
+	user := fs.String("user", "", "user name")
+	if err := parseFlags(fs, args, "workspace", "user"); err != nil {
+		return nil, err
+	}
+
+	workspaceID, userID, err := memberIDs(ctx, app, *workspace, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.NewMemberService(app.db).Remove(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"workspace": *workspace, "removed": *user}, nil
+}
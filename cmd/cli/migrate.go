@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/migration"
+)
+
+func migrateUp(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	results, err := migration.Up(ctx, app.db)
+	return list(results), err
+}
+
+func migrateDown(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	return migration.Down(ctx, app.db)
+}
+
+func migrateStatus(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("migrate status", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	return migration.Statuses(ctx, app.db)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+var errNotMember = errors.New("user is not a member of the workspace")
+
+// tokenMint creates an access token, by default for the owner of the
+// workspace or with the membership role of -user
+func tokenMint(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("token mint", flag.ContinueOnError)
+	workspaceName := fs.String("workspace", "", "workspace name")
+	userName := fs.String("user", "", "user the token belongs to")
+	role := fs.String("role", "", "role of the token, defaults to the one of the user")
+	if err := parseFlags(fs, args, "workspace"); err != nil {
+		return nil, err
+	}
+
+	if len(app.jwtSecret) == 0 {
+		return nil, errors.New("missing secret, set -secret or JWT_SECRET")
+	}
+
+	workspace, err := service.NewWorkspaceService(app.db, app.storage).FetchByName(ctx, *workspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := middleware.Identity{
+		WorkspaceID: workspace.ID,
+		Role:        middleware.RoleOwner,
+	}
+
+	if *userName != "" {
+		user, err := service.NewUserService(app.db).FetchByName(ctx, *userName)
+		if err != nil {
+			return nil, err
+		}
+
+		member, err := repository.New(app.db).FetchWorkspaceMember(ctx, repository.FetchWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      user.ID,
+		})
+		if err != nil {
+			return nil, errNotMember
+		}
+
+		identity.UserID = user.ID
+		identity.Role = middleware.Role(member.Role)
+	}
+
+	if *role != "" {
+		identity.Role = middleware.Role(*role)
+	}
+
+	token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: app.jwtSecret}, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"token":       token,
+		"workspaceId": identity.WorkspaceID,
+		"userId":      identity.UserID,
+		"role":        identity.Role,
+	}, nil
+}
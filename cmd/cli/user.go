@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+func userCreate(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	name := fs.String("name", "", "user name")
+	pass := fs.String("pass", "", "user password")
+	if err := parseFlags(fs, args, "name", "pass"); err != nil {
+		return nil, err
+	}
+
+	id, err := service.NewUserService(app.db).Create(ctx, *name, *pass)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"id": id, "name": *name}, nil
+}
+
+func userList(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("user list", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	users, err := service.NewUserService(app.db).List(ctx)
+	return list(users), err
+}
+
+func userDelete(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("user delete", flag.ContinueOnError)
+	name := fs.String("name", "", "user name")
+	if err := parseFlags(fs, args, "name"); err != nil {
+		return nil, err
+	}
+
+	us := service.NewUserService(app.db)
+	user, err := us.FetchByName(ctx, *name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.Delete(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"deleted": user.Name}, nil
+}
+
+func userPasswd(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("user passwd", flag.ContinueOnError)
+	name := fs.String("name", "", "user name")
+	pass := fs.String("pass", "", "new user password")
+	if err := parseFlags(fs, args, "name", "pass"); err != nil {
+		return nil, err
+	}
+
+	us := service.NewUserService(app.db)
+	user, err := us.FetchByName(ctx, *name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.SetPassword(ctx, user.ID, *pass); err != nil {
+		return nil, err
+	}
+	return map[string]any{"updated": user.Name}, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+func workspaceCreate(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("workspace create", flag.ContinueOnError)
+	name := fs.String("name", "", "workspace name")
+	pass := fs.String("pass", "", "workspace password")
+	owner := fs.String("owner", "", "user owning the workspace")
+	if err := parseFlags(fs, args, "name", "pass"); err != nil {
+		return nil, err
+	}
+
+	var ownerID int64
+	if *owner != "" {
+		user, err := service.NewUserService(app.db).FetchByName(ctx, *owner)
+		if err != nil {
+			return nil, err
+		}
+		ownerID = user.ID
+	}
+
+	return service.NewWorkspaceService(app.db, app.storage).Create(ctx, *name, *pass, ownerID)
+}
+
+func workspaceList(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("workspace list", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	workspaces, err := service.NewWorkspaceService(app.db, app.storage).List(ctx)
+	return list(workspaces), err
+}
+
+func workspaceDelete(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("workspace delete", flag.ContinueOnError)
+	name := fs.String("name", "", "workspace name")
+	if err := parseFlags(fs, args, "name"); err != nil {
+		return nil, err
+	}
+
+	ws := service.NewWorkspaceService(app.db, app.storage)
+	workspace, err := ws.FetchByName(ctx, *name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ws.Delete(ctx, workspace.ID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"deleted": workspace.Name}, nil
+}
+
+func workspacePasswd(ctx context.Context, app *app, args []string) (any, error) {
+	fs := flag.NewFlagSet("workspace passwd", flag.ContinueOnError)
+	name := fs.String("name", "", "workspace name")
+	pass := fs.String("pass", "", "new workspace password")
+	if err := parseFlags(fs, args, "name", "pass"); err != nil {
+		return nil, err
+	}
+
+	ws := service.NewWorkspaceService(app.db, app.storage)
+	workspace, err := ws.FetchByName(ctx, *name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ws.ChangePassword(ctx, workspace.ID, *pass); err != nil {
+		return nil, err
+	}
+	return map[string]any{"updated": workspace.Name}, nil
+}
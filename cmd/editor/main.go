@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -20,6 +21,7 @@ import (
 var (
 	fileId    = flag.Int("file", 1, "file to write")
 	serverURL = flag.String("url", "127.0.0.1:8080", "server URL")
+	token     = flag.String("token", "", "auth token")
 )
 
 func main() {
@@ -58,14 +60,29 @@ func pollText(s *screen.Screen) {
 
 	ctx := context.Background()
 	url := "ws://" + *serverURL + rtsync.PathWebSocket
-	ws, _, err := websocket.Dial(ctx, url, nil)
+	ws, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer " + *token}},
+	})
+	logOnError(err)
+
+	// receive only the chunks of the edited file
+	err = wsjson.Write(ctx, ws, rtsync.SubscriptionMessage{
+		WsMessageHeader: rtsync.WsMessageHeader{
+			FileId: int64(*fileId),
+			Type:   rtsync.SubscribeEventType,
+		},
+	})
 	logOnError(err)
 
 	lastContent := ""
 	go func() {
 		// listen for changes in ws
 		for {
-			var msg rtsync.ChunkMessage
+			var msg struct {
+				rtsync.ChunkMessage
+				// Content is set on the snapshots
+				Content string `json:"content"`
+			}
 			err = wsjson.Read(ctx, ws, &msg)
 			logOnError(err)
 
@@ -74,7 +91,11 @@ func pollText(s *screen.Screen) {
 			}
 
 			mu.Lock()
-			lastContent = s.ApplyDiff(msg.Chunks)
+			chunks := msg.Chunks
+			if msg.Type == rtsync.SnapshotEventType {
+				chunks = diff.ComputeDiff(s.Content(), msg.Content)
+			}
+			lastContent = s.ApplyDiff(chunks)
 			s.Render()
 			mu.Unlock()
 		}
@@ -13,7 +13,6 @@ import (
 
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/env"
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/migration"
-	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
 	rtsync "github.com/hiimjako/real-time-sync-obsidian-be/pkg"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
 
@@ -50,11 +49,31 @@ func run(ev *env.EnvVariables) error {
 	}
 	log.Printf("listening on ws://%v", l.Addr())
 
-	db := repository.New(dbSqlite)
 	disk := filestorage.NewDisk(ev.StorageDir)
 
-	handler := rtsync.New(db, disk, rtsync.Options{
-		JWTSecret: ev.JWTSecret,
+	handler := rtsync.New(dbSqlite, disk, rtsync.Options{
+		JWTSecret:       ev.JWTSecret,
+		AdminToken:      ev.AdminToken,
+		PingInterval:    ev.PingInterval,
+		PingTimeout:     ev.PingTimeout,
+		SlowGracePeriod: ev.SlowGracePeriod,
+		ClientRateLimit: rtsync.RateLimit{
+			Rate:  ev.ClientRateLimit,
+			Burst: ev.ClientRateBurst,
+		},
+		WorkspaceRateLimit: rtsync.RateLimit{
+			Rate:  ev.WorkspaceRateLimit,
+			Burst: ev.WorkspaceRateBurst,
+		},
+		MaxFilesInMemory: ev.MaxFilesInMemory,
+		FlushIdle:        ev.FlushIdle,
+		FlushInterval:    ev.FlushInterval,
+		OIDC: rtsync.OIDCOptions{
+			Issuer:       ev.OIDCIssuer,
+			ClientID:     ev.OIDCClientID,
+			ClientSecret: ev.OIDCClientSecret,
+			RedirectURL:  ev.OIDCRedirectURL,
+		},
 	})
 	defer handler.Close()
 
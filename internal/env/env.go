@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sethvargo/go-envconfig"
@@ -16,6 +17,26 @@ type EnvVariables struct {
 	StorageDir     string `env:"STORAGE_DIR,default=./data"`
 	SqliteFilepath string `env:"SQLITE_FILEPATH,default=./data/db.sqlite3"`
 	JWTSecret      []byte `env:"JWT_SECRET,required"`
+	AdminToken     string `env:"ADMIN_TOKEN"`
+
+	PingInterval    time.Duration `env:"PING_INTERVAL,default=30s"`
+	PingTimeout     time.Duration `env:"PING_TIMEOUT,default=10s"`
+	SlowGracePeriod time.Duration `env:"SLOW_GRACE_PERIOD,default=30s"`
+
+	ClientRateLimit    float64 `env:"CLIENT_RATE_LIMIT,default=20"`
+	ClientRateBurst    int     `env:"CLIENT_RATE_BURST,default=40"`
+	WorkspaceRateLimit float64 `env:"WORKSPACE_RATE_LIMIT,default=50"`
+	WorkspaceRateBurst int     `env:"WORKSPACE_RATE_BURST,default=100"`
+
+	MaxFilesInMemory int `env:"MAX_FILES_IN_MEMORY,default=256"`
+
+	FlushIdle     time.Duration `env:"FLUSH_IDLE,default=500ms"`
+	FlushInterval time.Duration `env:"FLUSH_INTERVAL,default=5s"`
+
+	OIDCIssuer       string `env:"OIDC_ISSUER"`
+	OIDCClientID     string `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL  string `env:"OIDC_REDIRECT_URL"`
 }
 
 func LoadEnv(paths ...string) *EnvVariables {
@@ -1,8 +1,12 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
 	"embed"
+	"io/fs"
+	"path"
+	"time"
 
 	"github.com/pressly/goose/v3"
 )
@@ -22,3 +26,96 @@ func Migrate(db *sql.DB) error {
 
 	return nil
 }
+
+// Status is the state of a migration
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// Result is a migration applied or rolled back
+type Result struct {
+	Version   int64         `json:"version"`
+	Name      string        `json:"name"`
+	Direction string        `json:"direction"`
+	Duration  time.Duration `json:"duration"`
+}
+
+func newProvider(db *sql.DB) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectSQLite3, db, fsys)
+}
+
+// Up applies all the pending migrations
+func Up(ctx context.Context, db *sql.DB) ([]Result, error) {
+	provider, err := newProvider(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := provider.Up(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(applied))
+	for _, r := range applied {
+		results = append(results, newResult(r))
+	}
+	return results, nil
+}
+
+// Down rolls back the last applied migration
+func Down(ctx context.Context, db *sql.DB) (Result, error) {
+	provider, err := newProvider(db)
+	if err != nil {
+		return Result{}, err
+	}
+
+	r, err := provider.Down(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(r), nil
+}
+
+// Statuses returns the state of all the migrations
+func Statuses(ctx context.Context, db *sql.DB) ([]Status, error) {
+	provider, err := newProvider(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(statuses))
+	for _, s := range statuses {
+		status := Status{
+			Version: s.Source.Version,
+			Name:    path.Base(s.Source.Path),
+			State:   string(s.State),
+		}
+		if s.State == goose.StateApplied {
+			status.AppliedAt = &s.AppliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+func newResult(r *goose.MigrationResult) Result {
+	return Result{
+		Version:   r.Source.Version,
+		Name:      path.Base(r.Source.Path),
+		Direction: r.Direction,
+		Duration:  r.Duration,
+	}
+}
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE refresh_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  token_hash TEXT NOT NULL,
+  family_id TEXT NOT NULL,
+  workspace_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  role TEXT NOT NULL,
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME,
+  revoked_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  UNIQUE (token_hash)
+);
+
+CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE TABLE revoked_tokens (
+  jti TEXT PRIMARY KEY,
+  expires_at DATETIME NOT NULL
+);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE revoked_tokens;
+
+DROP TABLE refresh_tokens;
+
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE VIRTUAL TABLE files_fts USING fts5 (
+  workspace_id UNINDEXED,
+  workspace_path,
+  content,
+  tokenize = 'unicode61'
+);
+
+-- the content is indexed by the server, deleted and renamed files are kept
+-- in sync here
+CREATE TRIGGER files_fts_delete AFTER DELETE ON files
+BEGIN
+  DELETE FROM files_fts
+  WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER files_fts_rename AFTER UPDATE OF workspace_path ON files
+BEGIN
+  UPDATE files_fts
+  SET workspace_path = new.workspace_path
+  WHERE rowid = new.id;
+END;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER files_fts_rename;
+
+DROP TRIGGER files_fts_delete;
+
+DROP TABLE files_fts;
+
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE file_links (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  source_id INTEGER NOT NULL,
+  workspace_id INTEGER NOT NULL,
+  target TEXT NOT NULL,
+  target_key TEXT NOT NULL,
+  embed BOOLEAN NOT NULL
+);
+
+CREATE INDEX file_links_source_id ON file_links (source_id);
+
+CREATE INDEX file_links_target_key ON file_links (workspace_id, target_key);
+
+CREATE TRIGGER file_links_delete AFTER DELETE ON files
+BEGIN
+  DELETE FROM file_links
+  WHERE source_id = old.id;
+END;
+
+-- the server indexes again the content of the files missing from the
+-- full-text index at startup, which now includes their links
+DELETE FROM files_fts;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER file_links_delete;
+
+DROP TABLE file_links;
+
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE file_tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  file_id INTEGER NOT NULL,
+  workspace_id INTEGER NOT NULL,
+  tag TEXT NOT NULL
+);
+
+CREATE INDEX file_tags_file_id ON file_tags (file_id);
+
+CREATE INDEX file_tags_tag ON file_tags (workspace_id, tag);
+
+CREATE TABLE file_properties (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  file_id INTEGER NOT NULL,
+  workspace_id INTEGER NOT NULL,
+  key TEXT NOT NULL,
+  value TEXT NOT NULL,
+  number REAL,
+  list BOOLEAN NOT NULL
+);
+
+CREATE INDEX file_properties_file_id ON file_properties (file_id);
+
+CREATE INDEX file_properties_value ON file_properties (workspace_id, key, value);
+
+CREATE INDEX file_properties_number ON file_properties (workspace_id, key, number);
+
+CREATE TRIGGER file_metadata_delete AFTER DELETE ON files
+BEGIN
+  DELETE FROM file_tags
+  WHERE file_id = old.id;
+  DELETE FROM file_properties
+  WHERE file_id = old.id;
+END;
+
+-- the server indexes again the content of the files missing from the
+-- full-text index at startup, which now includes their metadata
+DELETE FROM files_fts;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER file_metadata_delete;
+
+DROP TABLE file_properties;
+
+DROP TABLE file_tags;
+
+-- +goose StatementEnd
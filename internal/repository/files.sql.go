@@ -9,6 +9,19 @@ import (
 	"context"
 )
 
+const countFilesByDiskPath = `-- name: CountFilesByDiskPath :one
+SELECT COUNT(*)
+FROM files
+WHERE disk_path = ?
+`
+
+func (q *Queries) CountFilesByDiskPath(ctx context.Context, diskPath string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countFilesByDiskPath, diskPath)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createFile = `-- name: CreateFile :one
 INSERT INTO files (disk_path, workspace_path, mime_type, hash, workspace_id)
 VALUES (?, ?, ?, ?, ?)
@@ -56,6 +69,16 @@ func (q *Queries) DeleteFile(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteWorkspaceFiles = `-- name: DeleteWorkspaceFiles :exec
+DELETE FROM files
+WHERE workspace_id = ?
+`
+
+func (q *Queries) DeleteWorkspaceFiles(ctx context.Context, workspaceID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteWorkspaceFiles, workspaceID)
+	return err
+}
+
 const fetchAllFiles = `-- name: FetchAllFiles :many
 SELECT id, disk_path, workspace_path, mime_type, hash, created_at, updated_at, version, workspace_id
 FROM files
@@ -181,54 +204,70 @@ func (q *Queries) FetchFiles(ctx context.Context, workspaceID int64) ([]File, er
 	return items, nil
 }
 
-const fetchWorkspaceFiles = `-- name: FetchWorkspaceFiles :many
+const fetchWorkspaceFile = `-- name: FetchWorkspaceFile :one
 SELECT id, disk_path, workspace_path, mime_type, hash, created_at, updated_at, version, workspace_id
 FROM files
-WHERE workspace_id = ?
+WHERE workspace_id = ? AND workspace_path = ?
+LIMIT 1
 `
 
-func (q *Queries) FetchWorkspaceFiles(ctx context.Context, workspaceID int64) ([]File, error) {
-	rows, err := q.db.QueryContext(ctx, fetchWorkspaceFiles, workspaceID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []File
-	for rows.Next() {
-		var i File
-		if err := rows.Scan(
-			&i.ID,
-			&i.DiskPath,
-			&i.WorkspacePath,
-			&i.MimeType,
-			&i.Hash,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Version,
-			&i.WorkspaceID,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+type FetchWorkspaceFileParams struct {
+	WorkspaceID   int64  `json:"workspaceId"`
+	WorkspacePath string `json:"workspacePath"`
+}
+
+func (q *Queries) FetchWorkspaceFile(ctx context.Context, arg FetchWorkspaceFileParams) (File, error) {
+	row := q.db.QueryRowContext(ctx, fetchWorkspaceFile, arg.WorkspaceID, arg.WorkspacePath)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.DiskPath,
+		&i.WorkspacePath,
+		&i.MimeType,
+		&i.Hash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const updateDiskPath = `-- name: UpdateDiskPath :exec
+UPDATE files
+SET 
+    disk_path = ?,
+    hash = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+type UpdateDiskPathParams struct {
+	DiskPath string `json:"diskPath"`
+	Hash     string `json:"hash"`
+	ID       int64  `json:"id"`
 }
 
-const updateUpdatedAt = `-- name: UpdateUpdatedAt :exec
+func (q *Queries) UpdateDiskPath(ctx context.Context, arg UpdateDiskPathParams) error {
+	_, err := q.db.ExecContext(ctx, updateDiskPath, arg.DiskPath, arg.Hash, arg.ID)
+	return err
+}
+
+const updateFileHash = `-- name: UpdateFileHash :exec
 UPDATE files
 SET 
+    hash = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
 `
 
-func (q *Queries) UpdateUpdatedAt(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, updateUpdatedAt, id)
+type UpdateFileHashParams struct {
+	Hash string `json:"hash"`
+	ID   int64  `json:"id"`
+}
+
+func (q *Queries) UpdateFileHash(ctx context.Context, arg UpdateFileHashParams) error {
+	_, err := q.db.ExecContext(ctx, updateFileHash, arg.Hash, arg.ID)
 	return err
 }
 
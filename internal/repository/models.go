@@ -9,6 +9,26 @@ import (
 	"time"
 )
 
+type ApiKey struct {
+	ID          int64        `json:"id"`
+	WorkspaceID int64        `json:"workspaceId"`
+	Name        string       `json:"name"`
+	KeyHash     string       `json:"keyHash"`
+	Prefix      string       `json:"prefix"`
+	Scope       string       `json:"scope"`
+	LastUsedAt  sql.NullTime `json:"lastUsedAt"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+type AuditLog struct {
+	ID         int64     `json:"id"`
+	Action     string    `json:"action"`
+	Workspace  string    `json:"workspace"`
+	User       string    `json:"user"`
+	RemoteAddr string    `json:"remoteAddr"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
 type File struct {
 	ID            int64     `json:"id"`
 	DiskPath      string    `json:"diskPath"`
@@ -21,6 +41,65 @@ type File struct {
 	WorkspaceID   int64     `json:"workspaceId"`
 }
 
+type FileLink struct {
+	ID          int64  `json:"id"`
+	SourceID    int64  `json:"sourceId"`
+	WorkspaceID int64  `json:"workspaceId"`
+	Target      string `json:"target"`
+	TargetKey   string `json:"targetKey"`
+	Embed       bool   `json:"embed"`
+}
+
+type FileProperty struct {
+	ID          int64           `json:"id"`
+	FileID      int64           `json:"fileId"`
+	WorkspaceID int64           `json:"workspaceId"`
+	Key         string          `json:"key"`
+	Value       string          `json:"value"`
+	Number      sql.NullFloat64 `json:"number"`
+	List        bool            `json:"list"`
+}
+
+type FileTag struct {
+	ID          int64  `json:"id"`
+	FileID      int64  `json:"fileId"`
+	WorkspaceID int64  `json:"workspaceId"`
+	Tag         string `json:"tag"`
+}
+
+type RefreshToken struct {
+	ID          int64        `json:"id"`
+	TokenHash   string       `json:"tokenHash"`
+	FamilyID    string       `json:"familyId"`
+	WorkspaceID int64        `json:"workspaceId"`
+	UserID      int64        `json:"userId"`
+	Role        string       `json:"role"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	UsedAt      sql.NullTime `json:"usedAt"`
+	RevokedAt   sql.NullTime `json:"revokedAt"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+type RevokedToken struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type User struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Password  string       `json:"password"`
+	CreatedAt sql.NullTime `json:"createdAt"`
+	UpdatedAt sql.NullTime `json:"updatedAt"`
+}
+
+type UserIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    int64     `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 type Workspace struct {
 	ID        int64        `json:"id"`
 	Name      string       `json:"name"`
@@ -28,3 +107,10 @@ type Workspace struct {
 	CreatedAt sql.NullTime `json:"createdAt"`
 	UpdatedAt sql.NullTime `json:"updatedAt"`
 }
+
+type WorkspaceMember struct {
+	WorkspaceID int64        `json:"workspaceId"`
+	UserID      int64        `json:"userId"`
+	Role        string       `json:"role"`
+	CreatedAt   sql.NullTime `json:"createdAt"`
+}
@@ -7,6 +7,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 )
 
 const addWorkspace = `-- name: AddWorkspace :exec
@@ -24,6 +25,94 @@ func (q *Queries) AddWorkspace(ctx context.Context, arg AddWorkspaceParams) erro
 	return err
 }
 
+const createWorkspace = `-- name: CreateWorkspace :one
+INSERT INTO workspaces (name, password)
+VALUES (?, ?)
+RETURNING id, name, created_at, updated_at
+`
+
+type CreateWorkspaceParams struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type CreateWorkspaceRow struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	CreatedAt sql.NullTime `json:"createdAt"`
+	UpdatedAt sql.NullTime `json:"updatedAt"`
+}
+
+func (q *Queries) CreateWorkspace(ctx context.Context, arg CreateWorkspaceParams) (CreateWorkspaceRow, error) {
+	row := q.db.QueryRowContext(ctx, createWorkspace, arg.Name, arg.Password)
+	var i CreateWorkspaceRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteWorkspace = `-- name: DeleteWorkspace :execrows
+DELETE FROM workspaces
+WHERE id = ?
+`
+
+func (q *Queries) DeleteWorkspace(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWorkspace, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const fetchUserWorkspaces = `-- name: FetchUserWorkspaces :many
+SELECT workspaces.id, workspaces.name, workspace_members.role, workspaces.created_at, workspaces.updated_at
+FROM workspaces
+JOIN workspace_members ON workspace_members.workspace_id = workspaces.id
+WHERE workspace_members.user_id = ?
+ORDER BY workspaces.name
+`
+
+type FetchUserWorkspacesRow struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Role      string       `json:"role"`
+	CreatedAt sql.NullTime `json:"createdAt"`
+	UpdatedAt sql.NullTime `json:"updatedAt"`
+}
+
+func (q *Queries) FetchUserWorkspaces(ctx context.Context, userID int64) ([]FetchUserWorkspacesRow, error) {
+	rows, err := q.db.QueryContext(ctx, fetchUserWorkspaces, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FetchUserWorkspacesRow
+	for rows.Next() {
+		var i FetchUserWorkspacesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Role,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const fetchWorkspace = `-- name: FetchWorkspace :one
 SELECT id, name, password 
 FROM workspaces
@@ -43,3 +132,128 @@ func (q *Queries) FetchWorkspace(ctx context.Context, name string) (FetchWorkspa
 	err := row.Scan(&i.ID, &i.Name, &i.Password)
 	return i, err
 }
+
+const fetchWorkspaceByID = `-- name: FetchWorkspaceByID :one
+SELECT id, name, created_at, updated_at
+FROM workspaces
+WHERE id = ?
+LIMIT 1
+`
+
+type FetchWorkspaceByIDRow struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	CreatedAt sql.NullTime `json:"createdAt"`
+	UpdatedAt sql.NullTime `json:"updatedAt"`
+}
+
+func (q *Queries) FetchWorkspaceByID(ctx context.Context, id int64) (FetchWorkspaceByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, fetchWorkspaceByID, id)
+	var i FetchWorkspaceByIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const fetchWorkspaces = `-- name: FetchWorkspaces :many
+SELECT id, name, created_at, updated_at
+FROM workspaces
+ORDER BY name
+`
+
+type FetchWorkspacesRow struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	CreatedAt sql.NullTime `json:"createdAt"`
+	UpdatedAt sql.NullTime `json:"updatedAt"`
+}
+
+func (q *Queries) FetchWorkspaces(ctx context.Context) ([]FetchWorkspacesRow, error) {
+	rows, err := q.db.QueryContext(ctx, fetchWorkspaces)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FetchWorkspacesRow
+	for rows.Next() {
+		var i FetchWorkspacesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isWorkspaceDeleted = `-- name: IsWorkspaceDeleted :one
+SELECT COUNT(*)
+FROM sqlite_sequence
+WHERE sqlite_sequence.name = 'workspaces' AND sqlite_sequence.seq >= ?1
+AND NOT EXISTS (SELECT 1 FROM workspaces WHERE workspaces.id = ?1)
+`
+
+// the ids are AUTOINCREMENT, an id up to the sequence without a row has
+// been deleted
+func (q *Queries) IsWorkspaceDeleted(ctx context.Context, id int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isWorkspaceDeleted, id)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const updateWorkspaceName = `-- name: UpdateWorkspaceName :execrows
+UPDATE workspaces
+SET 
+    name = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+type UpdateWorkspaceNameParams struct {
+	Name string `json:"name"`
+	ID   int64  `json:"id"`
+}
+
+func (q *Queries) UpdateWorkspaceName(ctx context.Context, arg UpdateWorkspaceNameParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateWorkspaceName, arg.Name, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateWorkspacePassword = `-- name: UpdateWorkspacePassword :execrows
+UPDATE workspaces
+SET 
+    password = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+type UpdateWorkspacePasswordParams struct {
+	Password string `json:"password"`
+	ID       int64  `json:"id"`
+}
+
+func (q *Queries) UpdateWorkspacePassword(ctx context.Context, arg UpdateWorkspacePasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateWorkspacePassword, arg.Password, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -19,6 +19,8 @@ import (
 func CreateDB(t *testing.T) *sql.DB {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
+	// each connection would open its own in-memory database
+	db.SetMaxOpenConns(1)
 	require.NoError(t, migration.Migrate(db))
 
 	t.Cleanup(func() { db.Close() })
@@ -29,16 +31,41 @@ func CreateDB(t *testing.T) *sql.DB {
 type requestOption func(req *http.Request) error
 
 func WithAuthHeader(secretKey []byte, workspaceID int64) requestOption {
+	return WithRoleAuthHeader(secretKey, workspaceID, middleware.RoleOwner)
+}
+
+func WithRoleAuthHeader(secretKey []byte, workspaceID int64, role middleware.Role) requestOption {
+	return WithToken(CreateToken(secretKey, workspaceID, role))
+}
+
+func WithToken(token string) requestOption {
 	return func(req *http.Request) error {
-		token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: secretKey}, workspaceID)
-		if err != nil {
-			return err
-		}
 		req.Header.Add("Authorization", "Bearer "+token)
 		return nil
 	}
 }
 
+func WithCookies(cookies ...*http.Cookie) requestOption {
+	return func(req *http.Request) error {
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return nil
+	}
+}
+
+// CreateToken returns a valid token, it panics on error
+func CreateToken(secretKey []byte, workspaceID int64, role middleware.Role) string {
+	token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: secretKey}, middleware.Identity{
+		WorkspaceID: workspaceID,
+		Role:        role,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
 func DoRequest[T any](
 	t *testing.T,
 	server http.Handler,
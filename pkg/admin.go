@@ -0,0 +1,139 @@
+package rtsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+type FsckBody struct {
+	Repair        bool `json:"repair"`
+	DeleteMissing bool `json:"deleteMissing"`
+	Quarantine    bool `json:"quarantine"`
+}
+
+const (
+	ErrFsck   = "impossible to check the storage"
+	ErrBackup = "impossible to back up the server"
+)
+
+func (rts *realTimeSyncServer) adminHandler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("POST /fsck", rts.fsckHandler)
+	router.HandleFunc("GET /backup", rts.backupHandler)
+	router.HandleFunc("GET /metrics", rts.metricsHandler)
+
+	stack := middleware.CreateStack(
+		middleware.Logging,
+		middleware.IsAdmin(rts.adminToken),
+	)
+
+	routerWithStack := stack(router)
+	return routerWithStack
+}
+
+// fsckHandler checks the consistency of the database and the storage. The
+// check runs along the writes, which are stopped only to repair the issues
+// found, using the content in memory to restore missing or corrupted
+// objects.
+func (rts *realTimeSyncServer) fsckHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data FsckBody
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &data); err != nil {
+			http.Error(w, "error parsing JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := rts.fsck.Check(r.Context())
+	if err != nil {
+		http.Error(w, ErrFsck, http.StatusInternalServerError)
+		return
+	}
+
+	if data.Repair || data.DeleteMissing || data.Quarantine {
+		report = rts.repairFsck(r.Context(), report, data)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// repairFsck repairs the issues of the report with the edits stopped, and
+// updates the files in memory changed by the repair
+func (rts *realTimeSyncServer) repairFsck(ctx context.Context, report service.FsckReport, data FsckBody) service.FsckReport {
+	// stop the edits and save the chunks already accepted
+	defer rts.hub.pause()()
+
+	report = rts.fsck.Repair(ctx, report, service.FsckOptions{
+		Repair:        true,
+		DeleteMissing: data.DeleteMissing,
+		Quarantine:    data.Quarantine,
+		Content: func(fileID int64) (string, bool) {
+			file, _, ok := rts.hub.file(fileID)
+			return file.Content, ok
+		},
+	})
+
+	for _, fileID := range report.ChangedFiles() {
+		fileWithContent, ws, ok := rts.hub.file(fileID)
+		if !ok {
+			continue
+		}
+
+		file, err := rts.db.FetchFile(ctx, fileID)
+		if err != nil {
+			ws.forget(fileID)
+			continue
+		}
+
+		fileWithContent.File = file
+		ws.files[fileID] = fileWithContent
+	}
+
+	return report
+}
+
+// backupHandler streams a consistent backup archive. The writes are stopped
+// only while the database and the objects are copied, not while the archive
+// is downloaded. The manifest is the last entry of the archive, so a backup
+// interrupted by an error is refused by the restore.
+func (rts *realTimeSyncServer) backupHandler(w http.ResponseWriter, r *http.Request) {
+	resume := rts.hub.pause()
+	snapshot, err := rts.backup.Snapshot(r.Context())
+	resume()
+	if err != nil {
+		log.Printf("backup failed: %v", err)
+		http.Error(w, ErrBackup, http.StatusInternalServerError)
+		return
+	}
+	defer snapshot.Close()
+
+	clearWriteDeadline(w)
+
+	filename := fmt.Sprintf("backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := snapshot.Archive(w); err != nil {
+		log.Printf("backup failed: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package rtsync
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_fsckHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	server := New(db, mockFileStorage, Options{JWTSecret: []byte("secret"), AdminToken: "admin"})
+
+	t.Cleanup(func() { server.Close() })
+
+	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk/path",
+		WorkspacePath: "note.md",
+		MimeType:      "text/plain",
+		Hash:          filestorage.GenerateHash([]byte("lost")),
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+
+	server.hub.workspace(file.WorkspaceID).files[file.ID] = FileWithContent{File: file, Content: "in memory"}
+
+	t.Run("should refuse workspace tokens", func(t *testing.T) {
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAdmin+"/fsck",
+			nil,
+			testutils.WithAuthHeader([]byte("secret"), 1),
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("should restore the missing object from memory", func(t *testing.T) {
+		mockFileStorage.On("ListObjects").Return([]string{}, nil)
+		mockFileStorage.On("ReadObject", "disk/path").Return([]byte{}, fs.ErrNotExist)
+		mockFileStorage.On("CreateObject", []byte("in memory")).Return("new/path", nil)
+
+		res, report := testutils.DoRequest[service.FsckReport](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAdmin+"/fsck",
+			FsckBody{Repair: true},
+			testutils.WithToken("admin"),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Len(t, report.Missing, 1)
+		assert.Equal(t, service.FsckRestored, report.Missing[0].Action)
+		mockFileStorage.AssertExpectations(t)
+
+		assert.Equal(t, "new/path", server.hub.workspace(file.WorkspaceID).files[file.ID].DiskPath)
+		assert.Equal(t, "in memory", server.hub.workspace(file.WorkspaceID).files[file.ID].Content)
+		assert.Equal(t, filestorage.GenerateHash([]byte("in memory")), server.hub.workspace(file.WorkspaceID).files[file.ID].Hash)
+	})
+}
+
+func Test_backupHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	server := New(db, mockFileStorage, Options{JWTSecret: []byte("secret"), AdminToken: "admin"})
+
+	t.Cleanup(func() { server.Close() })
+
+	_, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk/path",
+		WorkspacePath: "note.md",
+		MimeType:      "text/plain",
+		Hash:          filestorage.GenerateHash([]byte("content")),
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+
+	mockFileStorage.On("ReadObject", "disk/path").Return([]byte("content"), nil)
+
+	req := httptest.NewRequest(http.MethodGet, PathHttpAdmin+"/backup", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/gzip", res.Header().Get("Content-Type"))
+	mockFileStorage.AssertExpectations(t)
+
+	storageDir := filepath.Join(t.TempDir(), "data")
+	manifest, err := service.Restore(context.Background(), res.Body, filepath.Join(storageDir, "db.sqlite3"), storageDir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Objects, 1)
+	assert.Equal(t, "disk/path", manifest.Objects[0].Path)
+}
+
+func Test_metricsHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	server := New(db, mockFileStorage, Options{JWTSecret: []byte("secret"), AdminToken: "admin"})
+
+	t.Cleanup(func() { server.Close() })
+
+	server.metrics.coalescedChunks.Add(3)
+	server.metrics.snapshots.Add(2)
+	server.metrics.slowDisconnects.Add(1)
+
+	res, metrics := testutils.DoRequest[Metrics](
+		t,
+		server,
+		http.MethodGet,
+		PathHttpAdmin+"/metrics",
+		nil,
+		testutils.WithToken("admin"),
+	)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, Metrics{
+		CoalescedChunks: 3,
+		Snapshots:       2,
+		SlowDisconnects: 1,
+	}, metrics)
+}
@@ -3,12 +3,15 @@ package rtsync
 import (
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
 )
 
 type CreateFileBody struct {
@@ -33,12 +36,40 @@ const (
 )
 
 func (rts *realTimeSyncServer) apiHandler() http.Handler {
+	editor := middleware.RequireRole(middleware.RoleEditor)
+	owner := middleware.RequireRole(middleware.RoleOwner)
+
 	router := http.NewServeMux()
 	router.HandleFunc("GET /file", rts.listFilesHandler)
 	router.HandleFunc("GET /file/{id}", rts.fetchFileHandler)
-	router.HandleFunc("POST /file", rts.createFileHandler)
-	router.HandleFunc("DELETE /file/{id}", rts.deleteFileHandler)
-	router.HandleFunc("PATCH /file/{id}", rts.updateFileHandler)
+	router.HandleFunc("GET /file/{id}/links", rts.fileLinksHandler)
+	router.Handle("POST /file", editor(http.HandlerFunc(rts.createFileHandler)))
+	router.Handle("DELETE /file/{id}", editor(http.HandlerFunc(rts.deleteFileHandler)))
+	router.Handle("PATCH /file/{id}", editor(http.HandlerFunc(rts.updateFileHandler)))
+	router.HandleFunc("GET /export", rts.exportHandler)
+	router.Handle("POST /import", editor(http.HandlerFunc(rts.importHandler)))
+	router.Handle("POST /batch", editor(http.HandlerFunc(rts.batchHandler)))
+	router.HandleFunc("GET /search", rts.searchHandler)
+	router.HandleFunc("GET /query", rts.queryHandler)
+
+	router.Handle("GET /apikey", owner(http.HandlerFunc(rts.listApiKeysHandler)))
+	router.Handle("POST /apikey", owner(http.HandlerFunc(rts.createApiKeyHandler)))
+	router.Handle("DELETE /apikey/{id}", owner(http.HandlerFunc(rts.deleteApiKeyHandler)))
+
+	router.HandleFunc("GET /workspace", rts.listWorkspacesHandler)
+	router.HandleFunc("POST /workspace", rts.createWorkspaceHandler)
+	router.Handle("PATCH /workspace", owner(http.HandlerFunc(rts.updateWorkspaceHandler)))
+	router.Handle("DELETE /workspace", owner(http.HandlerFunc(rts.deleteWorkspaceHandler)))
+
+	router.HandleFunc("PATCH /account", rts.changePasswordHandler)
+	if rts.oidc != nil {
+		router.HandleFunc("POST /account/oidc", rts.oidcLinkHandler)
+	}
+
+	router.HandleFunc("GET /member", rts.listMembersHandler)
+	router.Handle("POST /member", owner(http.HandlerFunc(rts.addMemberHandler)))
+	router.Handle("PATCH /member/{userId}", owner(http.HandlerFunc(rts.updateMemberHandler)))
+	router.Handle("DELETE /member/{userId}", owner(http.HandlerFunc(rts.deleteMemberHandler)))
 
 	stack := middleware.CreateStack(
 		middleware.Logging,
@@ -47,7 +78,7 @@ func (rts *realTimeSyncServer) apiHandler() http.Handler {
 			AllowedMethods: []string{"HEAD", "GET", "POST", "OPTIONS", "DELETE", "PATCH"},
 			AllowedHeaders: []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization"},
 		}),
-		middleware.IsAuthenticated(middleware.AuthOptions{SecretKey: rts.jwtSecret}),
+		middleware.IsAuthenticated(rts.authOptions()),
 	)
 
 	routerWithStack := stack(router)
@@ -79,13 +110,22 @@ func (rts *realTimeSyncServer) fetchFileHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	// the edits are saved behind, the file is saved first so that the
+	// content and its hash are up to date
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	ws.flushFiles([]int64{int64(fileId)})
+
 	file, err := rts.db.FetchFile(r.Context(), int64(fileId))
 	if err != nil {
 		http.Error(w, ErrNotExistingFile, http.StatusNotFound)
 		return
 	}
 
-	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
 	if file.WorkspaceID != workspaceID {
 		http.Error(w, ErrNotExistingFile, http.StatusNotFound)
 		return
@@ -123,6 +163,13 @@ func (rts *realTimeSyncServer) createFileHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	// the writes are stopped while the storage is checked or backed up
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
 	// if there isn't any file an error is returned
 	_, err = rts.db.FetchFileFromWorkspacePath(r.Context(), data.Path)
 	if err == nil {
@@ -137,7 +184,6 @@ func (rts *realTimeSyncServer) createFileHandler(w http.ResponseWriter, r *http.
 	}
 
 	mimeType := http.DetectContentType(data.Content)
-	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
 
 	file, err := rts.db.CreateFile(r.Context(), repository.CreateFileParams{
 		DiskPath:      diskPath,
@@ -152,6 +198,10 @@ func (rts *realTimeSyncServer) createFileHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if err := rts.index.Index(r.Context(), file, string(data.Content)); err != nil {
+		log.Printf("error while indexing file %d, %v", file.ID, err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(file); err != nil {
@@ -180,6 +230,13 @@ func (rts *realTimeSyncServer) deleteFileHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// the writes are stopped while the storage is checked or backed up, and
+	// the file in memory must not be saved again once deleted
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+	ws.forget(file.ID)
+
 	if err := rts.storage.DeleteObject(file.DiskPath); err != nil {
 		http.Error(w, ErrNotExistingFile, http.StatusInternalServerError)
 		return
@@ -231,6 +288,26 @@ func (rts *realTimeSyncServer) updateFileHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	// the links are indexed as the files are saved, the edited ones must be
+	// saved to find all the backlinks
+	ws.flush()
+
+	// the links must be resolved before the rename
+	resolver, err := rts.links.Resolver(r.Context(), workspaceID)
+	if err != nil {
+		http.Error(w, ErrInvalidFile, http.StatusInternalServerError)
+		return
+	}
+	backlinks, err := rts.links.Backlinks(r.Context(), file, resolver)
+	if err != nil {
+		http.Error(w, ErrInvalidFile, http.StatusInternalServerError)
+		return
+	}
+
 	err = rts.db.UpdateWorkspacePath(r.Context(), repository.UpdateWorkspacePathParams{
 		WorkspacePath: data.Path,
 		ID:            file.ID,
@@ -240,5 +317,47 @@ func (rts *realTimeSyncServer) updateFileHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if fileWithContent, ok := ws.files[file.ID]; ok {
+		fileWithContent.WorkspacePath = data.Path
+		ws.files[file.ID] = fileWithContent
+	}
+
+	rts.rewriteBacklinks(ws, backlinks, resolver, file.ID, data.Path)
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// rewriteBacklinks updates the links of the files referring to the renamed
+// file, the changes are broadcast as chunks. ws.mut must be held.
+func (rts *realTimeSyncServer) rewriteBacklinks(ws *workspaceHub, backlinks []service.Link, resolver service.LinkResolver, fileID int64, newPath string) {
+	rewritten := make(map[int64]bool)
+	for _, link := range backlinks {
+		if rewritten[link.FileID] {
+			continue
+		}
+		rewritten[link.FileID] = true
+
+		source, err := rts.loadFile(ws, link.FileID)
+		if err != nil {
+			log.Printf("error while loading file %d, %v", link.FileID, err)
+			continue
+		}
+
+		content := service.RewriteLinks(source.Content, resolver, fileID, newPath)
+		if content == source.Content {
+			continue
+		}
+
+		err = rts.applyChunks(ws, ChunkMessage{
+			WsMessageHeader: WsMessageHeader{
+				FileId:      source.ID,
+				WorkspaceId: source.WorkspaceID,
+				Type:        ChunkEventType,
+			},
+			Chunks: diff.ComputeDiff(source.Content, content),
+		})
+		if err != nil {
+			log.Printf("error while updating the links of file %d, %v", source.ID, err)
+		}
+	}
+}
@@ -2,14 +2,23 @@ package rtsync
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -18,9 +27,8 @@ import (
 func Test_listFilesHandler(t *testing.T) {
 	mockFileStorage := new(filestorage.MockFileStorage)
 	db := testutils.CreateDB(t)
-	repo := repository.New(db)
 	options := Options{JWTSecret: []byte("secret")}
-	server := New(repo, mockFileStorage, options)
+	server := New(db, mockFileStorage, options)
 
 	t.Cleanup(func() { server.Close() })
 
@@ -77,9 +85,8 @@ func Test_listFilesHandler(t *testing.T) {
 func Test_fetchFileHandler(t *testing.T) {
 	mockFileStorage := new(filestorage.MockFileStorage)
 	db := testutils.CreateDB(t)
-	repo := repository.New(db)
 	options := Options{JWTSecret: []byte("secret")}
-	server := New(repo, mockFileStorage, options)
+	server := New(db, mockFileStorage, options)
 
 	t.Cleanup(func() { server.Close() })
 
@@ -154,13 +161,79 @@ func Test_fetchFileHandler(t *testing.T) {
 	mockFileStorage.AssertCalled(t, "ReadObject", "/home/file/2")
 }
 
+func Test_fetchFileHandlerEdited(t *testing.T) {
+	db := testutils.CreateDB(t)
+	disk := filestorage.NewDisk(t.TempDir())
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, disk, options)
+	ts := httptest.NewServer(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		server.Close()
+	})
+
+	res, file := testutils.DoRequest[repository.File](
+		t,
+		server,
+		http.MethodPost,
+		PathHttpApi+"/file",
+		CreateFileBody{Path: "note.md", Content: []byte("hello")},
+		testutils.WithAuthHeader(options.JWTSecret, 1),
+	)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	dial := func(role middleware.Role) *websocket.Conn {
+		//nolint:bodyclose
+		conn, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, role))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+		return conn
+	}
+	editor := dial(middleware.RoleEditor)
+	viewer := dial(middleware.RoleViewer)
+
+	// wait for the subscribers to be registered
+	require.Eventually(t, func() bool {
+		ws := server.hub.workspace(1)
+		ws.subscribersMu.Lock()
+		defer ws.subscribersMu.Unlock()
+		return len(ws.subscribers) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, wsjson.Write(ctx, editor, ChunkMessage{
+		WsMessageHeader: WsMessageHeader{Type: ChunkEventType, FileId: file.ID},
+		Chunks:          []diff.DiffChunk{{Type: diff.DiffAdd, Position: 5, Text: " world", Len: 6}},
+	}))
+
+	// the edit has been applied once it's broadcast
+	var chunk ChunkMessage
+	require.NoError(t, wsjson.Read(ctx, viewer, &chunk))
+
+	res, body := testutils.DoRequest[FileWithContent](
+		t,
+		server,
+		http.MethodGet,
+		fmt.Sprintf("%s/file/%d", PathHttpApi, file.ID),
+		nil,
+		testutils.WithAuthHeader(options.JWTSecret, 1),
+	)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "hello world", body.Content)
+	assert.Equal(t, filestorage.GenerateHash([]byte("hello world")), body.Hash)
+}
+
 // Test_createFileHandler tests the createFileHandler using mocked storage
 func Test_createFileHandler(t *testing.T) {
 	mockFileStorage := new(filestorage.MockFileStorage)
 	db := testutils.CreateDB(t)
 	repo := repository.New(db)
 	options := Options{JWTSecret: []byte("secret")}
-	server := New(repo, mockFileStorage, options)
+	server := New(db, mockFileStorage, options)
 
 	t.Cleanup(func() { server.Close() })
 
@@ -197,7 +270,7 @@ func Test_createFileHandler(t *testing.T) {
 		}, body)
 
 		// check db
-		files, err := repo.FetchWorkspaceFiles(context.Background(), workspaceID)
+		files, err := repo.FetchFiles(context.Background(), workspaceID)
 		assert.NoError(t, err)
 		assert.Len(t, files, 1)
 		assert.Equal(t, repository.File{
@@ -215,6 +288,30 @@ func Test_createFileHandler(t *testing.T) {
 		mockFileStorage.AssertCalled(t, "CreateObject", data.Content)
 	})
 
+	t.Run("should not allow viewers to create a file", func(t *testing.T) {
+		workspaceID := int64(10)
+		data := CreateFileBody{
+			Path:    "/home/viewer-file",
+			Content: []byte("a viewer file!"),
+		}
+
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/file",
+			data,
+			testutils.WithRoleAuthHeader(options.JWTSecret, workspaceID, middleware.RoleViewer),
+		)
+
+		// check response
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, middleware.ErrInsufficientRole, body)
+
+		// check mock assertions
+		mockFileStorage.AssertNotCalled(t, "CreateObject", data.Content)
+	})
+
 	t.Run("should not insert duplicate paths", func(t *testing.T) {
 		workspaceID := int64(10)
 		data := CreateFileBody{
@@ -239,7 +336,7 @@ func Test_createFileHandler(t *testing.T) {
 		assert.Equal(t, ErrDuplicateFile, body)
 
 		// check db
-		files, err := repo.FetchWorkspaceFiles(context.Background(), workspaceID)
+		files, err := repo.FetchFiles(context.Background(), workspaceID)
 		assert.NoError(t, err)
 		assert.Len(t, files, 1)
 
@@ -254,7 +351,7 @@ func Test_deleteFileHandler(t *testing.T) {
 	db := testutils.CreateDB(t)
 	repo := repository.New(db)
 	options := Options{JWTSecret: []byte("secret")}
-	server := New(repo, mockFileStorage, options)
+	server := New(db, mockFileStorage, options)
 
 	t.Cleanup(func() { server.Close() })
 
@@ -293,7 +390,7 @@ func Test_deleteFileHandler(t *testing.T) {
 		assert.Equal(t, "", deleteBody)
 
 		// check db
-		files, err := repo.FetchWorkspaceFiles(context.Background(), workspaceID)
+		files, err := repo.FetchFiles(context.Background(), workspaceID)
 		assert.NoError(t, err)
 		assert.Len(t, files, 0)
 
@@ -334,7 +431,7 @@ func Test_deleteFileHandler(t *testing.T) {
 		assert.Equal(t, ErrNotExistingFile, deleteBody)
 
 		// check db
-		files, err := repo.FetchWorkspaceFiles(context.Background(), workspaceID)
+		files, err := repo.FetchFiles(context.Background(), workspaceID)
 		assert.NoError(t, err)
 		assert.Len(t, files, 1)
 
@@ -349,7 +446,7 @@ func Test_updateFileHandler(t *testing.T) {
 	db := testutils.CreateDB(t)
 	repo := repository.New(db)
 	options := Options{JWTSecret: []byte("secret")}
-	server := New(repo, mockFileStorage, options)
+	server := New(db, mockFileStorage, options)
 
 	t.Cleanup(func() { server.Close() })
 
@@ -390,7 +487,7 @@ func Test_updateFileHandler(t *testing.T) {
 		assert.Equal(t, "", updateBody)
 
 		// check db
-		files, err := repo.FetchWorkspaceFiles(context.Background(), workspaceID)
+		files, err := repo.FetchFiles(context.Background(), workspaceID)
 		assert.NoError(t, err)
 		assert.Len(t, files, 1)
 		assert.Equal(t, repository.File{
@@ -0,0 +1,180 @@
+package rtsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+)
+
+type ApiKeyScope string
+
+const (
+	ScopeRead  ApiKeyScope = "read"
+	ScopeWrite ApiKeyScope = "write"
+	ScopeAdmin ApiKeyScope = "admin"
+)
+
+// Role returns the role granted by the scope, empty if the scope is unknown
+func (s ApiKeyScope) Role() middleware.Role {
+	switch s {
+	case ScopeRead:
+		return middleware.RoleViewer
+	case ScopeWrite:
+		return middleware.RoleEditor
+	case ScopeAdmin:
+		return middleware.RoleOwner
+	}
+	return ""
+}
+
+type CreateApiKeyBody struct {
+	Name  string      `json:"name"`
+	Scope ApiKeyScope `json:"scope"`
+}
+
+// CreateApiKeyResponse is the only time the plain key is returned
+type CreateApiKeyResponse struct {
+	repository.CreateApiKeyRow
+	Key string `json:"key"`
+}
+
+const (
+	ErrInvalidScope      = "invalid scope"
+	ErrInvalidApiKey     = "impossible to create api key"
+	ErrNotExistingApiKey = "not existing api key"
+	ErrApiKeyNotAllowed  = "api keys can't create api keys"
+)
+
+// apiKeyTouchInterval is how often the last use of an API key is recorded
+const apiKeyTouchInterval = time.Minute
+
+type apiKeyVerifier struct {
+	db *repository.Queries
+}
+
+func (v apiKeyVerifier) VerifyApiKey(ctx context.Context, key string) (middleware.Identity, error) {
+	apiKey, err := v.db.FetchApiKeyFromHash(ctx, hashSecret(key))
+	if err != nil {
+		return middleware.Identity{}, fmt.Errorf("invalid api key")
+	}
+
+	// the last use is approximate, not to write on every request
+	if !apiKey.LastUsedAt.Valid || time.Since(apiKey.LastUsedAt.Time) > apiKeyTouchInterval {
+		if err := v.db.TouchApiKey(ctx, apiKey.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return middleware.Identity{
+		WorkspaceID: apiKey.WorkspaceID,
+		Role:        ApiKeyScope(apiKey.Scope).Role(),
+		ApiKeyID:    apiKey.ID,
+	}, nil
+}
+
+func (rts *realTimeSyncServer) listApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	apiKeys, err := rts.db.FetchApiKeys(r.Context(), workspaceID)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(apiKeys); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// createApiKeyHandler creates an API key, a leaked key can't be used to mint
+// further keys
+func (rts *realTimeSyncServer) createApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if middleware.ApiKeyIDFromCtx(r.Context()) != 0 {
+		http.Error(w, ErrApiKeyNotAllowed, http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data CreateApiKeyBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	if data.Scope.Role() == "" {
+		http.Error(w, ErrInvalidScope, http.StatusBadRequest)
+		return
+	}
+
+	secret, err := randomString()
+	if err != nil {
+		http.Error(w, ErrInvalidApiKey, http.StatusInternalServerError)
+		return
+	}
+	key := middleware.ApiKeyPrefix + secret
+
+	apiKey, err := rts.db.CreateApiKey(r.Context(), repository.CreateApiKeyParams{
+		WorkspaceID: middleware.WorkspaceIDFromCtx(r.Context()),
+		Name:        data.Name,
+		KeyHash:     hashSecret(key),
+		Prefix:      key[:len(middleware.ApiKeyPrefix)+6],
+		Scope:       string(data.Scope),
+	})
+	if err != nil {
+		http.Error(w, ErrInvalidApiKey, http.StatusInternalServerError)
+		return
+	}
+
+	response := CreateApiKeyResponse{
+		CreateApiKeyRow: apiKey,
+		Key:             key,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rts *realTimeSyncServer) deleteApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyId, err := strconv.Atoi(r.PathValue("id"))
+
+	if apiKeyId == 0 || err != nil {
+		http.Error(w, "invalid api key id", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := rts.db.DeleteApiKey(r.Context(), repository.DeleteApiKeyParams{
+		ID:          int64(apiKeyId),
+		WorkspaceID: middleware.WorkspaceIDFromCtx(r.Context()),
+	})
+	if err != nil {
+		http.Error(w, ErrInvalidApiKey, http.StatusInternalServerError)
+		return
+	}
+
+	if deleted == 0 {
+		http.Error(w, ErrNotExistingApiKey, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
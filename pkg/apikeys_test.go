@@ -0,0 +1,169 @@
+package rtsync
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_apiKeysHandlers(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	workspaceID := int64(10)
+
+	createApiKey := func(t *testing.T, scope ApiKeyScope) CreateApiKeyResponse {
+		res, body := testutils.DoRequest[CreateApiKeyResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/apikey",
+			CreateApiKeyBody{Name: "backup", Scope: scope},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		require.Equal(t, http.StatusCreated, res.Code)
+		return body
+	}
+
+	t.Run("should authenticate with an api key", func(t *testing.T) {
+		apiKey := createApiKey(t, ScopeRead)
+		assert.Contains(t, apiKey.Key, middleware.ApiKeyPrefix)
+		assert.Equal(t, apiKey.Key[:len(apiKey.Prefix)], apiKey.Prefix)
+		assert.False(t, apiKey.LastUsedAt.Valid)
+
+		res, _ := testutils.DoRequest[[]repository.File](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/file",
+			nil,
+			testutils.WithToken(apiKey.Key),
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+
+		// read scope can't write
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/file",
+			CreateFileBody{Path: "/backup", Content: []byte("backup")},
+			testutils.WithToken(apiKey.Key),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, middleware.ErrInsufficientRole, body)
+
+		stored, err := repo.FetchApiKeyFromHash(context.Background(), hashSecret(apiKey.Key))
+		require.NoError(t, err)
+		assert.True(t, stored.LastUsedAt.Valid)
+		assert.Equal(t, workspaceID, stored.WorkspaceID)
+
+		// the last use isn't recorded again within the interval
+		_, err = db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().Add(-time.Second), stored.ID)
+		require.NoError(t, err)
+		touched, err := repo.FetchApiKeyFromHash(context.Background(), hashSecret(apiKey.Key))
+		require.NoError(t, err)
+
+		res, _ = testutils.DoRequest[[]repository.File](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/file",
+			nil,
+			testutils.WithToken(apiKey.Key),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+
+		stored, err = repo.FetchApiKeyFromHash(context.Background(), hashSecret(apiKey.Key))
+		require.NoError(t, err)
+		assert.Equal(t, touched.LastUsedAt, stored.LastUsedAt)
+	})
+
+	t.Run("should reject invalid scopes", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/apikey",
+			CreateApiKeyBody{Name: "backup", Scope: "root"},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidScope, body)
+	})
+
+	t.Run("should list and revoke api keys", func(t *testing.T) {
+		apiKey := createApiKey(t, ScopeAdmin)
+
+		res, list := testutils.DoRequest[[]repository.FetchApiKeysRow](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/apikey",
+			nil,
+			testutils.WithToken(apiKey.Key),
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Len(t, list, 2)
+
+		// even with the admin scope a key can't create keys
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/apikey",
+			CreateApiKeyBody{Name: "escalation", Scope: ScopeAdmin},
+			testutils.WithToken(apiKey.Key),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrApiKeyNotAllowed, body)
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			PathHttpApi+"/apikey/"+strconv.Itoa(int(apiKey.ID)),
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/file",
+			nil,
+			testutils.WithToken(apiKey.Key),
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		// api keys of other workspaces can't be revoked
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			PathHttpApi+"/apikey/"+strconv.Itoa(int(list[0].ID)),
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, 20),
+		)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.Equal(t, ErrNotExistingApiKey, body)
+	})
+}
@@ -1,31 +1,60 @@
 package rtsync
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// WorkspaceCredentials logs into the workspace Name. When User is empty
+// Password is the workspace password and grants the owner role, otherwise
+// it is the user password and the role is the one of its membership.
 type WorkspaceCredentials struct {
 	Name     string `json:"name"`
+	User     string `json:"user,omitempty"`
 	Password string `json:"password"`
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 const (
-	ErrIncorrectPassword = "incorrect password"
-	ErrWorkspaceNotFound = "workspace not found"
+	ErrInvalidCredentials = "invalid workspace, user or password"
+	ErrTooManyAttempts    = "too many failed login attempts, retry later"
+	ErrWorkspaceNotFound  = "workspace not found"
+	ErrNotMember          = "user is not a member of the workspace"
 )
 
+const (
+	auditLoginFailed = "login_failed"
+	auditLoginLocked = "login_locked"
+)
+
+var errInvalidCredentials = errors.New(ErrInvalidCredentials)
+
 func (rts *realTimeSyncServer) authHandler() http.Handler {
 	router := http.NewServeMux()
 	router.HandleFunc("POST /login", rts.fetchWorkspaceHandler)
+	router.HandleFunc("POST /refresh", rts.refreshTokenHandler)
+	router.HandleFunc("POST /logout", rts.logoutHandler)
+	if rts.oidc != nil {
+		router.HandleFunc("GET /oidc/login", rts.oidcLoginHandler)
+		router.HandleFunc("GET /oidc/callback", rts.oidcCallbackHandler)
+	}
 
 	stack := middleware.CreateStack(
 		middleware.Logging,
@@ -53,25 +82,34 @@ func (rts *realTimeSyncServer) fetchWorkspaceHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	workspace, err := rts.db.FetchWorkspace(r.Context(), data.Name)
-	if err != nil {
-		http.Error(w, ErrWorkspaceNotFound, http.StatusNotFound)
+	ip := remoteIP(r)
+	if retryAfter, ok, report := rts.loginGuard.Allow(ip, data.Name); !ok {
+		if report {
+			rts.audit(r, auditLoginLocked, data)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, ErrTooManyAttempts, http.StatusTooManyRequests)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(workspace.Password), []byte(data.Password)); err != nil {
-		http.Error(w, ErrIncorrectPassword, http.StatusUnauthorized)
+	identity, err := rts.checkCredentials(r.Context(), data)
+	if errors.Is(err, errInvalidCredentials) {
+		rts.loginGuard.Fail(ip, data.Name)
+		rts.audit(r, auditLoginFailed, data)
+		http.Error(w, ErrInvalidCredentials, http.StatusUnauthorized)
 		return
 	}
-
-	token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: rts.jwtSecret}, workspace.ID)
 	if err != nil {
-		http.Error(w, "error while creating auth token", http.StatusInternalServerError)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	response := LoginResponse{
-		Token: token,
+	rts.loginGuard.Succeed(ip, data.Name)
+
+	response, err := rts.issueTokens(r.Context(), identity, "")
+	if err != nil {
+		http.Error(w, "error while creating auth token", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -81,3 +119,95 @@ func (rts *realTimeSyncServer) fetchWorkspaceHandler(w http.ResponseWriter, r *h
 		return
 	}
 }
+
+// checkCredentials returns errInvalidCredentials whatever the reason of the
+// failure is, so that the existence of workspaces and users is not leaked.
+// For the same reason a password is always compared, even when there is no
+// hash to compare it with.
+func (rts *realTimeSyncServer) checkCredentials(
+	ctx context.Context,
+	data WorkspaceCredentials,
+) (middleware.Identity, error) {
+	workspace, err := rts.db.FetchWorkspace(ctx, data.Name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return middleware.Identity{}, err
+	}
+	workspaceExists := err == nil
+
+	identity := middleware.Identity{
+		WorkspaceID: workspace.ID,
+		Role:        middleware.RoleOwner,
+	}
+
+	if data.User == "" {
+		if !comparePassword(workspace.Password, data.Password) || !workspaceExists {
+			return middleware.Identity{}, errInvalidCredentials
+		}
+		return identity, nil
+	}
+
+	user, err := rts.db.FetchUser(ctx, data.User)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return middleware.Identity{}, err
+	}
+	if !comparePassword(user.Password, data.Password) || !workspaceExists {
+		return middleware.Identity{}, errInvalidCredentials
+	}
+
+	member, err := rts.db.FetchWorkspaceMember(ctx, repository.FetchWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return middleware.Identity{}, errInvalidCredentials
+	}
+	if err != nil {
+		return middleware.Identity{}, err
+	}
+
+	identity.UserID = user.ID
+	identity.Role = middleware.Role(member.Role)
+	return identity, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// comparePassword compares password with hash, taking the same time even if
+// hash is empty or invalid
+func comparePassword(hash, password string) bool {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err == nil {
+		return true
+	} else if !errors.Is(err, bcrypt.ErrHashTooShort) {
+		return false
+	}
+
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+
+	return false
+}
+
+func (rts *realTimeSyncServer) audit(r *http.Request, action string, data WorkspaceCredentials) {
+	err := rts.db.AddAuditLog(r.Context(), repository.AddAuditLogParams{
+		Action:     action,
+		Workspace:  data.Name,
+		User:       data.User,
+		RemoteAddr: remoteIP(r),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
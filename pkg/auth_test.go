@@ -11,6 +11,7 @@ import (
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
@@ -25,7 +26,7 @@ func Test_fetchWorkspaceHandler(t *testing.T) {
 
 	repo := repository.New(db)
 	mockFileStorage := new(filestorage.MockFileStorage)
-	server := New(repo, mockFileStorage, Options{JWTSecret: []byte("secret")})
+	server := New(db, mockFileStorage, Options{JWTSecret: []byte("secret")})
 
 	hash, err := bcrypt.GenerateFromPassword([]byte("strong_password"), bcrypt.DefaultCost)
 	require.NoError(t, err)
@@ -59,7 +60,7 @@ func Test_fetchWorkspaceHandler(t *testing.T) {
 		}
 		res, body := testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
 		assert.Equal(t, http.StatusUnauthorized, res.Code)
-		assert.Equal(t, ErrIncorrectPassword, body)
+		assert.Equal(t, ErrInvalidCredentials, body)
 	})
 
 	t.Run("missing workspace", func(t *testing.T) {
@@ -69,8 +70,68 @@ func Test_fetchWorkspaceHandler(t *testing.T) {
 		}
 
 		res, body := testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
-		assert.Equal(t, http.StatusNotFound, res.Code)
-		assert.Equal(t, ErrWorkspaceNotFound, body)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrInvalidCredentials, body)
+	})
+
+	t.Run("member of the workspace", func(t *testing.T) {
+		userHash, err := bcrypt.GenerateFromPassword([]byte("user_password"), bcrypt.DefaultCost)
+		require.NoError(t, err)
+
+		userID, err := repo.AddUser(context.Background(), repository.AddUserParams{
+			Name:     "alice",
+			Password: string(userHash),
+		})
+		require.NoError(t, err)
+
+		workspace, err := repo.FetchWorkspace(context.Background(), "workspace1")
+		require.NoError(t, err)
+
+		data := WorkspaceCredentials{
+			Name:     "workspace1",
+			User:     "alice",
+			Password: "user_password",
+		}
+
+		// not yet a member
+		res, errBody := testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrInvalidCredentials, errBody)
+
+		require.NoError(t, repo.AddWorkspaceMember(context.Background(), repository.AddWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        string(middleware.RoleViewer),
+		}))
+
+		res, body := testutils.DoRequest[LoginResponse](t, server, http.MethodPost, apiPath, data)
+		assert.Equal(t, http.StatusOK, res.Code)
+
+		identity, err := middleware.VerifyToken(context.Background(), middleware.AuthOptions{SecretKey: []byte("secret")}, body.Token)
+		require.NoError(t, err)
+		assert.NotEmpty(t, identity.Session)
+		assert.Equal(t, middleware.Identity{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        middleware.RoleViewer,
+			Session:     identity.Session,
+		}, identity)
+
+		// wrong user password
+		data.Password = "strong_password"
+		res, errBody = testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrInvalidCredentials, errBody)
+	})
+
+	t.Run("failed attempts are audited", func(t *testing.T) {
+		entries, err := repo.FetchAuditLog(context.Background(), 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, entries)
+
+		assert.Equal(t, auditLoginFailed, entries[len(entries)-1].Action)
+		assert.Equal(t, "workspace1", entries[len(entries)-1].Workspace)
+		assert.Equal(t, "192.0.2.1", entries[len(entries)-1].RemoteAddr)
 	})
 
 	t.Cleanup(func() {
@@ -78,3 +139,44 @@ func Test_fetchWorkspaceHandler(t *testing.T) {
 		db.Close()
 	})
 }
+
+func Test_fetchWorkspaceHandlerLockout(t *testing.T) {
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	server := New(db, mockFileStorage, Options{JWTSecret: []byte("secret")})
+
+	t.Cleanup(func() { server.Close() })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("strong_password"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.AddWorkspace(context.Background(), repository.AddWorkspaceParams{
+		Name:     "workspace1",
+		Password: string(hash),
+	}))
+
+	const apiPath = PathHttpAuth + "/login"
+
+	for range loginMaxFailures {
+		data := WorkspaceCredentials{Name: "workspace1", Password: "invalid_pass"}
+		res, _ := testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
+		require.Equal(t, http.StatusUnauthorized, res.Code)
+	}
+
+	// even the right password is refused
+	data := WorkspaceCredentials{Name: "workspace1", Password: "strong_password"}
+	res, body := testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, ErrTooManyAttempts, body)
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+
+	// the refused attempts are audited once
+	res, _ = testutils.DoRequest[string](t, server, http.MethodPost, apiPath, data)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+
+	entries, err := repo.FetchAuditLog(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Len(t, entries, loginMaxFailures+1)
+	assert.Equal(t, auditLoginLocked, entries[0].Action)
+}
@@ -0,0 +1,129 @@
+package rtsync
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+type BatchBody struct {
+	Operations []service.BatchOperation `json:"operations"`
+}
+
+type BatchResponse struct {
+	Results []service.BatchResult `json:"results"`
+}
+
+const ErrBatch = "impossible to apply the operations"
+
+// batchHandler applies the operations all together or none of them, the
+// response lists the outcome of each one. The chunks are not applied while
+// it runs, so that the files in memory are updated along with the database,
+// and the changes are broadcast as if made by a client.
+func (rts *realTimeSyncServer) batchHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data BatchBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(data.Operations) == 0 {
+		http.Error(w, "no operations", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	ws.flush()
+
+	// the content replaced by an update is needed to broadcast the chunks
+	for _, op := range data.Operations {
+		if op.Op == service.BatchUpdate {
+			_, _ = rts.loadFile(ws, op.FileID)
+		}
+	}
+
+	results, err := rts.fileService.Batch(r.Context(), workspaceID, data.Operations)
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, service.ErrBatchFailed):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrInvalidOperation):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("batch in workspace %d failed: %v", workspaceID, err)
+		http.Error(w, ErrBatch, http.StatusInternalServerError)
+		return
+	default:
+		rts.applyBatchResults(ws, data.Operations, results)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(BatchResponse{Results: results}); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// applyBatchResults updates the files in memory and notifies the clients:
+// updates are broadcast as chunks, creations, renames and deletions as
+// events. ws.mut must be held.
+func (rts *realTimeSyncServer) applyBatchResults(ws *workspaceHub, ops []service.BatchOperation, results []service.BatchResult) {
+	for i, op := range ops {
+		file := results[i].File
+		header := WsMessageHeader{FileId: file.ID, WorkspaceId: ws.id}
+
+		switch op.Op {
+		case service.BatchCreate:
+			header.Type = CreateEventType
+		case service.BatchDelete:
+			ws.forget(file.ID)
+			header.Type = DeleteEventType
+		case service.BatchRename:
+			if fileWithContent, ok := ws.files[file.ID]; ok {
+				fileWithContent.File = *file
+				ws.files[file.ID] = fileWithContent
+			}
+			header.Type = RenameEventType
+		case service.BatchUpdate:
+			previous, ok := ws.files[file.ID]
+			if !ok {
+				// the previous content couldn't be read, the clients can't
+				// be sent the chunks
+				ws.store(FileWithContent{File: *file, Content: string(op.Content)})
+				continue
+			}
+			previous.File = *file
+			header.Type = ChunkEventType
+			rts.replaceContent(ws, header, previous, string(op.Content))
+			continue
+		default:
+			continue
+		}
+
+		rts.broadcastEventMessage(ws, EventMessage{
+			WsMessageHeader: header,
+			WorkspacePath:   file.WorkspacePath,
+			ObjectType:      "file",
+		})
+	}
+
+	ws.evict()
+}
@@ -0,0 +1,248 @@
+package rtsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_batchHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk/note",
+		WorkspacePath: "note.md",
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+	server.hub.workspace(file.WorkspaceID).files[file.ID] = FileWithContent{File: file, Content: "note"}
+
+	t.Run("should require the editor role", func(t *testing.T) {
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/batch",
+			BatchBody{Operations: []service.BatchOperation{{Op: service.BatchDelete, FileID: file.ID}}},
+			testutils.WithRoleAuthHeader(options.JWTSecret, 1, middleware.RoleViewer),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+	})
+
+	t.Run("should report the failed operation", func(t *testing.T) {
+		mockFileStorage.On("CreateObject", []byte("created")).Return("disk/created", nil).Once()
+		mockFileStorage.On("DeleteObject", "disk/created").Return(nil).Once()
+
+		res, body := testutils.DoRequest[BatchResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/batch",
+			BatchBody{Operations: []service.BatchOperation{
+				{Op: service.BatchCreate, Path: "created.md", Content: []byte("created")},
+				{Op: service.BatchRename, FileID: file.ID, Path: "created.md"},
+			}},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+		require.Len(t, body.Results, 2)
+		assert.Equal(t, service.BatchRolledBack, body.Results[0].Status)
+		assert.Equal(t, service.BatchFailed, body.Results[1].Status)
+		mockFileStorage.AssertExpectations(t)
+	})
+
+	t.Run("should apply the operations and update the files in memory", func(t *testing.T) {
+		mockFileStorage.On("CreateObject", []byte("updated")).Return("disk/updated", nil).Once()
+		mockFileStorage.On("DeleteObject", "disk/note").Return(nil).Once()
+
+		res, body := testutils.DoRequest[BatchResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/batch",
+			BatchBody{Operations: []service.BatchOperation{
+				{Op: service.BatchRename, FileID: file.ID, Path: "renamed.md"},
+				{Op: service.BatchUpdate, FileID: file.ID, Content: []byte("updated")},
+			}},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Len(t, body.Results, 2)
+		assert.Equal(t, "renamed.md", body.Results[1].File.WorkspacePath)
+		mockFileStorage.AssertExpectations(t)
+
+		assert.Equal(t, "renamed.md", server.hub.workspace(file.WorkspaceID).files[file.ID].WorkspacePath)
+		assert.Equal(t, "disk/updated", server.hub.workspace(file.WorkspaceID).files[file.ID].DiskPath)
+		assert.Equal(t, "updated", server.hub.workspace(file.WorkspaceID).files[file.ID].Content)
+	})
+}
+
+func Test_batchHandlerBroadcast(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk/note",
+		WorkspacePath: "note.md",
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+	handler.hub.workspace(file.WorkspaceID).files[file.ID] = FileWithContent{File: file, Content: "note"}
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	//nolint:bodyclose
+	conn, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleEditor))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+
+	t.Run("should broadcast the updates as chunks and the other operations as events", func(t *testing.T) {
+		mockFileStorage.On("CreateObject", []byte("note updated")).Return("disk/updated", nil).Once()
+		mockFileStorage.On("DeleteObject", "disk/note").Return(nil).Once()
+		mockFileStorage.On("CreateObject", []byte("created")).Return("disk/created", nil).Once()
+
+		res, body := testutils.DoRequest[BatchResponse](
+			t,
+			handler,
+			http.MethodPost,
+			PathHttpApi+"/batch",
+			BatchBody{Operations: []service.BatchOperation{
+				{Op: service.BatchUpdate, FileID: file.ID, Content: []byte("note updated")},
+				{Op: service.BatchRename, FileID: file.ID, Path: "renamed.md"},
+				{Op: service.BatchCreate, Path: "created.md", Content: []byte("created")},
+			}},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Len(t, body.Results, 3)
+		mockFileStorage.AssertExpectations(t)
+
+		var chunk ChunkMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &chunk))
+		assert.Equal(t, ChunkEventType, chunk.Type)
+		assert.Equal(t, file.ID, chunk.FileId)
+		content := "note"
+		for _, d := range chunk.Chunks {
+			content = diff.ApplyDiff(content, d)
+		}
+		assert.Equal(t, "note updated", content)
+
+		var renamed EventMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &renamed))
+		assert.Equal(t, RenameEventType, renamed.Type)
+		assert.Equal(t, file.ID, renamed.FileId)
+		assert.Equal(t, "renamed.md", renamed.WorkspacePath)
+
+		var created EventMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &created))
+		assert.Equal(t, CreateEventType, created.Type)
+		assert.Equal(t, body.Results[2].File.ID, created.FileId)
+		assert.Equal(t, "created.md", created.WorkspacePath)
+	})
+
+	t.Run("should broadcast the deletions as events", func(t *testing.T) {
+		mockFileStorage.On("DeleteObject", "disk/updated").Return(nil).Once()
+
+		res, _ := testutils.DoRequest[BatchResponse](
+			t,
+			handler,
+			http.MethodPost,
+			PathHttpApi+"/batch",
+			BatchBody{Operations: []service.BatchOperation{{Op: service.BatchDelete, FileID: file.ID}}},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		mockFileStorage.AssertExpectations(t)
+
+		var deleted EventMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &deleted))
+		assert.Equal(t, DeleteEventType, deleted.Type)
+		assert.Equal(t, file.ID, deleted.FileId)
+		_, ok := handler.hub.workspace(file.WorkspaceID).files[file.ID]
+		assert.False(t, ok)
+	})
+}
+
+func Test_batchHandlerDuringBackup(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	options := Options{JWTSecret: []byte("secret"), AdminToken: "admin"}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	// the batch is still running, holding the workspace, when the backup
+	// pauses the hubs
+	mockFileStorage.On("CreateObject", []byte("created")).Return("disk/created", nil).After(200 * time.Millisecond)
+	mockFileStorage.On("ReadObject", "disk/created").Return([]byte("created"), nil)
+
+	body, err := json.Marshal(BatchBody{Operations: []service.BatchOperation{
+		{Op: service.BatchCreate, Path: "created.md", Content: []byte("created")},
+	}})
+	require.NoError(t, err)
+
+	batchDone := make(chan int, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, PathHttpApi+"/batch", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testutils.CreateToken(options.JWTSecret, 1, middleware.RoleOwner))
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		batchDone <- res.Code
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	backupDone := make(chan int, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, PathHttpAdmin+"/backup", nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		backupDone <- res.Code
+	}()
+
+	for _, done := range []chan int{batchDone, backupDone} {
+		select {
+		case code := <-done:
+			assert.Equal(t, http.StatusOK, code)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the batch and the backup are deadlocked")
+		}
+	}
+}
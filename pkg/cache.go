@@ -0,0 +1,118 @@
+package rtsync
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+)
+
+// DefaultMaxFilesInMemory is the number of files of a workspace kept in
+// memory when no limit is given
+const DefaultMaxFilesInMemory = 256
+
+// fileCache keeps the ids of the files of a workspace loaded in memory, the
+// most recently used first. A negative capacity keeps every file. It's
+// guarded by ws.mut.
+type fileCache struct {
+	capacity int
+	recent   *list.List
+	elements map[int64]*list.Element
+}
+
+func newFileCache(capacity int) fileCache {
+	return fileCache{
+		capacity: capacity,
+		recent:   list.New(),
+		elements: make(map[int64]*list.Element),
+	}
+}
+
+// touch marks the file as the most recently used
+func (c *fileCache) touch(fileID int64) {
+	if e, ok := c.elements[fileID]; ok {
+		c.recent.MoveToFront(e)
+		return
+	}
+	c.elements[fileID] = c.recent.PushFront(fileID)
+}
+
+func (c *fileCache) remove(fileID int64) {
+	if e, ok := c.elements[fileID]; ok {
+		c.recent.Remove(e)
+		delete(c.elements, fileID)
+	}
+}
+
+// overflow returns the least recently used files over the capacity
+func (c *fileCache) overflow() []int64 {
+	if c.capacity < 0 {
+		return nil
+	}
+
+	var fileIDs []int64
+	for e := c.recent.Back(); e != nil && c.recent.Len()-len(fileIDs) > c.capacity; e = e.Prev() {
+		fileIDs = append(fileIDs, e.Value.(int64))
+	}
+	return fileIDs
+}
+
+// store keeps the file in memory, ws.mut must be held
+func (ws *workspaceHub) store(file FileWithContent) {
+	ws.files[file.ID] = file
+	ws.cache.touch(file.ID)
+}
+
+// forget removes the file from memory, dropping its unsaved edits. ws.mut
+// must be held.
+func (ws *workspaceHub) forget(fileID int64) {
+	delete(ws.files, fileID)
+	delete(ws.dirty, fileID)
+	ws.cache.remove(fileID)
+}
+
+// evict removes the least recently used files over the capacity, once they
+// are saved. ws.mut must be held.
+func (ws *workspaceHub) evict() {
+	fileIDs := ws.cache.overflow()
+	if len(fileIDs) == 0 {
+		return
+	}
+
+	// the content of an evicted file is read again from the storage, so it
+	// must be up to date
+	ws.flushFiles(fileIDs)
+
+	for _, fileID := range fileIDs {
+		// a file which can't be saved is kept until it is
+		if _, dirty := ws.dirty[fileID]; !dirty {
+			ws.forget(fileID)
+		}
+	}
+}
+
+// loadFile returns the file of the workspace, reading it from the storage
+// if it isn't in memory. ws.mut must be held.
+func (rts *realTimeSyncServer) loadFile(ws *workspaceHub, fileID int64) (FileWithContent, error) {
+	if file, ok := ws.files[fileID]; ok {
+		ws.cache.touch(fileID)
+		return file, nil
+	}
+
+	dbFile, err := rts.db.FetchFile(context.Background(), fileID)
+	if err != nil || dbFile.WorkspaceID != ws.id {
+		return FileWithContent{}, errors.New(ErrNotExistingFile)
+	}
+
+	content, err := rts.storage.ReadObject(dbFile.DiskPath)
+	if err != nil {
+		log.Printf("error while reading file %d (%s), %v", dbFile.ID, dbFile.DiskPath, err)
+		return FileWithContent{}, errors.New(ErrReadingFile)
+	}
+
+	file := FileWithContent{File: dbFile, Content: string(content)}
+	ws.store(file)
+	ws.evict()
+
+	return file, nil
+}
@@ -0,0 +1,98 @@
+package rtsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/coder/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Subprotocols of the sync socket, in order of preference. The clients not
+// asking for one use JSON.
+const (
+	SubprotocolMsgPack = "rtsync.msgpack"
+	SubprotocolJSON    = "rtsync.json"
+)
+
+var errMissingType = errors.New("message without type")
+
+// codec encodes the messages of a connection in the negotiated subprotocol.
+// MessagePack uses the same field names of JSON.
+type codec interface {
+	encoding() string
+	frameType() websocket.MessageType
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+func codecFor(subprotocol string) codec {
+	if subprotocol == SubprotocolMsgPack {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+// envelope is the part of every message telling its type, so the message
+// can be decoded into the right struct
+type envelope struct {
+	Type *MessageType `json:"type"`
+}
+
+// decodeEnvelope returns the type of the encoded message
+func decodeEnvelope(c codec, data []byte) (MessageType, error) {
+	var env envelope
+	if err := c.Unmarshal(data, &env); err != nil {
+		return 0, err
+	}
+	if env.Type == nil {
+		return 0, errMissingType
+	}
+	return *env.Type, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) encoding() string {
+	return EncodingJSON
+}
+
+func (jsonCodec) frameType() websocket.MessageType {
+	return websocket.MessageText
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) encoding() string {
+	return EncodingMsgPack
+}
+
+func (msgpackCodec) frameType() websocket.MessageType {
+	return websocket.MessageBinary
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,137 @@
+package rtsync
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMsgpackCodec(t *testing.T) {
+	c := codecFor(SubprotocolMsgPack)
+
+	msg := ChunkMessage{
+		WsMessageHeader: WsMessageHeader{
+			SenderId: "not sent",
+			FileId:   1,
+			Type:     ChunkEventType,
+		},
+		Chunks: []diff.DiffChunk{{Type: diff.DiffAdd, Position: 3, Text: "hi", Len: 2}},
+	}
+
+	data, err := c.Marshal(msg)
+	require.NoError(t, err)
+
+	// the fields have the same names of JSON, the header is inlined
+	var fields map[string]any
+	require.NoError(t, msgpack.Unmarshal(data, &fields))
+	assert.ElementsMatch(t, []string{"fileId", "type", "chunks"}, keys(fields))
+
+	msgType, err := decodeEnvelope(c, data)
+	require.NoError(t, err)
+	assert.Equal(t, ChunkEventType, msgType)
+
+	var decoded ChunkMessage
+	require.NoError(t, c.Unmarshal(data, &decoded))
+	msg.SenderId = ""
+	assert.Equal(t, msg, decoded)
+
+	data, err = c.Marshal(map[string]any{"fileId": 1})
+	require.NoError(t, err)
+	_, err = decodeEnvelope(c, data)
+	assert.ErrorIs(t, err, errMissingType)
+}
+
+func Test_wsHandlerSubprotocols(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	mockFileStorage := new(filestorage.MockFileStorage)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk_path",
+		WorkspacePath: "note.md",
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+	mockFileStorage.On("ReadObject", file.DiskPath).Return([]byte{}, nil)
+	mockFileStorage.On("WriteObject", file.DiskPath, mock.Anything).Return(nil)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	dial := func(subprotocols ...string) *websocket.Conn {
+		opts := dialOptions(options.JWTSecret, 1, middleware.RoleEditor)
+		opts.Subprotocols = subprotocols
+		//nolint:bodyclose
+		conn, _, err := websocket.Dial(ctx, url, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+		return conn
+	}
+
+	msgpackClient := dial(SubprotocolJSON, SubprotocolMsgPack)
+	jsonClient := dial()
+	assert.Equal(t, SubprotocolMsgPack, msgpackClient.Subprotocol())
+	assert.Equal(t, "", jsonClient.Subprotocol())
+
+	msg := ChunkMessage{
+		WsMessageHeader: WsMessageHeader{Type: ChunkEventType, FileId: file.ID},
+		Chunks:          []diff.DiffChunk{{Type: diff.DiffAdd, Position: 0, Text: "hello", Len: 5}},
+	}
+
+	t.Run("should decode MessagePack and fall back to JSON", func(t *testing.T) {
+		data, err := codecFor(SubprotocolMsgPack).Marshal(msg)
+		require.NoError(t, err)
+		require.NoError(t, msgpackClient.Write(ctx, websocket.MessageBinary, data))
+
+		var received ChunkMessage
+		require.NoError(t, wsjson.Read(ctx, jsonClient, &received))
+		assert.Equal(t, msg, received)
+	})
+
+	t.Run("should encode in the subprotocol of the client", func(t *testing.T) {
+		msg.Chunks = []diff.DiffChunk{{Type: diff.DiffAdd, Position: 5, Text: "!", Len: 1}}
+		require.NoError(t, wsjson.Write(ctx, jsonClient, msg))
+
+		frameType, data, err := msgpackClient.Read(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, websocket.MessageBinary, frameType)
+
+		var received ChunkMessage
+		require.NoError(t, codecFor(SubprotocolMsgPack).Unmarshal(data, &received))
+		assert.Equal(t, msg, received)
+	})
+}
+
+func keys(m map[string]any) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
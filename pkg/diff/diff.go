@@ -88,3 +88,26 @@ func ApplyDiff(text string, diff DiffChunk) string {
 
 	panic("not reachable")
 }
+
+// TransformPosition returns where the position ends up once the chunks,
+// computed by ComputeDiff, are applied in order. Text added at the position
+// leaves it before the new text, a removed range containing it moves it to
+// the start of the range.
+func TransformPosition(position int64, chunks []DiffChunk) int64 {
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case DiffAdd:
+			if position > chunk.Position {
+				position += chunk.Len
+			}
+		case DiffRemove:
+			if position >= chunk.Position+chunk.Len {
+				position -= chunk.Len
+			} else if position > chunk.Position {
+				position = chunk.Position
+			}
+		}
+	}
+
+	return position
+}
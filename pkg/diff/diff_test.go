@@ -1,6 +1,7 @@
 package diff
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -197,3 +198,27 @@ func TestApplyDiff(t *testing.T) {
 		}
 	})
 }
+
+func TestTransformPosition(t *testing.T) {
+	text := "hello world, how are you?"
+	update := "hi world, how is it going?"
+	chunks := ComputeDiff(text, update)
+
+	// the cursors keep the words they were on
+	for _, word := range []string{"world", "how"} {
+		position := int64(strings.Index(text, word))
+		assert.Equal(t, int64(strings.Index(update, word)), TransformPosition(position, chunks), word)
+	}
+
+	assert.Equal(t, int64(0), TransformPosition(0, chunks))
+	assert.Equal(t, int64(len(update)), TransformPosition(int64(len(text)), chunks))
+
+	chunks = []DiffChunk{{Type: DiffRemove, Position: 2, Text: "llo", Len: 3}}
+	assert.Equal(t, int64(2), TransformPosition(4, chunks))
+	assert.Equal(t, int64(2), TransformPosition(5, chunks))
+	assert.Equal(t, int64(1), TransformPosition(1, chunks))
+
+	chunks = []DiffChunk{{Type: DiffAdd, Position: 2, Text: "xx", Len: 2}}
+	assert.Equal(t, int64(2), TransformPosition(2, chunks))
+	assert.Equal(t, int64(5), TransformPosition(3, chunks))
+}
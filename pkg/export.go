@@ -0,0 +1,76 @@
+package rtsync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+const ErrInvalidExportFormat = "invalid export format, use zip or tar.gz"
+
+var exportContentTypes = map[string]string{
+	service.ExportZip:   "application/zip",
+	service.ExportTarGz: "application/gzip",
+}
+
+// exportHandler streams the workspace as a vault archive, the files with
+// edits still to be saved are exported with their content in memory
+func (rts *realTimeSyncServer) exportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.ExportZip
+	}
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		http.Error(w, ErrInvalidExportFormat, http.StatusBadRequest)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+	workspace, err := rts.workspaces.Fetch(r.Context(), workspaceID)
+	if err != nil {
+		http.Error(w, ErrWorkspaceNotFound, http.StatusNotFound)
+		return
+	}
+
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	contents := make(map[int64]string, len(ws.files))
+	for id, file := range ws.files {
+		contents[id] = file.Content
+	}
+	ws.mut.Unlock()
+
+	contentOf := func(fileID int64) (string, bool) {
+		content, ok := contents[fileID]
+		return content, ok
+	}
+
+	clearWriteDeadline(w)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", workspace.Name+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	// the archive is streamed, on error it is left without its trailer and
+	// the client fails to open it
+	err = rts.fileService.Export(r.Context(), workspaceID, w, format, contentOf)
+	if err != nil {
+		log.Printf("export of workspace %d failed: %v", workspaceID, err)
+	}
+}
+
+// clearWriteDeadline lets the handler stream a response for longer than the
+// write timeout of the server, archives of any size must not be cut off
+func clearWriteDeadline(w http.ResponseWriter) {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("error while clearing the write deadline, %v", err)
+	}
+}
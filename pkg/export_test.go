@@ -0,0 +1,119 @@
+package rtsync
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_exportHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	workspace, err := repo.CreateWorkspace(context.Background(), repository.CreateWorkspaceParams{
+		Name:     "notes",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	stored, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk/stored",
+		WorkspacePath: "stored.md",
+		WorkspaceID:   workspace.ID,
+	})
+	require.NoError(t, err)
+	pending, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk/pending",
+		WorkspacePath: "dir/pending.md",
+		WorkspaceID:   workspace.ID,
+	})
+	require.NoError(t, err)
+
+	mockFileStorage.On("ReadObject", stored.DiskPath).Return([]byte("stored"), nil)
+	server.hub.workspace(pending.WorkspaceID).files[pending.ID] = FileWithContent{File: pending, Content: "in memory"}
+
+	t.Run("should export the workspace as zip", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, PathHttpApi+"/export", nil)
+		require.NoError(t, testutils.WithRoleAuthHeader(options.JWTSecret, workspace.ID, middleware.RoleViewer)(req))
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "application/zip", res.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="notes.zip"`, res.Header().Get("Content-Disposition"))
+
+		body := res.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+
+		got := make(map[string]string)
+		for _, f := range zr.File {
+			r, err := f.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(r)
+			require.NoError(t, err)
+			got[f.Name] = string(content)
+		}
+		assert.Equal(t, map[string]string{"stored.md": "stored", "dir/pending.md": "in memory"}, got)
+		mockFileStorage.AssertExpectations(t)
+	})
+
+	t.Run("should refuse an unknown format", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/export?format=rar",
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, workspace.ID),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidExportFormat, body)
+	})
+	t.Run("should outlast the write timeout of the server", func(t *testing.T) {
+		slow, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+			DiskPath:      "disk/slow",
+			WorkspacePath: "slow.md",
+			WorkspaceID:   workspace.ID,
+		})
+		require.NoError(t, err)
+		mockFileStorage.On("ReadObject", slow.DiskPath).After(300*time.Millisecond).Return([]byte("slow"), nil)
+
+		httpServer := httptest.NewUnstartedServer(server)
+		httpServer.Config.WriteTimeout = 100 * time.Millisecond
+		httpServer.Start()
+		t.Cleanup(httpServer.Close)
+
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL+PathHttpApi+"/export", nil)
+		require.NoError(t, err)
+		require.NoError(t, testutils.WithAuthHeader(options.JWTSecret, workspace.ID)(req))
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		assert.Len(t, zr.File, 3)
+	})
+}
@@ -1,17 +1,19 @@
 package filestorage
 
 import (
-	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 )
 
+// quarantineDir is where the quarantined objects are moved, relative to
+// the base path
+const quarantineDir = "quarantine"
+
 type Disk struct {
 	basepath string
 }
@@ -70,95 +72,79 @@ func (d Disk) ReadObject(relativePath string) ([]byte, error) {
 	return os.ReadFile(diskPath)
 }
 
-func (d Disk) PersistChunk(relativePath string, chunk diff.DiffChunk) error {
+// WriteObject replaces the content of the object atomically, writing a
+// temporary file renamed over the object
+func (d Disk) WriteObject(relativePath string, content []byte) error {
 	diskPath := path.Join(d.basepath, relativePath)
 
-	_, err := os.Stat(diskPath)
-	if os.IsNotExist(err) {
-		return err
-	}
-
-	relativePath = path.Join(d.basepath, relativePath)
-	switch chunk.Type {
-	case diff.DiffAdd:
-		return addBytesToFile(relativePath, chunk.Position, chunk.Text)
-	case diff.DiffRemove:
-		return removeBytesFromFile(relativePath, chunk.Position, chunk.Len)
-	}
-	return fmt.Errorf("diff type %v not supported", chunk.Type)
-}
-
-func addBytesToFile(filePath string, start int64, str string) error {
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = file.Seek(start, 0)
-	if err != nil {
+	if _, err := os.Stat(diskPath); err != nil {
 		return err
 	}
 
-	remainder, err := io.ReadAll(file)
+	file, err := os.CreateTemp(filepath.Dir(diskPath), ".write-*")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(file.Name())
 
-	_, err = file.Seek(start, 0)
-	if err != nil {
+	if _, err := file.Write(content); err != nil {
+		file.Close()
 		return err
 	}
-
-	_, err = file.WriteString(str)
-	if err != nil {
-		return err
-	}
-
-	_, err = file.Write(remainder)
-	if err != nil {
+	if err := file.Sync(); err != nil {
+		file.Close()
 		return err
 	}
-
-	err = file.Sync()
-	if err != nil {
+	if err := file.Close(); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(file.Name(), diskPath)
 }
 
-func removeBytesFromFile(filePath string, start, length int64) error {
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = file.Seek(start+length, 0)
-	if err != nil {
-		return err
-	}
+// ListObjects returns the objects under the base path. Only the paths
+// created by CreateObject are returned, so that other files sharing the
+// directory (e.g. the database) are never mistaken for objects.
+func (d Disk) ListObjects() ([]string, error) {
+	var objects []string
+	err := filepath.WalkDir(d.basepath, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(d.basepath, p)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		if isObjectPath(relativePath) {
+			objects = append(objects, relativePath)
+		}
+		return nil
+	})
 
-	remainingData, err := io.ReadAll(file)
-	if err != nil {
-		return err
-	}
+	return objects, err
+}
 
-	_, err = file.Seek(start, 0)
-	if err != nil {
+func (d Disk) QuarantineObject(relativePath string) error {
+	quarantinePath := path.Join(d.basepath, quarantineDir, relativePath)
+	if err := os.MkdirAll(filepath.Dir(quarantinePath), os.ModePerm); err != nil {
 		return err
 	}
 
-	_, err = file.Write(remainingData)
-	if err != nil {
-		return err
-	}
+	return os.Rename(path.Join(d.basepath, relativePath), quarantinePath)
+}
 
-	err = file.Truncate(start + int64(len(remainingData)))
+// isObjectPath reports whether p is a path returned by CreateObject, an
+// uuid split in directories
+func isObjectPath(p string) bool {
+	id, err := uuid.Parse(strings.ReplaceAll(p, "/", "-"))
 	if err != nil {
-		return err
+		return false
 	}
-
-	return nil
+	return path.Join(strings.Split(id.String(), "-")...) == p
 }
@@ -5,66 +5,10 @@ import (
 	"path"
 	"testing"
 
-	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestPersistChunk(t *testing.T) {
-	t.Run("happy path", func(t *testing.T) {
-		tests := []struct {
-			name     string
-			expected string
-			diffs    [][]diff.DiffChunk
-		}{
-			{
-				name:     "compute remove chunk in present file",
-				expected: "hello",
-				diffs: [][]diff.DiffChunk{
-					diff.ComputeDiff("hello", ""),
-					diff.ComputeDiff("", "he__llo"),
-					diff.ComputeDiff("he__llo", "hello"),
-				},
-			},
-			{
-				name:     "compute add chunk in present file",
-				expected: "hello world!",
-				diffs: [][]diff.DiffChunk{
-					diff.ComputeDiff("", "hello"),
-					diff.ComputeDiff("hello", "hello!"),
-					diff.ComputeDiff("hello!", "hello world!"),
-				},
-			},
-		}
-
-		dir := t.TempDir()
-		d := NewDisk(dir)
-		for _, tt := range tests {
-			t.Run(tt.name, func(t *testing.T) {
-				filePath, err := d.CreateObject([]byte(""))
-				assert.NoError(t, err)
-				for _, di := range tt.diffs {
-					for _, d2 := range di {
-						assert.NoError(t, d.PersistChunk(filePath, d2))
-					}
-				}
-
-				fileContent, err := d.ReadObject(filePath)
-				require.NoError(t, err)
-
-				assert.Equal(t, tt.expected, string(fileContent))
-			})
-		}
-	})
-
-	t.Run("should return error on not existing file", func(t *testing.T) {
-		dir := t.TempDir()
-		d := NewDisk(dir)
-
-		assert.Error(t, d.PersistChunk("not-existing-file", diff.ComputeDiff("", "foo")[0]))
-	})
-}
-
 func TestDisk(t *testing.T) {
 	dir := t.TempDir()
 	d := NewDisk(dir)
@@ -80,6 +24,16 @@ func TestDisk(t *testing.T) {
 
 	assert.Equal(t, content, fileContent)
 
+	// write object
+	err = d.WriteObject(p, []byte("foo bar"))
+	assert.NoError(t, err)
+
+	fileContent, err = d.ReadObject(p)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foo bar"), fileContent)
+
+	assert.Error(t, d.WriteObject("not-existing-file", content))
+
 	// delete object
 	_, err = os.Stat(path.Join(d.basepath, p))
 	assert.NoError(t, err)
@@ -90,3 +44,32 @@ func TestDisk(t *testing.T) {
 	_, err = os.Stat(path.Join(d.basepath, p))
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestListObjects(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDisk(dir)
+
+	first, err := d.CreateObject([]byte("first"))
+	require.NoError(t, err)
+	second, err := d.CreateObject([]byte("second"))
+	require.NoError(t, err)
+
+	// files sharing the directory are not objects
+	require.NoError(t, os.WriteFile(path.Join(dir, "db.sqlite3"), []byte("db"), 0644))
+
+	objects, err := d.ListObjects()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{first, second}, objects)
+
+	t.Run("quarantined objects are not listed", func(t *testing.T) {
+		require.NoError(t, d.QuarantineObject(first))
+
+		objects, err := d.ListObjects()
+		require.NoError(t, err)
+		assert.Equal(t, []string{second}, objects)
+
+		content, err := os.ReadFile(path.Join(dir, quarantineDir, first))
+		require.NoError(t, err)
+		assert.Equal(t, "first", string(content))
+	})
+}
@@ -3,20 +3,23 @@ package filestorage
 import (
 	"crypto/sha256"
 	"fmt"
-
-	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 )
 
 type Storage interface {
-	// PersistChunk adds a chunk to the provided filepath, it returns an error
-	// if the file doesn't exists
-	PersistChunk(string, diff.DiffChunk) error
 	// CreateObject creates an object and returns the path
 	CreateObject([]byte) (string, error)
 	// DeleteObject deletes an object
 	DeleteObject(string) error
 	// ReadObject reads an object
 	ReadObject(string) ([]byte, error)
+	// WriteObject replaces the content of an existing object, it returns an
+	// error if the object doesn't exist
+	WriteObject(string, []byte) error
+	// ListObjects returns the paths of all the objects
+	ListObjects() ([]string, error)
+	// QuarantineObject moves an object out of the storage, keeping it
+	// for inspection
+	QuarantineObject(string) error
 }
 
 func GenerateHash(content []byte) string {
@@ -1,7 +1,6 @@
 package filestorage
 
 import (
-	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,11 +8,6 @@ type MockFileStorage struct {
 	mock.Mock
 }
 
-func (m *MockFileStorage) PersistChunk(p string, d diff.DiffChunk) error {
-	args := m.Called(p, d)
-	return args.Error(0)
-}
-
 func (m *MockFileStorage) CreateObject(c []byte) (string, error) {
 	args := m.Called(c)
 	return args.String(0), args.Error(1)
@@ -28,3 +22,18 @@ func (m *MockFileStorage) ReadObject(p string) ([]byte, error) {
 	args := m.Called(p)
 	return args.Get(0).([]byte), args.Error(1)
 }
+
+func (m *MockFileStorage) WriteObject(p string, c []byte) error {
+	args := m.Called(p, c)
+	return args.Error(0)
+}
+
+func (m *MockFileStorage) ListObjects() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockFileStorage) QuarantineObject(p string) error {
+	args := m.Called(p)
+	return args.Error(0)
+}
@@ -0,0 +1,146 @@
+package rtsync
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultFlushIdle is how long after its last edit a file is saved
+	DefaultFlushIdle = 500 * time.Millisecond
+	// DefaultFlushInterval is how long a file being edited can stay unsaved
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// dirtyFile tracks the edits of a file since it was last saved
+type dirtyFile struct {
+	since time.Time
+	last  time.Time
+}
+
+// deadline is when the file must be saved: once it has been idle, or once it
+// has been edited for the whole interval
+func (d dirtyFile) deadline(idle, interval time.Duration) time.Time {
+	idleAt, intervalAt := d.last.Add(idle), d.since.Add(interval)
+	if idleAt.Before(intervalAt) {
+		return idleAt
+	}
+	return intervalAt
+}
+
+// markDirty records an edit of the file, ws.mut must be held
+func (ws *workspaceHub) markDirty(fileID int64, now time.Time) {
+	d, ok := ws.dirty[fileID]
+	if !ok {
+		d.since = now
+	}
+	d.last = now
+	ws.dirty[fileID] = d
+
+	if !ok {
+		select {
+		case ws.dirtied <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush saves the edited files, waiting for the ones being saved in the
+// background first so that they're never overwritten with an older content.
+// A file which can't be saved stays dirty. ws.mut must be held.
+func (ws *workspaceHub) flush() {
+	ws.pendingWrites.Wait()
+
+	for fileID := range ws.dirty {
+		ws.saveDirty(fileID)
+	}
+}
+
+// flushFiles is flush limited to the given files, ws.mut must be held
+func (ws *workspaceHub) flushFiles(fileIDs []int64) {
+	ws.pendingWrites.Wait()
+
+	for _, fileID := range fileIDs {
+		if _, dirty := ws.dirty[fileID]; dirty {
+			ws.saveDirty(fileID)
+		}
+	}
+}
+
+// saveDirty saves the edited file, which stays dirty if it can't be saved.
+// ws.mut must be held.
+func (ws *workspaceHub) saveDirty(fileID int64) {
+	if err := ws.save(ws.files[fileID]); err != nil {
+		log.Printf("error while saving file %d, %v", fileID, err)
+		return
+	}
+	delete(ws.dirty, fileID)
+}
+
+// flushLoop saves the edited files of the workspace when they're due, until
+// the hub is stopped
+func (h *hub) flushLoop(ws *workspaceHub) {
+	timer := time.NewTimer(h.flushIdle)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ws.dirtied:
+		case <-timer.C:
+		case <-h.ctx.Done():
+			return
+		}
+
+		if wait, ok := h.flushDue(ws, time.Now()); ok {
+			timer.Reset(wait)
+		}
+	}
+}
+
+// flushDue saves the files whose deadline has passed, without holding ws.mut
+// while writing them. It returns how long to wait for the next deadline, if
+// any file is still dirty. A file which can't be saved is retried later.
+func (h *hub) flushDue(ws *workspaceHub, now time.Time) (time.Duration, bool) {
+	ws.mut.Lock()
+	var due []FileWithContent
+	for fileID, d := range ws.dirty {
+		if !now.Before(d.deadline(h.flushIdle, h.flushInterval)) {
+			due = append(due, ws.files[fileID])
+			delete(ws.dirty, fileID)
+		}
+	}
+	ws.pendingWrites.Add(len(due))
+	ws.mut.Unlock()
+
+	var failed []int64
+	for _, file := range due {
+		if err := ws.save(file); err != nil {
+			log.Printf("error while saving file %d, %v", file.ID, err)
+			failed = append(failed, file.ID)
+		}
+		ws.pendingWrites.Done()
+	}
+
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	for _, fileID := range failed {
+		_, loaded := ws.files[fileID]
+		if _, dirty := ws.dirty[fileID]; loaded && !dirty {
+			ws.markDirty(fileID, now)
+		}
+	}
+
+	var next time.Time
+	for _, d := range ws.dirty {
+		if deadline := d.deadline(h.flushIdle, h.flushInterval); next.IsZero() || deadline.Before(next) {
+			next = deadline
+		}
+	}
+	if next.IsZero() {
+		return 0, false
+	}
+
+	return max(time.Until(next), 0), true
+}
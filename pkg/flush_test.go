@@ -0,0 +1,139 @@
+package rtsync
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlush(t *testing.T) {
+	edit := func(ws *workspaceHub, content string) {
+		ws.mut.Lock()
+		defer ws.mut.Unlock()
+
+		ws.store(FileWithContent{File: repository.File{ID: 1, WorkspaceID: ws.id}, Content: content})
+		ws.markDirty(1, time.Now())
+	}
+
+	newTestHub := func(t *testing.T, idle, interval time.Duration, save func(FileWithContent) error) *workspaceHub {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		return newHub(ctx, -1, idle, interval, save).workspace(1)
+	}
+
+	t.Run("should save once idle", func(t *testing.T) {
+		saved := make(chan string, 10)
+		ws := newTestHub(t, 50*time.Millisecond, time.Hour, func(file FileWithContent) error {
+			saved <- file.Content
+			return nil
+		})
+
+		for _, content := range []string{"a", "ab", "abc"} {
+			edit(ws, content)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		select {
+		case content := <-saved:
+			assert.Equal(t, "abc", content)
+		case <-time.After(time.Second):
+			t.Fatal("file not saved")
+		}
+
+		select {
+		case content := <-saved:
+			t.Fatalf("saved twice, %q", content)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		ws.mut.Lock()
+		assert.Empty(t, ws.dirty)
+		ws.mut.Unlock()
+	})
+
+	t.Run("should save every interval while edited", func(t *testing.T) {
+		saved := make(chan string, 10)
+		ws := newTestHub(t, time.Hour, 50*time.Millisecond, func(file FileWithContent) error {
+			saved <- file.Content
+			return nil
+		})
+
+		edit(ws, "a")
+		start := time.Now()
+		for time.Since(start) < 300*time.Millisecond {
+			edit(ws, "b")
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		assert.GreaterOrEqual(t, len(saved), 2)
+	})
+
+	t.Run("should retry a file which can't be saved", func(t *testing.T) {
+		var attempts atomic.Int64
+		saved := make(chan string, 10)
+		ws := newTestHub(t, 20*time.Millisecond, time.Hour, func(file FileWithContent) error {
+			if attempts.Add(1) == 1 {
+				return errors.New("storage unavailable")
+			}
+			saved <- file.Content
+			return nil
+		})
+
+		edit(ws, "content")
+
+		select {
+		case content := <-saved:
+			assert.Equal(t, "content", content)
+			assert.Equal(t, int64(2), attempts.Load())
+		case <-time.After(time.Second):
+			t.Fatal("file not saved")
+		}
+	})
+
+	t.Run("should save only the evicted files", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		var saved []int64
+		ws := newHub(ctx, 1, time.Hour, time.Hour, func(file FileWithContent) error {
+			saved = append(saved, file.ID)
+			return nil
+		}).workspace(1)
+
+		ws.mut.Lock()
+		defer ws.mut.Unlock()
+
+		for _, fileID := range []int64{1, 2} {
+			ws.store(FileWithContent{File: repository.File{ID: fileID, WorkspaceID: ws.id}, Content: "edited"})
+			ws.markDirty(fileID, time.Now())
+		}
+		ws.evict()
+
+		assert.Equal(t, []int64{1}, saved)
+		assert.NotContains(t, ws.files, int64(1))
+		assert.Contains(t, ws.dirty, int64(2))
+	})
+
+	t.Run("should drop the edits of a forgotten file", func(t *testing.T) {
+		ws := newTestHub(t, time.Hour, time.Hour, func(file FileWithContent) error {
+			t.Fatal("forgotten file saved")
+			return nil
+		})
+
+		edit(ws, "content")
+
+		ws.mut.Lock()
+		ws.forget(1)
+		ws.flush()
+		ws.mut.Unlock()
+
+		require.Empty(t, ws.dirty)
+	})
+}
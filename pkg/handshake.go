@@ -0,0 +1,90 @@
+package rtsync
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/coder/websocket"
+)
+
+// Versions of the sync protocol supported by the server
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// StatusIncompatibleProtocol closes the connections of the clients whose
+// version or capabilities aren't supported
+const StatusIncompatibleProtocol websocket.StatusCode = 4001
+
+// Values of the capabilities
+const (
+	EncodingJSON       = "json"
+	EncodingMsgPack    = "msgpack"
+	OffsetUnitByte     = "byte"
+	CompressionDeflate = "permessage-deflate"
+)
+
+const (
+	ErrHelloNotFirst      = "hello must be the first message"
+	ErrPresenceNotEnabled = "presence not negotiated"
+)
+
+// Capabilities are the features a client supports, in order of preference.
+// The encoding and the compression are chosen when the connection is
+// upgraded, by subprotocol and extension, so the client lists the ones it
+// can handle. Empty lists accept the defaults.
+type Capabilities struct {
+	Encodings   []string `json:"encodings"`
+	OffsetUnits []string `json:"offsetUnits"`
+	Compression []string `json:"compression"`
+	Presence    bool     `json:"presence"`
+}
+
+// HelloMessage is the first message of a client, announcing its protocol
+// version and capabilities. The server replies with its versions and the
+// accepted capabilities, or closes the connection with
+// StatusIncompatibleProtocol. Clients not sending it are handled as clients
+// of the first version.
+type HelloMessage struct {
+	WsMessageHeader
+	Version      int          `json:"version"`
+	MinVersion   int          `json:"minVersion,omitempty"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// negotiate returns the reply to the hello of the client, or why the client
+// is incompatible
+func (s *subscriber) negotiate(hello HelloMessage) (HelloMessage, error) {
+	if hello.Version < MinProtocolVersion || hello.Version > ProtocolVersion {
+		return HelloMessage{}, fmt.Errorf("unsupported protocol version %d, supported %d-%d",
+			hello.Version, MinProtocolVersion, ProtocolVersion)
+	}
+
+	requested := hello.Capabilities
+	if len(requested.Encodings) > 0 && !slices.Contains(requested.Encodings, s.codec.encoding()) {
+		return HelloMessage{}, fmt.Errorf("unsupported encodings, the connection uses %s", s.codec.encoding())
+	}
+	if len(requested.OffsetUnits) > 0 && !slices.Contains(requested.OffsetUnits, OffsetUnitByte) {
+		return HelloMessage{}, fmt.Errorf("unsupported offset units, supported %s", OffsetUnitByte)
+	}
+
+	accepted := Capabilities{
+		Encodings:   []string{s.codec.encoding()},
+		OffsetUnits: []string{OffsetUnitByte},
+		Compression: []string{},
+		Presence:    requested.Presence,
+	}
+	if s.compressed && slices.Contains(requested.Compression, CompressionDeflate) {
+		accepted.Compression = append(accepted.Compression, CompressionDeflate)
+	}
+
+	s.presence = accepted.Presence
+
+	return HelloMessage{
+		WsMessageHeader: WsMessageHeader{Type: HelloEventType},
+		Version:         ProtocolVersion,
+		MinVersion:      MinProtocolVersion,
+		Capabilities:    accepted,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package rtsync
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_handshake(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	mockFileStorage := new(filestorage.MockFileStorage)
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	dial := func(compression websocket.CompressionMode) *websocket.Conn {
+		opts := dialOptions(options.JWTSecret, 1, middleware.RoleEditor)
+		opts.CompressionMode = compression
+		//nolint:bodyclose
+		conn, _, err := websocket.Dial(ctx, url, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+		return conn
+	}
+	hello := func(version int, capabilities Capabilities) HelloMessage {
+		return HelloMessage{
+			WsMessageHeader: WsMessageHeader{Type: HelloEventType},
+			Version:         version,
+			Capabilities:    capabilities,
+		}
+	}
+
+	t.Run("should reply with the accepted capabilities", func(t *testing.T) {
+		conn := dial(websocket.CompressionNoContextTakeover)
+		require.NoError(t, wsjson.Write(ctx, conn, hello(1, Capabilities{
+			Encodings:   []string{EncodingMsgPack, EncodingJSON},
+			OffsetUnits: []string{"utf16", OffsetUnitByte},
+			Compression: []string{CompressionDeflate},
+			Presence:    true,
+		})))
+
+		var reply HelloMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &reply))
+		expected := hello(ProtocolVersion, Capabilities{
+			Encodings:   []string{EncodingJSON},
+			OffsetUnits: []string{OffsetUnitByte},
+			Compression: []string{CompressionDeflate},
+			Presence:    true,
+		})
+		expected.MinVersion = MinProtocolVersion
+		assert.Equal(t, expected, reply)
+
+		// a second hello is refused
+		require.NoError(t, wsjson.Write(ctx, conn, hello(1, Capabilities{})))
+		var errMsg ErrorMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &errMsg))
+		assert.Equal(t, ErrHelloNotFirst, errMsg.Error)
+	})
+
+	t.Run("should disable the capabilities not asked for", func(t *testing.T) {
+		conn := dial(websocket.CompressionDisabled)
+		require.NoError(t, wsjson.Write(ctx, conn, hello(1, Capabilities{
+			Compression: []string{CompressionDeflate},
+		})))
+
+		var reply HelloMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &reply))
+		assert.Equal(t, Capabilities{
+			Encodings:   []string{EncodingJSON},
+			OffsetUnits: []string{OffsetUnitByte},
+			Compression: []string{},
+		}, reply.Capabilities)
+
+		require.NoError(t, wsjson.Write(ctx, conn, PresenceMessage{
+			WsMessageHeader: WsMessageHeader{Type: PresenceEventType},
+		}))
+		var errMsg ErrorMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &errMsg))
+		assert.Equal(t, ErrPresenceNotEnabled, errMsg.Error)
+	})
+
+	t.Run("should close incompatible clients", func(t *testing.T) {
+		for name, msg := range map[string]HelloMessage{
+			"version":     hello(ProtocolVersion+1, Capabilities{}),
+			"encoding":    hello(1, Capabilities{Encodings: []string{EncodingMsgPack}}),
+			"offset unit": hello(1, Capabilities{OffsetUnits: []string{"utf16"}}),
+		} {
+			conn := dial(websocket.CompressionDisabled)
+			require.NoError(t, wsjson.Write(ctx, conn, msg), name)
+
+			var reply HelloMessage
+			err := wsjson.Read(ctx, conn, &reply)
+			assert.Equal(t, StatusIncompatibleProtocol, websocket.CloseStatus(err), name)
+		}
+	})
+}
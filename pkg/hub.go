@@ -0,0 +1,147 @@
+package rtsync
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// workspaceHub owns the state of a workspace: the files being edited and the
+// subscribers with their presence and subscriptions. The edits of a
+// workspace are serialized by mut, the ones of different workspaces run in
+// parallel, and its goroutine writes the edited files behind.
+//
+// The locks are taken in the order hub.mu, mut, subscribersMu. A hub must
+// never be looked up holding mut, or hub.pause would deadlock.
+type workspaceHub struct {
+	id int64
+
+	mut   sync.Mutex
+	files map[int64]FileWithContent
+	cache fileCache
+	// dirty are the files edited since they were last saved
+	dirty   map[int64]dirtyFile
+	dirtied chan struct{}
+	save    func(FileWithContent) error
+	// pendingWrites are the files being saved without holding mut
+	pendingWrites sync.WaitGroup
+
+	subscribersMu sync.Mutex
+	subscribers   map[*subscriber]struct{}
+	presences     map[string]PresenceMessage
+	subscriptions subscriptionIndex
+}
+
+// hub shards the sync server by workspace, the hub of a workspace is created
+// the first time it's needed and lives as long as the server
+type hub struct {
+	ctx        context.Context
+	mu         sync.RWMutex
+	workspaces map[int64]*workspaceHub
+	save       func(FileWithContent) error
+	// maxFiles is the number of files of a workspace kept in memory
+	maxFiles int
+	// flushIdle and flushInterval are how long after the last edit, and
+	// at most after the first one, an edited file is saved
+	flushIdle     time.Duration
+	flushInterval time.Duration
+}
+
+func newHub(ctx context.Context, maxFiles int, flushIdle, flushInterval time.Duration, save func(FileWithContent) error) *hub {
+	return &hub{
+		ctx:           ctx,
+		workspaces:    make(map[int64]*workspaceHub),
+		save:          save,
+		maxFiles:      maxFiles,
+		flushIdle:     flushIdle,
+		flushInterval: flushInterval,
+	}
+}
+
+// workspace returns the hub of the workspace
+func (h *hub) workspace(workspaceID int64) *workspaceHub {
+	h.mu.RLock()
+	ws, ok := h.workspaces[workspaceID]
+	h.mu.RUnlock()
+	if ok {
+		return ws
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ws, ok := h.workspaces[workspaceID]; ok {
+		return ws
+	}
+
+	ws = &workspaceHub{
+		id:            workspaceID,
+		files:         make(map[int64]FileWithContent),
+		cache:         newFileCache(h.maxFiles),
+		dirty:         make(map[int64]dirtyFile),
+		dirtied:       make(chan struct{}, 1),
+		save:          h.save,
+		subscribers:   make(map[*subscriber]struct{}),
+		presences:     make(map[string]PresenceMessage),
+		subscriptions: newSubscriptionIndex(),
+	}
+	h.workspaces[workspaceID] = ws
+	go h.flushLoop(ws)
+
+	return ws
+}
+
+// all returns the hubs of every workspace, sorted by id
+func (h *hub) all() []*workspaceHub {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.sorted()
+}
+
+// sorted returns the hubs sorted by id, h.mu must be held
+func (h *hub) sorted() []*workspaceHub {
+	workspaces := make([]*workspaceHub, 0, len(h.workspaces))
+	for _, ws := range h.workspaces {
+		workspaces = append(workspaces, ws)
+	}
+	slices.SortFunc(workspaces, func(a, b *workspaceHub) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	return workspaces
+}
+
+// pause stops the edits of every workspace and saves the edited files, until
+// the returned function is called. No hub can be created
+// meanwhile.
+func (h *hub) pause() func() {
+	h.mu.Lock()
+
+	workspaces := h.sorted()
+	for _, ws := range workspaces {
+		ws.mut.Lock()
+		ws.flush()
+	}
+
+	return func() {
+		for _, ws := range workspaces {
+			ws.mut.Unlock()
+		}
+		h.mu.Unlock()
+	}
+}
+
+// file returns the file in memory and the hub of its workspace, the hubs
+// must be paused
+func (h *hub) file(fileID int64) (FileWithContent, *workspaceHub, bool) {
+	for _, ws := range h.workspaces {
+		if file, ok := ws.files[fileID]; ok {
+			return file, ws, true
+		}
+	}
+
+	return FileWithContent{}, nil, false
+}
@@ -0,0 +1,146 @@
+package rtsync
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	saved := make(chan FileWithContent, 1)
+	release := make(chan struct{})
+	h := newHub(ctx, -1, time.Hour, time.Hour, func(file FileWithContent) error {
+		<-release
+		saved <- file
+		return nil
+	})
+
+	t.Run("should create a hub per workspace", func(t *testing.T) {
+		ws := h.workspace(1)
+		assert.Same(t, ws, h.workspace(1))
+		assert.NotSame(t, ws, h.workspace(2))
+		assert.Equal(t, []*workspaceHub{ws, h.workspace(2)}, h.all())
+	})
+
+	t.Run("should save the edited files when paused", func(t *testing.T) {
+		ws := h.workspace(1)
+		ws.mut.Lock()
+		ws.files[1] = FileWithContent{File: repository.File{ID: 1, WorkspaceID: 1}, Content: "content"}
+		ws.markDirty(1, time.Now())
+		ws.mut.Unlock()
+
+		paused := make(chan func())
+		go func() { paused <- h.pause() }()
+
+		select {
+		case <-paused:
+			t.Fatal("paused before the files were saved")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		assert.Equal(t, "content", (<-saved).Content)
+		resume := <-paused
+		assert.Empty(t, ws.dirty)
+
+		file, fileWs, ok := h.file(1)
+		require.True(t, ok)
+		assert.Same(t, ws, fileWs)
+		assert.Equal(t, "content", file.Content)
+
+		_, _, ok = h.file(2)
+		assert.False(t, ok)
+
+		// the edits are stopped until resumed
+		assert.False(t, ws.mut.TryLock())
+		resume()
+		require.True(t, ws.mut.TryLock())
+		ws.mut.Unlock()
+	})
+}
+
+// BenchmarkApplyChunks edits a file per goroutine, with every file in the
+// same workspace or, sharded, a workspace per goroutine. The edits of a
+// workspace are serialized, run it with -cpu=1,2,4,8 to see the throughput
+// of the sharded edits grow with the cores.
+func BenchmarkApplyChunks(b *testing.B) {
+	for _, sharded := range []bool{false, true} {
+		b.Run(fmt.Sprintf("sharded=%v", sharded), func(b *testing.B) {
+			procs := runtime.GOMAXPROCS(0)
+			workspaces := 1
+			if sharded {
+				workspaces = procs
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			b.Cleanup(cancel)
+
+			rts := &realTimeSyncServer{
+				ctx:             ctx,
+				hub:             newHub(ctx, -1, time.Hour, time.Hour, func(FileWithContent) error { return nil }),
+				slowGracePeriod: -1,
+			}
+
+			content := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 20)
+			for i := 1; i <= procs; i++ {
+				fileID, workspaceID := int64(i), int64((i-1)%workspaces+1)
+				ws := rts.hub.workspace(workspaceID)
+				ws.files[fileID] = FileWithContent{
+					File:    repository.File{ID: fileID, WorkspaceID: workspaceID},
+					Content: content,
+				}
+				for range 2 {
+					s := &subscriber{
+						clientId:    fmt.Sprintf("client-%d-%d", workspaceID, len(ws.subscribers)),
+						workspaceID: workspaceID,
+						outbox:      newChunkOutbox(),
+					}
+					ws.subscribers[s] = struct{}{}
+				}
+			}
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				fileID := (next.Add(1)-1)%int64(procs) + 1
+				workspaceID := (fileID-1)%int64(workspaces) + 1
+
+				insert := diff.DiffChunk{Type: diff.DiffAdd, Position: 10, Text: "#", Len: 1}
+				remove := diff.DiffChunk{Type: diff.DiffRemove, Position: 10, Text: "#", Len: 1}
+				for i := 0; pb.Next(); i++ {
+					chunk := insert
+					if i%2 == 1 {
+						chunk = remove
+					}
+
+					err := rts.onChunkMessage(ChunkMessage{
+						WsMessageHeader: WsMessageHeader{
+							FileId:      fileID,
+							WorkspaceId: workspaceID,
+							SenderRole:  middleware.RoleEditor,
+							Type:        ChunkEventType,
+						},
+						Chunks: []diff.DiffChunk{chunk},
+					})
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package rtsync
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+const (
+	// maxImportSize is the maximum size of an uploaded archive
+	maxImportSize = 512 << 20
+	// maxImportContentSize is the maximum size of the files of an archive
+	// once decompressed, they're held in memory until imported
+	maxImportContentSize = 512 << 20
+)
+
+const (
+	ErrInvalidImportFormat = "invalid import format, use zip, tar or tar.gz"
+	ErrInvalidArchive      = "invalid archive"
+	ErrImport              = "impossible to import the files"
+)
+
+// importHandler creates the files of the uploaded archive, sent as body, in
+// the workspace. Connected clients get a single ImportEventType event.
+func (rts *realTimeSyncServer) importHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.ExportZip
+	}
+
+	// the upload can take longer than the read timeout of the server
+	err := http.NewResponseController(w).SetReadDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("error while clearing the read deadline, %v", err)
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	entries, err := service.ReadArchive(body, format, maxImportContentSize)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, service.ErrInvalidFormat):
+			http.Error(w, ErrInvalidImportFormat, http.StatusBadRequest)
+		case errors.As(err, &maxBytesErr), errors.Is(err, service.ErrArchiveTooLarge):
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, ErrInvalidArchive, http.StatusBadRequest)
+		}
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	// the writes are stopped while the storage is checked or backed up, the
+	// objects are created before the files referring to them
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	report, err := rts.fileService.Import(r.Context(), workspaceID, entries)
+	if errors.Is(err, service.ErrInvalidPath) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("import in workspace %d failed: %v", workspaceID, err)
+		http.Error(w, ErrImport, http.StatusInternalServerError)
+		return
+	}
+
+	if report.Created > 0 {
+		rts.broadcastEventMessage(ws, EventMessage{
+			WsMessageHeader: WsMessageHeader{
+				WorkspaceId: workspaceID,
+				Type:        ImportEventType,
+			},
+			Import: &ImportSummary{
+				Created:   report.Created,
+				Skipped:   report.Skipped,
+				Conflicts: report.Conflicts,
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,158 @@
+package rtsync
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_importHandler(t *testing.T) {
+	db := testutils.CreateDB(t)
+	options := Options{JWTSecret: []byte("secret")}
+	disk := filestorage.NewDisk(t.TempDir())
+	server := New(db, disk, options)
+	ts := httptest.NewServer(server)
+
+	t.Cleanup(func() {
+		ts.Close()
+		server.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	//nolint:bodyclose
+	receiver, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleViewer))
+	require.NoError(t, err)
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for path, content := range map[string]string{"a.md": "a", "dir/b.md": "b"} {
+		w, err := zw.Create(path)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	upload := func(role middleware.Role, format string, body []byte) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+PathHttpApi+"/import?format="+format, bytes.NewReader(body))
+		require.NoError(t, err)
+		require.NoError(t, testutils.WithRoleAuthHeader(options.JWTSecret, 1, role)(req))
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	res := upload(middleware.RoleViewer, service.ExportZip, archive.Bytes())
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = upload(middleware.RoleEditor, service.ExportZip, []byte("not a zip"))
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = upload(middleware.RoleEditor, service.ExportZip, archive.Bytes())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var report service.ImportReport
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, 2, report.Created)
+
+	var event EventMessage
+	require.NoError(t, wsjson.Read(ctx, receiver, &event))
+	assert.Equal(t, ImportEventType, event.Type)
+	assert.Equal(t, &ImportSummary{Created: 2}, event.Import)
+
+	// the same archive again creates nothing
+	res = upload(middleware.RoleEditor, service.ExportZip, archive.Bytes())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, 0, report.Created)
+	assert.Equal(t, 2, report.Skipped)
+
+	// a plain tar
+	var tarArchive bytes.Buffer
+	tw := tar.NewWriter(&tarArchive)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "c.md", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("c"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	res = upload(middleware.RoleEditor, service.ImportTar, tarArchive.Bytes())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, 1, report.Created)
+
+	// a zip bomb
+	var bomb bytes.Buffer
+	zw = zip.NewWriter(&bomb)
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "bomb.md", Method: zip.Store, UncompressedSize64: 1 << 40, CompressedSize64: 1})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("b"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	res = upload(middleware.RoleEditor, service.ExportZip, bomb.Bytes())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	// nothing is written while the storage is checked or backed up
+	objects, err := disk.ListObjects()
+	require.NoError(t, err)
+
+	var paused bytes.Buffer
+	zw = zip.NewWriter(&paused)
+	w, err = zw.Create("paused.md")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("paused"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+PathHttpApi+"/import?format="+service.ExportZip, &paused)
+	require.NoError(t, err)
+	require.NoError(t, testutils.WithAuthHeader(options.JWTSecret, 1)(req))
+
+	resume := server.hub.pause()
+	done := make(chan int, 1)
+	go func() {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		res.Body.Close()
+		done <- res.StatusCode
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	pausedObjects, err := disk.ListObjects()
+	require.NoError(t, err)
+	assert.Len(t, pausedObjects, len(objects))
+	resume()
+
+	select {
+	case code := <-done:
+		assert.Equal(t, http.StatusOK, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("import not resumed")
+	}
+}
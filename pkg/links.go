@@ -0,0 +1,43 @@
+package rtsync
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+)
+
+func (rts *realTimeSyncServer) fileLinksHandler(w http.ResponseWriter, r *http.Request) {
+	fileId, err := strconv.Atoi(r.PathValue("id"))
+
+	if fileId == 0 || err != nil {
+		http.Error(w, "invalid file id", http.StatusBadRequest)
+		return
+	}
+
+	file, err := rts.db.FetchFile(r.Context(), int64(fileId))
+	if err != nil {
+		http.Error(w, ErrNotExistingFile, http.StatusNotFound)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+	if file.WorkspaceID != workspaceID {
+		http.Error(w, ErrNotExistingFile, http.StatusNotFound)
+		return
+	}
+
+	links, err := rts.links.Links(r.Context(), file)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(links); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
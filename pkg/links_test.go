@@ -0,0 +1,171 @@
+package rtsync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_fileLinksHandler(t *testing.T) {
+	db := testutils.CreateDB(t)
+	disk := filestorage.NewDisk(t.TempDir())
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, disk, options)
+	ts := httptest.NewServer(server)
+
+	t.Cleanup(func() {
+		ts.Close()
+		server.Close()
+	})
+
+	createFile := func(path, content string) repository.File {
+		res, file := testutils.DoRequest[repository.File](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/file",
+			CreateFileBody{Path: path, Content: []byte(content)},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusCreated, res.Code)
+		return file
+	}
+
+	note := createFile("Note.md", "# Note")
+	ref := createFile("Ref.md", "see [[Note]] and [[Missing]]")
+
+	t.Run("should return the links of the file", func(t *testing.T) {
+		res, links := testutils.DoRequest[service.FileLinks](
+			t,
+			server,
+			http.MethodGet,
+			fmt.Sprintf("%s/file/%d/links", PathHttpApi, note.ID),
+			nil,
+			testutils.WithRoleAuthHeader(options.JWTSecret, 1, middleware.RoleViewer),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, links.Outgoing)
+		assert.Equal(t, []service.Link{{Target: "Note", FileID: ref.ID, WorkspacePath: "Ref.md"}}, links.Backlinks)
+
+		res, links = testutils.DoRequest[service.FileLinks](
+			t,
+			server,
+			http.MethodGet,
+			fmt.Sprintf("%s/file/%d/links", PathHttpApi, ref.ID),
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, []service.Link{{Target: "Note", FileID: note.ID, WorkspacePath: "Note.md"}}, links.Outgoing)
+		assert.Equal(t, []service.Link{{Target: "Missing"}}, links.Unresolved)
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			fmt.Sprintf("%s/file/%d/links", PathHttpApi, ref.ID),
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, 2),
+		)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+
+	t.Run("should rewrite the links on rename", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+		//nolint:bodyclose
+		receiver, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleViewer))
+		require.NoError(t, err)
+
+		// wait for the subscriber to be registered
+		require.Eventually(t, func() bool {
+			ws := server.hub.workspace(1)
+			ws.subscribersMu.Lock()
+			defer ws.subscribersMu.Unlock()
+			return len(ws.subscribers) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			fmt.Sprintf("%s/file/%d", PathHttpApi, note.ID),
+			UpdateFileBody{Path: "archive/Renamed.md"},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		var msg ChunkMessage
+		require.NoError(t, wsjson.Read(ctx, receiver, &msg))
+		assert.Equal(t, ref.ID, msg.FileId)
+
+		content := "see [[Note]] and [[Missing]]"
+		for _, chunk := range msg.Chunks {
+			content = diff.ApplyDiff(content, chunk)
+		}
+		assert.Equal(t, "see [[Renamed]] and [[Missing]]", content)
+
+		server.hub.pause()()
+		stored, err := disk.ReadObject(ref.DiskPath)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(stored))
+
+		res, links := testutils.DoRequest[service.FileLinks](
+			t,
+			server,
+			http.MethodGet,
+			fmt.Sprintf("%s/file/%d/links", PathHttpApi, note.ID),
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Len(t, links.Backlinks, 1)
+	})
+
+	t.Run("should rewrite the links not saved yet", func(t *testing.T) {
+		other := createFile("Other.md", "")
+
+		ws := server.hub.workspace(1)
+		ws.mut.Lock()
+		err := server.applyChunks(ws, ChunkMessage{
+			WsMessageHeader: WsMessageHeader{WorkspaceId: 1, FileId: other.ID, Type: ChunkEventType},
+			Chunks:          []diff.DiffChunk{{Type: diff.DiffAdd, Position: 0, Text: "[[Renamed]]", Len: 11}},
+		})
+		ws.mut.Unlock()
+		require.NoError(t, err)
+
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			fmt.Sprintf("%s/file/%d", PathHttpApi, note.ID),
+			UpdateFileBody{Path: "Again.md"},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		server.hub.pause()()
+		stored, err := disk.ReadObject(other.DiskPath)
+		require.NoError(t, err)
+		assert.Equal(t, "[[Again]]", string(stored))
+	})
+}
@@ -0,0 +1,190 @@
+package rtsync
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// loginMaxFailures is the number of consecutive failures allowed before
+	// locking a key out
+	loginMaxFailures = 5
+	// loginLockout is the first lockout, doubled on each further failure
+	loginLockout    = 30 * time.Second
+	loginMaxLockout = 15 * time.Minute
+	// loginFailuresTTL is after how long without failures a key is forgotten
+	loginFailuresTTL = time.Hour
+	// loginReportInterval is how often a refused attempt is reported for
+	// the same key
+	loginReportInterval = time.Minute
+	// loginPruneInterval is how often the forgotten keys are dropped
+	loginPruneInterval = time.Minute
+)
+
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard throttles the login attempts. Each IP is locked out of a
+// workspace for an exponentially increasing time after too many consecutive
+// failures, and IPs are also rate limited regardless of the outcome of the
+// attempts. The lockout never applies to the other IPs, or anyone could lock
+// the users out of a workspace. The failures on a workspace from any IP are
+// rate limited too, so that spreading the attempts over many IPs doesn't
+// help; the workspace is only throttled, never locked.
+type loginGuard struct {
+	mu         sync.Mutex
+	now        func() time.Time
+	failures   map[string]*loginFailures
+	limiters   map[string]*rate.Limiter
+	workspaces map[string]*rate.Limiter
+	reported   map[string]time.Time
+	lastPrune  time.Time
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{
+		now:        time.Now,
+		failures:   make(map[string]*loginFailures),
+		limiters:   make(map[string]*rate.Limiter),
+		workspaces: make(map[string]*rate.Limiter),
+		reported:   make(map[string]time.Time),
+	}
+}
+
+func loginKey(ip, workspace string) string {
+	return ip + "|" + workspace
+}
+
+// Allow reports whether an attempt from ip on the workspace can be made,
+// otherwise it returns after how long the attempt can be retried and whether
+// the refusal should be reported, at most once a minute for the same key
+func (g *loginGuard) Allow(ip, workspace string) (time.Duration, bool, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.prune(now)
+
+	key := loginKey(ip, workspace)
+	if f, ok := g.failures[key]; ok && now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now), false, g.report(key, now)
+	}
+
+	// the failures take the tokens of the workspace, the attempt only
+	// needs one to be left
+	if limiter, ok := g.workspaces[workspace]; ok {
+		reservation := limiter.ReserveN(now, 1)
+		delay := reservation.DelayFrom(now)
+		reservation.CancelAt(now)
+		if delay > 0 {
+			return delay, false, g.report(loginKey("*", workspace), now)
+		}
+	}
+
+	limiter, ok := g.limiters[ip]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(3*time.Second), 20)
+		g.limiters[ip] = limiter
+	}
+
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false, g.report(ip, now)
+	}
+
+	return 0, true, false
+}
+
+// Fail records a failed attempt from ip on the workspace
+func (g *loginGuard) Fail(ip, workspace string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.prune(now)
+
+	key := loginKey(ip, workspace)
+	f, ok := g.failures[key]
+	if !ok {
+		f = &loginFailures{}
+		g.failures[key] = f
+	}
+
+	g.workspaceLimiter(workspace).AllowN(now, 1)
+
+	f.count++
+	f.lastFailure = now
+	if f.count >= loginMaxFailures {
+		lockout := loginLockout << min(f.count-loginMaxFailures, 16)
+		f.lockedUntil = now.Add(min(lockout, loginMaxLockout))
+	}
+}
+
+// Succeed resets the failures of ip on the workspace
+func (g *loginGuard) Succeed(ip, workspace string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.failures, loginKey(ip, workspace))
+}
+
+// workspaceLimiter returns the limiter of the failures on the workspace, it
+// must be called holding mu
+func (g *loginGuard) workspaceLimiter(workspace string) *rate.Limiter {
+	limiter, ok := g.workspaces[workspace]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(2*time.Second), 30)
+		g.workspaces[workspace] = limiter
+	}
+	return limiter
+}
+
+// report reports whether a refusal for the key wasn't reported recently, it
+// must be called holding mu
+func (g *loginGuard) report(key string, now time.Time) bool {
+	if last, ok := g.reported[key]; ok && now.Sub(last) < loginReportInterval {
+		return false
+	}
+
+	g.reported[key] = now
+	return true
+}
+
+// prune forgets the keys without recent failures, at most once a minute. It
+// must be called holding mu.
+func (g *loginGuard) prune(now time.Time) {
+	if now.Sub(g.lastPrune) < loginPruneInterval {
+		return
+	}
+	g.lastPrune = now
+
+	for key, f := range g.failures {
+		if now.Sub(f.lastFailure) > loginFailuresTTL && now.After(f.lockedUntil) {
+			delete(g.failures, key)
+		}
+	}
+
+	for ip, limiter := range g.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(g.limiters, ip)
+		}
+	}
+
+	for workspace, limiter := range g.workspaces {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(g.workspaces, workspace)
+		}
+	}
+
+	for key, last := range g.reported {
+		if now.Sub(last) >= loginReportInterval {
+			delete(g.reported, key)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package rtsync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginGuard(t *testing.T) {
+	now := time.Date(2024, 12, 27, 10, 0, 0, 0, time.UTC)
+	g := newLoginGuard()
+	g.now = func() time.Time { return now }
+
+	t.Run("should lock out progressively", func(t *testing.T) {
+		for range loginMaxFailures {
+			_, ok, _ := g.Allow("10.0.0.1", "workspace1")
+			assert.True(t, ok)
+			g.Fail("10.0.0.1", "workspace1")
+		}
+
+		retryAfter, ok, report := g.Allow("10.0.0.1", "workspace1")
+		assert.False(t, ok)
+		assert.True(t, report)
+		assert.Equal(t, loginLockout, retryAfter)
+
+		// the refusals are reported once a minute
+		_, ok, report = g.Allow("10.0.0.1", "workspace1")
+		assert.False(t, ok)
+		assert.False(t, report)
+
+		// other IPs aren't locked out of the workspace
+		_, ok, _ = g.Allow("10.0.0.2", "workspace1")
+		assert.True(t, ok)
+
+		now = now.Add(loginLockout)
+		_, ok, _ = g.Allow("10.0.0.1", "workspace1")
+		assert.True(t, ok)
+
+		g.Fail("10.0.0.1", "workspace1")
+		retryAfter, ok, _ = g.Allow("10.0.0.1", "workspace1")
+		assert.False(t, ok)
+		assert.Equal(t, 2*loginLockout, retryAfter)
+	})
+
+	t.Run("should reset on success", func(t *testing.T) {
+		g.Succeed("10.0.0.1", "workspace1")
+
+		_, ok, _ := g.Allow("10.0.0.1", "workspace1")
+		assert.True(t, ok)
+	})
+
+	t.Run("should cap the lockout", func(t *testing.T) {
+		for range 20 {
+			g.Fail("10.0.0.3", "workspace2")
+		}
+
+		retryAfter, ok, _ := g.Allow("10.0.0.3", "workspace2")
+		assert.False(t, ok)
+		assert.Equal(t, loginMaxLockout, retryAfter)
+	})
+
+	t.Run("should rate limit IPs", func(t *testing.T) {
+		allowed, reported := 0, 0
+		for range 100 {
+			_, ok, report := g.Allow("10.0.0.4", "workspace3")
+			if ok {
+				allowed++
+			}
+			if report {
+				reported++
+			}
+		}
+		assert.Equal(t, 20, allowed)
+		assert.Equal(t, 1, reported)
+	})
+
+	t.Run("should throttle the failures on a workspace across IPs", func(t *testing.T) {
+		failed := 0
+		for i := range 100 {
+			ip := fmt.Sprintf("10.1.0.%d", i)
+			if _, ok, _ := g.Allow(ip, "workspace5"); !ok {
+				break
+			}
+			g.Fail(ip, "workspace5")
+			failed++
+		}
+		assert.Equal(t, 30, failed)
+
+		retryAfter, ok, report := g.Allow("10.2.0.1", "workspace5")
+		assert.False(t, ok)
+		assert.False(t, report)
+		assert.Positive(t, retryAfter)
+
+		// the other workspaces aren't throttled
+		_, ok, _ = g.Allow("10.2.0.1", "workspace6")
+		assert.True(t, ok)
+
+		// the workspace is throttled, not locked out
+		now = now.Add(retryAfter)
+		_, ok, _ = g.Allow("10.2.0.1", "workspace5")
+		assert.True(t, ok)
+	})
+
+	t.Run("should prune from any attempt", func(t *testing.T) {
+		now = now.Add(loginFailuresTTL + loginMaxLockout)
+		_, ok, _ := g.Allow("10.0.0.5", "workspace4")
+		assert.True(t, ok)
+
+		assert.Empty(t, g.failures)
+		assert.Empty(t, g.reported)
+		assert.Len(t, g.limiters, 1)
+		assert.Empty(t, g.workspaces)
+	})
+}
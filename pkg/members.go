@@ -0,0 +1,172 @@
+package rtsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+type AddMemberBody struct {
+	User string          `json:"user"`
+	Role middleware.Role `json:"role"`
+}
+
+type UpdateMemberBody struct {
+	Role middleware.Role `json:"role"`
+}
+
+const (
+	ErrUserNotFound      = "user not found"
+	ErrInvalidRole       = "invalid role"
+	ErrDuplicateMember   = "user is already a member"
+	ErrNotExistingMember = "not existing member"
+	ErrInvalidMember     = "impossible to update member"
+	ErrLastOwner         = "the workspace must keep an owner"
+)
+
+// memberRoles reads the role of the users from the workspace_members table
+type memberRoles struct {
+	db *repository.Queries
+}
+
+func (mr memberRoles) MemberRole(ctx context.Context, workspaceID, userID int64) (middleware.Role, error) {
+	member, err := mr.db.FetchWorkspaceMember(ctx, repository.FetchWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+	return middleware.Role(member.Role), err
+}
+
+func (rts *realTimeSyncServer) listMembersHandler(w http.ResponseWriter, r *http.Request) {
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	members, err := rts.members.List(r.Context(), workspaceID)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rts *realTimeSyncServer) addMemberHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data AddMemberBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !data.Role.IsValid() {
+		http.Error(w, ErrInvalidRole, http.StatusBadRequest)
+		return
+	}
+
+	user, err := rts.db.FetchUser(r.Context(), data.User)
+	if err != nil {
+		http.Error(w, ErrUserNotFound, http.StatusNotFound)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	if err := rts.members.Add(r.Context(), workspaceID, user.ID, data.Role); err != nil {
+		memberError(w, err)
+		return
+	}
+
+	member := repository.FetchWorkspaceMembersRow{
+		WorkspaceID: workspaceID,
+		UserID:      user.ID,
+		Role:        string(data.Role),
+		Name:        user.Name,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(member); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rts *realTimeSyncServer) updateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(r.PathValue("userId"))
+
+	if userId == 0 || err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data UpdateMemberBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	if err := rts.members.SetRole(r.Context(), workspaceID, int64(userId), data.Role); err != nil {
+		memberError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rts *realTimeSyncServer) deleteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(r.PathValue("userId"))
+
+	if userId == 0 || err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	if err := rts.members.Remove(r.Context(), workspaceID, int64(userId)); err != nil {
+		memberError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// memberError writes the response for an error of the member service
+func memberError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole):
+		http.Error(w, ErrInvalidRole, http.StatusBadRequest)
+	case errors.Is(err, service.ErrDuplicateMember):
+		http.Error(w, ErrDuplicateMember, http.StatusConflict)
+	case errors.Is(err, service.ErrLastOwner):
+		http.Error(w, ErrLastOwner, http.StatusConflict)
+	case errors.Is(err, service.ErrMemberNotFound):
+		http.Error(w, ErrNotExistingMember, http.StatusNotFound)
+	default:
+		http.Error(w, ErrInvalidMember, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,233 @@
+package rtsync
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_membersHandlers(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	workspaceID := int64(10)
+	userID, err := repo.AddUser(context.Background(), repository.AddUserParams{
+		Name:     "alice",
+		Password: "hash",
+	})
+	require.NoError(t, err)
+
+	memberPath := PathHttpApi + "/member/" + strconv.Itoa(int(userID))
+
+	t.Run("only owners can add members", func(t *testing.T) {
+		data := AddMemberBody{User: "alice", Role: middleware.RoleViewer}
+
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/member",
+			data,
+			testutils.WithRoleAuthHeader(options.JWTSecret, workspaceID, middleware.RoleEditor),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, middleware.ErrInsufficientRole, body)
+	})
+
+	t.Run("should add a member", func(t *testing.T) {
+		data := AddMemberBody{User: "alice", Role: middleware.RoleViewer}
+
+		res, body := testutils.DoRequest[repository.FetchWorkspaceMembersRow](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/member",
+			data,
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		assert.Equal(t, repository.FetchWorkspaceMembersRow{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        string(middleware.RoleViewer),
+			Name:        "alice",
+		}, body)
+
+		// duplicate
+		res, errBody := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/member",
+			data,
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Equal(t, ErrDuplicateMember, errBody)
+	})
+
+	t.Run("should not add unknown users or roles", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/member",
+			AddMemberBody{User: "bob", Role: middleware.RoleViewer},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.Equal(t, ErrUserNotFound, body)
+
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/member",
+			AddMemberBody{User: "alice", Role: "admin"},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidRole, body)
+	})
+
+	t.Run("should update the role of a member", func(t *testing.T) {
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			memberPath,
+			UpdateMemberBody{Role: middleware.RoleEditor},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		// members are visible to every role
+		res, body := testutils.DoRequest[[]repository.FetchWorkspaceMembersRow](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/member",
+			nil,
+			testutils.WithRoleAuthHeader(options.JWTSecret, workspaceID, middleware.RoleViewer),
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, []repository.FetchWorkspaceMembersRow{{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        string(middleware.RoleEditor),
+			Name:        "alice",
+		}}, body)
+	})
+
+	t.Run("should keep the last owner", func(t *testing.T) {
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			memberPath,
+			UpdateMemberBody{Role: middleware.RoleOwner},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			memberPath,
+			UpdateMemberBody{Role: middleware.RoleEditor},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Equal(t, ErrLastOwner, body)
+
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			memberPath,
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Equal(t, ErrLastOwner, body)
+
+		// with another owner it can be demoted
+		bobID, err := repo.AddUser(context.Background(), repository.AddUserParams{Name: "bob", Password: "hash"})
+		require.NoError(t, err)
+		require.NoError(t, repo.AddWorkspaceMember(context.Background(), repository.AddWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      bobID,
+			Role:        string(middleware.RoleOwner),
+		}))
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			memberPath,
+			UpdateMemberBody{Role: middleware.RoleEditor},
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+	})
+
+	t.Run("should apply a change of role to the issued tokens", func(t *testing.T) {
+		token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: options.JWTSecret}, middleware.Identity{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        middleware.RoleOwner,
+		})
+		require.NoError(t, err)
+
+		// alice has been demoted to editor
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/member",
+			AddMemberBody{User: "bob", Role: middleware.RoleViewer},
+			testutils.WithToken(token),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, middleware.ErrInsufficientRole, body)
+	})
+
+	t.Run("should delete a member", func(t *testing.T) {
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			memberPath,
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			memberPath,
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, workspaceID),
+		)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.Equal(t, ErrNotExistingMember, body)
+	})
+}
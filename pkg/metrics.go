@@ -0,0 +1,58 @@
+package rtsync
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics are the counters of the sync server since it started
+type Metrics struct {
+	Subscribers int `json:"subscribers"`
+	// BehindSubscribers are the subscribers with messages waiting to be sent
+	BehindSubscribers int `json:"behindSubscribers"`
+	// CoalescedChunks counts the chunk messages merged into a queued one
+	CoalescedChunks int64 `json:"coalescedChunks"`
+	// Snapshots counts the files whose queued chunks were replaced by a
+	// snapshot, because the subscriber was too far behind
+	Snapshots int64 `json:"snapshots"`
+	// SlowDisconnects counts the subscribers disconnected because they
+	// were behind for longer than the grace period
+	SlowDisconnects int64 `json:"slowDisconnects"`
+}
+
+type metrics struct {
+	coalescedChunks atomic.Int64
+	snapshots       atomic.Int64
+	slowDisconnects atomic.Int64
+}
+
+func (rts *realTimeSyncServer) Metrics() Metrics {
+	m := Metrics{
+		CoalescedChunks: rts.metrics.coalescedChunks.Load(),
+		Snapshots:       rts.metrics.snapshots.Load(),
+		SlowDisconnects: rts.metrics.slowDisconnects.Load(),
+	}
+
+	for _, ws := range rts.hub.all() {
+		ws.subscribersMu.Lock()
+		m.Subscribers += len(ws.subscribers)
+		for s := range ws.subscribers {
+			if s.outbox.behind() {
+				m.BehindSubscribers++
+			}
+		}
+		ws.subscribersMu.Unlock()
+	}
+
+	return m
+}
+
+func (rts *realTimeSyncServer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rts.Metrics()); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// IsAdmin authenticates the server administrators with a static token sent
+// as bearer token. All the requests are refused when the token is empty.
+func IsAdmin(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bearer, ok := BearerToken(r)
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				writeUnauthed(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
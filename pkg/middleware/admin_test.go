@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAdmin(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminToken     string
+		authHeader     string
+		expectedStatus int
+	}{
+		{"No Auth Header", "admin-token", "", http.StatusUnauthorized},
+		{"Invalid Token", "admin-token", "Bearer other", http.StatusUnauthorized},
+		{"Valid Token", "admin-token", "Bearer admin-token", http.StatusOK},
+		{"Disabled", "", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+
+			rec := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			IsAdmin(tt.adminToken)(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
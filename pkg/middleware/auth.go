@@ -16,16 +16,77 @@ type authKey string
 
 const (
 	AuthWorkspaceID authKey = "middleware.auth.workspaceID"
+	AuthUserID      authKey = "middleware.auth.userID"
+	AuthRole        authKey = "middleware.auth.role"
+	AuthApiKeyID    authKey = "middleware.auth.apiKeyID"
 
 	Issuer = "obsidian-rt"
 )
 
 type CustomClaims struct {
 	jwt.RegisteredClaims
+	UserID  int64  `json:"uid,omitempty"`
+	Role    Role   `json:"role"`
+	Session string `json:"sid,omitempty"`
+}
+
+// Identity is who a token has been issued to. UserID is 0 when the
+// token was obtained with the workspace password. Session is the login the
+// token belongs to, revoking it revokes all its tokens; it's empty for the
+// tokens minted outside a login. ApiKeyID is set only when authenticated
+// with an API key.
+type Identity struct {
+	WorkspaceID int64
+	UserID      int64
+	Role        Role
+	Session     string
+	ApiKeyID    int64
+}
+
+// RevocationList reports whether the token with the given `jti` claim, or
+// its session, has been revoked before its expiration
+type RevocationList interface {
+	IsRevoked(ctx context.Context, jti, session string) bool
+}
+
+// MemberRoles returns the current role of a user in a workspace, an error if
+// the user isn't a member
+type MemberRoles interface {
+	MemberRole(ctx context.Context, workspaceID, userID int64) (Role, error)
+}
+
+// DeletedWorkspaces reports whether a workspace has been deleted, its tokens
+// are refused even if they haven't expired yet
+type DeletedWorkspaces interface {
+	IsWorkspaceDeleted(ctx context.Context, workspaceID int64) bool
+}
+
+// ApiKeyPrefix distinguishes API keys from JWTs in the Authorization header
+const ApiKeyPrefix = "rts_"
+
+// ApiKeyVerifier returns the identity the API key has been issued to
+type ApiKeyVerifier interface {
+	VerifyApiKey(ctx context.Context, key string) (Identity, error)
 }
 
 type AuthOptions struct {
 	SecretKey []byte
+	// Revocations is optional, when nil no token is considered revoked
+	Revocations RevocationList
+	// ApiKeys is optional, when nil only JWTs are accepted
+	ApiKeys ApiKeyVerifier
+	// Members is optional, when set the role of the users is read from
+	// their membership instead of the token, so that a change of role or a
+	// removal applies at once
+	Members MemberRoles
+	// Workspaces is optional, when set the tokens obtained with the
+	// workspace password are refused once the workspace is deleted. The
+	// tokens of the users are refused by Members, their membership is gone.
+	Workspaces DeletedWorkspaces
+	// QueryToken accepts the token in the `token` query parameter, for the
+	// clients that cannot set headers (e.g. browser websockets). Query
+	// strings end up in logs, so it must be enabled only where needed.
+	QueryToken bool
 }
 
 func writeUnauthed(w http.ResponseWriter) {
@@ -40,29 +101,57 @@ func writeUnauthed(w http.ResponseWriter) {
 func IsAuthenticated(ao AuthOptions) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authorization := r.Header.Get("Authorization")
-
-			if !strings.HasPrefix(authorization, "Bearer ") {
+			encodedToken, ok := BearerToken(r)
+			if !ok && ao.QueryToken {
+				encodedToken = r.URL.Query().Get("token")
+				ok = encodedToken != ""
+			}
+			if !ok {
 				writeUnauthed(w)
 				return
 			}
 
-			encodedToken := strings.TrimPrefix(authorization, "Bearer ")
-			workspaceID, err := VerifyToken(ao, encodedToken)
+			var identity Identity
+			var err error
+			if ao.ApiKeys != nil && strings.HasPrefix(encodedToken, ApiKeyPrefix) {
+				identity, err = ao.ApiKeys.VerifyApiKey(r.Context(), encodedToken)
+			} else {
+				identity, err = VerifyToken(r.Context(), ao, encodedToken)
+				if err == nil && ao.Members != nil && identity.UserID != 0 {
+					identity.Role, err = ao.Members.MemberRole(r.Context(), identity.WorkspaceID, identity.UserID)
+				}
+				if err == nil && ao.Workspaces != nil && identity.UserID == 0 &&
+					ao.Workspaces.IsWorkspaceDeleted(r.Context(), identity.WorkspaceID) {
+					err = fmt.Errorf("deleted workspace")
+				}
+			}
 			if err != nil {
 				writeUnauthed(w)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), AuthWorkspaceID, workspaceID)
-			req := r.WithContext(ctx)
+			req := r.WithContext(WithIdentity(r.Context(), identity))
 
 			next.ServeHTTP(w, req)
 		})
 	}
 }
 
-func CreateToken(ao AuthOptions, workspaceID int64) (string, error) {
+// BearerToken extracts the token from the Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer "), true
+	}
+
+	return "", false
+}
+
+func CreateToken(ao AuthOptions, identity Identity) (string, error) {
+	if !identity.Role.IsValid() {
+		return "", fmt.Errorf("invalid role %q", identity.Role)
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		CustomClaims{
 			RegisteredClaims: jwt.RegisteredClaims{
@@ -70,9 +159,12 @@ func CreateToken(ao AuthOptions, workspaceID int64) (string, error) {
 				IssuedAt:  jwt.NewNumericDate(time.Now()),
 				NotBefore: jwt.NewNumericDate(time.Now()),
 				Issuer:    Issuer,
-				Subject:   strconv.Itoa(int(workspaceID)),
+				Subject:   strconv.Itoa(int(identity.WorkspaceID)),
 				ID:        uuid.New().String(),
 			},
+			UserID:  identity.UserID,
+			Role:    identity.Role,
+			Session: identity.Session,
 		})
 	tokenString, err := token.SignedString(ao.SecretKey)
 	if err != nil {
@@ -82,7 +174,36 @@ func CreateToken(ao AuthOptions, workspaceID int64) (string, error) {
 	return tokenString, nil
 }
 
-func VerifyToken(ao AuthOptions, tokenString string) (int64, error) {
+func VerifyToken(ctx context.Context, ao AuthOptions, tokenString string) (Identity, error) {
+	claims, err := ParseToken(ao, tokenString)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if ao.Revocations != nil && ao.Revocations.IsRevoked(ctx, claims.ID, claims.Session) {
+		return Identity{}, fmt.Errorf("revoked token")
+	}
+
+	sub, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid sub")
+	}
+
+	if !claims.Role.IsValid() {
+		return Identity{}, fmt.Errorf("invalid role")
+	}
+
+	return Identity{
+		WorkspaceID: int64(sub),
+		UserID:      claims.UserID,
+		Role:        claims.Role,
+		Session:     claims.Session,
+	}, nil
+}
+
+// ParseToken validates the signature and the registered claims of the token,
+// it doesn't check the revocation list
+func ParseToken(ao AuthOptions, tokenString string) (*CustomClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&CustomClaims{},
@@ -94,22 +215,41 @@ func VerifyToken(ao AuthOptions, tokenString string) (int64, error) {
 		jwt.WithIssuer(Issuer),
 	)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	claims := token.Claims.(*CustomClaims)
-	sub, err := strconv.Atoi(claims.Subject)
-	if err != nil {
-		return 0, fmt.Errorf("invalid sub")
-	}
+	return token.Claims.(*CustomClaims), nil
+}
 
-	return int64(sub), nil
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	ctx = context.WithValue(ctx, AuthWorkspaceID, identity.WorkspaceID)
+	ctx = context.WithValue(ctx, AuthUserID, identity.UserID)
+	ctx = context.WithValue(ctx, AuthRole, identity.Role)
+	ctx = context.WithValue(ctx, AuthApiKeyID, identity.ApiKeyID)
+	return ctx
 }
 
 func WorkspaceIDFromCtx(ctx context.Context) int64 {
 	return ctx.Value(AuthWorkspaceID).(int64)
 }
+
+func UserIDFromCtx(ctx context.Context) int64 {
+	userID, _ := ctx.Value(AuthUserID).(int64)
+	return userID
+}
+
+// ApiKeyIDFromCtx returns the API key the request is authenticated with, 0
+// for a token
+func ApiKeyIDFromCtx(ctx context.Context) int64 {
+	apiKeyID, _ := ctx.Value(AuthApiKeyID).(int64)
+	return apiKeyID
+}
+
+func RoleFromCtx(ctx context.Context) Role {
+	role, _ := ctx.Value(AuthRole).(Role)
+	return role
+}
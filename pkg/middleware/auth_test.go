@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -14,7 +15,7 @@ func TestIsAuthenticated(t *testing.T) {
 	ao := AuthOptions{SecretKey: []byte("secret-key")}
 
 	createToken := func(workspaceID int64) string {
-		token, err := CreateToken(ao, workspaceID)
+		token, err := CreateToken(ao, Identity{WorkspaceID: workspaceID, Role: RoleEditor})
 		require.NoError(t, err)
 		require.NotEmpty(t, token)
 		return token
@@ -31,6 +32,58 @@ func TestIsAuthenticated(t *testing.T) {
 		{"Valid Token", "Bearer " + createToken(123), http.StatusOK, 123},
 	}
 
+	t.Run("Token In Query", func(t *testing.T) {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, int64(42), WorkspaceIDFromCtx(r.Context()))
+			assert.Equal(t, RoleEditor, RoleFromCtx(r.Context()))
+			w.WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/?token="+createToken(42), http.NoBody)
+		rec := httptest.NewRecorder()
+		IsAuthenticated(ao)(next).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		queryAo := ao
+		queryAo.QueryToken = true
+		rec = httptest.NewRecorder()
+		IsAuthenticated(queryAo)(next).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Role From Membership", func(t *testing.T) {
+		token, err := CreateToken(ao, Identity{WorkspaceID: 1, UserID: 2, Role: RoleOwner})
+		require.NoError(t, err)
+
+		tests := []struct {
+			name           string
+			members        memberRoles
+			expectedStatus int
+		}{
+			{"Demoted", memberRoles{2: RoleViewer}, http.StatusOK},
+			{"Removed", memberRoles{}, http.StatusUnauthorized},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+				req.Header.Set("Authorization", "Bearer "+token)
+				rec := httptest.NewRecorder()
+
+				next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, RoleViewer, RoleFromCtx(r.Context()))
+					w.WriteHeader(http.StatusOK)
+				})
+
+				membersAo := ao
+				membersAo.Members = tt.members
+				IsAuthenticated(membersAo)(next).ServeHTTP(rec, req)
+
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+			})
+		}
+	})
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
@@ -53,6 +106,40 @@ func TestIsAuthenticated(t *testing.T) {
 	}
 }
 
+func TestIsAuthenticatedApiKey(t *testing.T) {
+	ao := AuthOptions{
+		SecretKey: []byte("secret-key"),
+		ApiKeys:   apiKeys{ApiKeyPrefix + "valid": {WorkspaceID: 7, Role: RoleViewer}},
+	}
+
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{"Valid Api Key", ApiKeyPrefix + "valid", http.StatusOK},
+		{"Unknown Api Key", ApiKeyPrefix + "unknown", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rec := httptest.NewRecorder()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, int64(7), WorkspaceIDFromCtx(r.Context()))
+				assert.Equal(t, RoleViewer, RoleFromCtx(r.Context()))
+				w.WriteHeader(http.StatusOK)
+			})
+
+			IsAuthenticated(ao)(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
 func TestWorkspaceIDFromCtx(t *testing.T) {
 	expectedWorkspaceID := int64(10)
 	ctx := context.WithValue(context.Background(), AuthWorkspaceID, int64(10))
@@ -60,3 +147,78 @@ func TestWorkspaceIDFromCtx(t *testing.T) {
 
 	assert.Equal(t, expectedWorkspaceID, workspaceID)
 }
+
+func TestCreateToken(t *testing.T) {
+	ao := AuthOptions{SecretKey: []byte("secret-key")}
+
+	t.Run("should keep the identity", func(t *testing.T) {
+		identity := Identity{WorkspaceID: 1, UserID: 2, Role: RoleViewer, Session: "session"}
+		token, err := CreateToken(ao, identity)
+		require.NoError(t, err)
+
+		got, err := VerifyToken(context.Background(), ao, token)
+		require.NoError(t, err)
+		assert.Equal(t, identity, got)
+	})
+
+	t.Run("should reject revoked tokens", func(t *testing.T) {
+		token, err := CreateToken(ao, Identity{WorkspaceID: 1, Role: RoleOwner})
+		require.NoError(t, err)
+
+		claims, err := ParseToken(ao, token)
+		require.NoError(t, err)
+
+		revoked := ao
+		revoked.Revocations = revokedSet{claims.ID: {}}
+
+		_, err = VerifyToken(context.Background(), revoked, token)
+		assert.Error(t, err)
+
+		_, err = VerifyToken(context.Background(), ao, token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject the tokens of a revoked session", func(t *testing.T) {
+		token, err := CreateToken(ao, Identity{WorkspaceID: 1, Role: RoleOwner, Session: "session"})
+		require.NoError(t, err)
+
+		revoked := ao
+		revoked.Revocations = revokedSet{"session": {}}
+
+		_, err = VerifyToken(context.Background(), revoked, token)
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject unknown roles", func(t *testing.T) {
+		_, err := CreateToken(ao, Identity{WorkspaceID: 1, Role: "admin"})
+		assert.Error(t, err)
+	})
+}
+
+type revokedSet map[string]struct{}
+
+func (rs revokedSet) IsRevoked(_ context.Context, jti, session string) bool {
+	_, jtiRevoked := rs[jti]
+	_, sessionRevoked := rs[session]
+	return jtiRevoked || sessionRevoked
+}
+
+type memberRoles map[int64]Role
+
+func (mr memberRoles) MemberRole(_ context.Context, _, userID int64) (Role, error) {
+	role, ok := mr[userID]
+	if !ok {
+		return "", fmt.Errorf("not a member")
+	}
+	return role, nil
+}
+
+type apiKeys map[string]Identity
+
+func (ak apiKeys) VerifyApiKey(_ context.Context, key string) (Identity, error) {
+	identity, ok := ak[key]
+	if !ok {
+		return Identity{}, fmt.Errorf("invalid api key")
+	}
+	return identity, nil
+}
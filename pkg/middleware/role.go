@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+const ErrInsufficientRole = "insufficient permissions for this workspace"
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// IsValid reports whether r is one of the known roles
+func (r Role) IsValid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r grants at least the permissions of min
+func (r Role) AtLeast(min Role) bool {
+	return r.IsValid() && roleRanks[r] >= roleRanks[min]
+}
+
+// CanWrite reports whether r is allowed to modify files
+func (r Role) CanWrite() bool {
+	return r.AtLeast(RoleEditor)
+}
+
+// RequireRole rejects with 403 the requests whose authenticated role
+// is lower than min. It must run after IsAuthenticated.
+func RequireRole(min Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !RoleFromCtx(r.Context()).AtLeast(min) {
+				http.Error(w, ErrInsufficientRole, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
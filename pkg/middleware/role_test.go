@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	assert.True(t, RoleOwner.AtLeast(RoleEditor))
+	assert.True(t, RoleEditor.AtLeast(RoleEditor))
+	assert.False(t, RoleViewer.AtLeast(RoleEditor))
+	assert.False(t, Role("").AtLeast(RoleViewer))
+
+	assert.True(t, RoleEditor.CanWrite())
+	assert.False(t, RoleViewer.CanWrite())
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           Role
+		expectedStatus int
+	}{
+		{"Owner", RoleOwner, http.StatusOK},
+		{"Editor", RoleEditor, http.StatusOK},
+		{"Viewer", RoleViewer, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithIdentity(context.Background(), Identity{WorkspaceID: 1, Role: tt.role})
+			req := httptest.NewRequest(http.MethodPost, "/", http.NoBody).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			RequireRole(RoleEditor)(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
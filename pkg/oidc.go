@@ -0,0 +1,466 @@
+package rtsync
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"golang.org/x/oauth2"
+)
+
+// OIDCOptions configures the authorization code login against an OpenID
+// Connect provider, it is disabled when Issuer is empty
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must point to PathHttpAuth + "/oidc/callback"
+	RedirectURL string
+}
+
+const (
+	oidcLoginDuration = 10 * time.Minute
+	// oidcMaxPending caps the logins started and not yet completed, the
+	// login guard limits them for each IP
+	oidcMaxPending = 10000
+	// oidcStateCookie binds the login to the browser which started it, so
+	// that a callback with the code of another browser is refused
+	oidcStateCookie = "oidc_state"
+)
+
+const (
+	ErrInvalidOIDCState   = "invalid or expired login state"
+	ErrOIDCLogin          = "identity provider login failed"
+	ErrOIDCUnverifiedMail = "the identity provider didn't return a verified email"
+	ErrOIDCLinkRequired   = "log in with the password and link the identity to the user"
+	ErrOIDCAlreadyLinked  = "the identity is linked to another user"
+)
+
+var (
+	errUnverifiedMail = errors.New(ErrOIDCUnverifiedMail)
+	errLinkRequired   = errors.New(ErrOIDCLinkRequired)
+	errAlreadyLinked  = errors.New(ErrOIDCAlreadyLinked)
+	errTooManyLogins  = errors.New(ErrTooManyAttempts)
+)
+
+// OIDCLinkResponse is the provider page where the logged user links the
+// identity
+type OIDCLinkResponse struct {
+	URL string `json:"url"`
+}
+
+// oidcLogin is a login started and not yet completed. The workspace is
+// looked up only once the user is authenticated, when the login links the
+// identity to a logged user linkUserID and workspaceID are set instead.
+type oidcLogin struct {
+	workspace   string
+	workspaceID int64
+	linkUserID  int64
+	nonce       string
+	verifier    string
+	expiresAt   time.Time
+}
+
+type oidcAuthenticator struct {
+	opts OIDCOptions
+
+	mu       sync.Mutex
+	config   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	pending  map[string]oidcLogin
+}
+
+func newOIDCAuthenticator(opts OIDCOptions) *oidcAuthenticator {
+	return &oidcAuthenticator{
+		opts:    opts,
+		pending: make(map[string]oidcLogin),
+	}
+}
+
+// discover fetches the provider configuration on first use, so that the
+// server can start even when the provider is unreachable
+func (oa *oidcAuthenticator) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+
+	if oa.config != nil {
+		return oa.config, oa.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, oa.opts.Issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oa.config = &oauth2.Config{
+		ClientID:     oa.opts.ClientID,
+		ClientSecret: oa.opts.ClientSecret,
+		RedirectURL:  oa.opts.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+	oa.verifier = provider.Verifier(&oidc.Config{ClientID: oa.opts.ClientID})
+
+	return oa.config, oa.verifier, nil
+}
+
+// start records the login, it returns false when there are too many
+// pending ones
+func (oa *oidcAuthenticator) start(state string, login oidcLogin) bool {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+
+	now := time.Now()
+	for s, l := range oa.pending {
+		if now.After(l.expiresAt) {
+			delete(oa.pending, s)
+		}
+	}
+
+	if len(oa.pending) >= oidcMaxPending {
+		return false
+	}
+
+	oa.pending[state] = login
+	return true
+}
+
+// setStateCookie sets the cookie sent only to the callback, a negative
+// maxAge deletes it
+func (oa *oidcAuthenticator) setStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	path := PathHttpAuth + "/oidc/callback"
+	secure := false
+	if redirectURL, err := url.Parse(oa.opts.RedirectURL); err == nil {
+		if redirectURL.Path != "" {
+			path = redirectURL.Path
+		}
+		secure = redirectURL.Scheme == "https"
+	}
+
+	// the provider redirects to the callback from another site, a strict
+	// cookie wouldn't be sent
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// complete returns the login of the state, each state can be used only once
+func (oa *oidcAuthenticator) complete(state string) (oidcLogin, bool) {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+
+	login, ok := oa.pending[state]
+	delete(oa.pending, state)
+	if !ok || time.Now().After(login.expiresAt) {
+		return oidcLogin{}, false
+	}
+
+	return login, true
+}
+
+// oidcLoginHandler redirects to the provider to log into the workspace in
+// the `workspace` query parameter. The workspace is checked by the callback,
+// not to reveal which workspaces exist.
+func (rts *realTimeSyncServer) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	data := WorkspaceCredentials{Name: r.URL.Query().Get("workspace")}
+	if retryAfter, ok, report := rts.loginGuard.Allow(remoteIP(r), data.Name); !ok {
+		if report {
+			rts.audit(r, auditLoginLocked, data)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, ErrTooManyAttempts, http.StatusTooManyRequests)
+		return
+	}
+
+	url, err := rts.startOIDCLogin(w, oidcLogin{workspace: data.Name})
+	if errors.Is(err, errTooManyLogins) {
+		http.Error(w, ErrTooManyAttempts, http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, ErrOIDCLogin, http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// oidcLinkHandler starts a login which links the provider identity to the
+// logged user, it's the only way to log into a password user through the
+// provider
+func (rts *realTimeSyncServer) oidcLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserIDFromCtx(r.Context())
+	if userID == 0 {
+		http.Error(w, ErrNotUser, http.StatusForbidden)
+		return
+	}
+
+	url, err := rts.startOIDCLogin(w, oidcLogin{
+		workspaceID: middleware.WorkspaceIDFromCtx(r.Context()),
+		linkUserID:  userID,
+	})
+	if errors.Is(err, errTooManyLogins) {
+		http.Error(w, ErrTooManyAttempts, http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, ErrOIDCLogin, http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(OIDCLinkResponse{URL: url}); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// startOIDCLogin records the login, binds it to the browser and returns the
+// provider page to redirect to
+func (rts *realTimeSyncServer) startOIDCLogin(w http.ResponseWriter, login oidcLogin) (string, error) {
+	config, _, err := rts.oidc.discover(rts.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	login.nonce, err = randomString()
+	if err != nil {
+		return "", err
+	}
+
+	login.verifier = oauth2.GenerateVerifier()
+	login.expiresAt = time.Now().Add(oidcLoginDuration)
+	if !rts.oidc.start(state, login) {
+		return "", errTooManyLogins
+	}
+	rts.oidc.setStateCookie(w, hashSecret(state), int(oidcLoginDuration.Seconds()))
+
+	return config.AuthCodeURL(state, oidc.Nonce(login.nonce), oauth2.S256ChallengeOption(login.verifier)), nil
+}
+
+// oidcCallbackHandler completes the login, maps the provider identity to a
+// user and returns the server tokens for the workspace
+func (rts *realTimeSyncServer) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashSecret(state))) != 1 {
+		http.Error(w, ErrInvalidOIDCState, http.StatusBadRequest)
+		return
+	}
+	rts.oidc.setStateCookie(w, "", -1)
+
+	login, ok := rts.oidc.complete(state)
+	if !ok {
+		http.Error(w, ErrInvalidOIDCState, http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("error") != "" {
+		http.Error(w, ErrOIDCLogin, http.StatusUnauthorized)
+		return
+	}
+
+	config, verifier, err := rts.oidc.discover(rts.ctx)
+	if err != nil {
+		http.Error(w, ErrOIDCLogin, http.StatusBadGateway)
+		return
+	}
+
+	oauth2Token, err := config.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		http.Error(w, ErrOIDCLogin, http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, ErrOIDCLogin, http.StatusUnauthorized)
+		return
+	}
+
+	idToken, err := verifier.Verify(r.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != login.nonce {
+		http.Error(w, ErrOIDCLogin, http.StatusUnauthorized)
+		return
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, ErrOIDCLogin, http.StatusUnauthorized)
+		return
+	}
+
+	var userID int64
+	if login.linkUserID != 0 {
+		userID, err = rts.linkOIDCIdentity(r.Context(), idToken.Issuer, idToken.Subject, login.linkUserID)
+	} else {
+		userID, err = rts.oidcUser(r.Context(), idToken.Issuer, idToken.Subject, claims.Email, claims.EmailVerified)
+	}
+	switch {
+	case errors.Is(err, errUnverifiedMail), errors.Is(err, errLinkRequired), errors.Is(err, errAlreadyLinked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, ErrOIDCLogin, http.StatusInternalServerError)
+		return
+	}
+
+	workspaceID, role, err := rts.oidcMember(r.Context(), login, userID)
+	if err != nil {
+		if login.linkUserID == 0 {
+			rts.loginGuard.Fail(remoteIP(r), login.workspace)
+		}
+		http.Error(w, ErrNotMember, http.StatusForbidden)
+		return
+	}
+	if login.linkUserID == 0 {
+		rts.loginGuard.Succeed(remoteIP(r), login.workspace)
+	}
+
+	response, err := rts.issueTokens(r.Context(), middleware.Identity{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        role,
+	}, "")
+	if err != nil {
+		http.Error(w, "error while creating auth token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// oidcMember returns the workspace of the login and the role of the user in
+// it, an unknown workspace is refused as a missing membership
+func (rts *realTimeSyncServer) oidcMember(
+	ctx context.Context,
+	login oidcLogin,
+	userID int64,
+) (int64, middleware.Role, error) {
+	workspaceID := login.workspaceID
+	if login.linkUserID == 0 {
+		workspace, err := rts.db.FetchWorkspace(ctx, login.workspace)
+		if err != nil {
+			return 0, "", err
+		}
+		workspaceID = workspace.ID
+	}
+
+	member, err := rts.db.FetchWorkspaceMember(ctx, repository.FetchWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return workspaceID, middleware.Role(member.Role), nil
+}
+
+// oidcUser returns the user linked to the provider identity. On the first
+// login the identity is linked to the user named as its verified email,
+// which is created if missing. A user with a password is never linked
+// automatically, or whoever controls the email on the provider would take
+// it over: it must link the identity while logged in.
+func (rts *realTimeSyncServer) oidcUser(
+	ctx context.Context,
+	issuer, subject, email string,
+	emailVerified bool,
+) (int64, error) {
+	userID, err := rts.db.FetchUserIdentity(ctx, repository.FetchUserIdentityParams{
+		Issuer:  issuer,
+		Subject: subject,
+	})
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	if email == "" || !emailVerified {
+		return 0, errUnverifiedMail
+	}
+
+	user, err := rts.db.FetchUser(ctx, email)
+	switch {
+	case err == nil && user.Password != "":
+		return 0, errLinkRequired
+	case err == nil:
+		userID = user.ID
+	case errors.Is(err, sql.ErrNoRows):
+		// the user can log in only through the provider
+		userID, err = rts.db.AddUser(ctx, repository.AddUserParams{
+			Name:     email,
+			Password: "",
+		})
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+
+	err = rts.db.AddUserIdentity(ctx, repository.AddUserIdentityParams{
+		Issuer:  issuer,
+		Subject: subject,
+		UserID:  userID,
+	})
+	return userID, err
+}
+
+// linkOIDCIdentity links the provider identity to the user, unless it's
+// already linked to another one
+func (rts *realTimeSyncServer) linkOIDCIdentity(ctx context.Context, issuer, subject string, userID int64) (int64, error) {
+	linkedID, err := rts.db.FetchUserIdentity(ctx, repository.FetchUserIdentityParams{
+		Issuer:  issuer,
+		Subject: subject,
+	})
+	if err == nil && linkedID != userID {
+		return 0, errAlreadyLinked
+	}
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	err = rts.db.AddUserIdentity(ctx, repository.AddUserIdentityParams{
+		Issuer:  issuer,
+		Subject: subject,
+		UserID:  userID,
+	})
+	return userID, err
+}
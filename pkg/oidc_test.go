@@ -0,0 +1,351 @@
+package rtsync
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_oidcLogin(t *testing.T) {
+	provider := testutils.NewOIDCProvider(t)
+
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	options := Options{
+		JWTSecret: []byte("secret"),
+		OIDC: OIDCOptions{
+			Issuer:       provider.Server.URL,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  "http://sync.local" + PathHttpAuth + "/oidc/callback",
+		},
+	}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	require.NoError(t, repo.AddWorkspace(context.Background(), repository.AddWorkspaceParams{
+		Name:     "workspace1",
+		Password: "hash",
+	}))
+	workspace, err := repo.FetchWorkspace(context.Background(), "workspace1")
+	require.NoError(t, err)
+
+	t.Run("should refuse identities without membership", func(t *testing.T) {
+		provider.Login(testutils.OIDCIdentity{
+			Subject:       "subject-1",
+			Email:         "alice@example.com",
+			EmailVerified: true,
+		})
+
+		callback, cookies := oidcCallbackPath(t, server)
+		res, body := testutils.DoRequest[string](t, server, http.MethodGet, callback, nil, testutils.WithCookies(cookies...))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrNotMember, body)
+
+		// the user has been created and linked anyway
+		user, err := repo.FetchUser(context.Background(), "alice@example.com")
+		require.NoError(t, err)
+
+		userID, err := repo.FetchUserIdentity(context.Background(), repository.FetchUserIdentityParams{
+			Issuer:  provider.Server.URL,
+			Subject: "subject-1",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, userID)
+	})
+
+	t.Run("should issue tokens to members", func(t *testing.T) {
+		user, err := repo.FetchUser(context.Background(), "alice@example.com")
+		require.NoError(t, err)
+
+		require.NoError(t, repo.AddWorkspaceMember(context.Background(), repository.AddWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      user.ID,
+			Role:        string(middleware.RoleEditor),
+		}))
+
+		callback, cookies := oidcCallbackPath(t, server)
+		res, body := testutils.DoRequest[LoginResponse](
+			t,
+			server,
+			http.MethodGet,
+			callback,
+			nil,
+			testutils.WithCookies(cookies...),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.NotEmpty(t, body.RefreshToken)
+
+		identity, err := middleware.VerifyToken(context.Background(), middleware.AuthOptions{SecretKey: options.JWTSecret}, body.Token)
+		require.NoError(t, err)
+		assert.NotEmpty(t, identity.Session)
+		assert.Equal(t, middleware.Identity{
+			WorkspaceID: workspace.ID,
+			UserID:      user.ID,
+			Role:        middleware.RoleEditor,
+			Session:     identity.Session,
+		}, identity)
+	})
+
+	t.Run("should refuse unverified emails", func(t *testing.T) {
+		provider.Login(testutils.OIDCIdentity{
+			Subject:       "subject-2",
+			Email:         "mallory@example.com",
+			EmailVerified: false,
+		})
+
+		callback, cookies := oidcCallbackPath(t, server)
+		res, body := testutils.DoRequest[string](t, server, http.MethodGet, callback, nil, testutils.WithCookies(cookies...))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrOIDCUnverifiedMail, body)
+
+		_, err := repo.FetchUser(context.Background(), "mallory@example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("should not link the users with a password", func(t *testing.T) {
+		bobID, err := repo.AddUser(context.Background(), repository.AddUserParams{
+			Name:     "bob@example.com",
+			Password: "hash",
+		})
+		require.NoError(t, err)
+		require.NoError(t, repo.AddWorkspaceMember(context.Background(), repository.AddWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      bobID,
+			Role:        string(middleware.RoleViewer),
+		}))
+
+		provider.Login(testutils.OIDCIdentity{
+			Subject:       "subject-3",
+			Email:         "bob@example.com",
+			EmailVerified: true,
+		})
+
+		callback, cookies := oidcCallbackPath(t, server)
+		res, body := testutils.DoRequest[string](t, server, http.MethodGet, callback, nil, testutils.WithCookies(cookies...))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrOIDCLinkRequired, body)
+
+		_, err = repo.FetchUserIdentity(context.Background(), repository.FetchUserIdentityParams{
+			Issuer:  provider.Server.URL,
+			Subject: "subject-3",
+		})
+		assert.Error(t, err)
+
+		// bob links the identity while logged in
+		token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: options.JWTSecret}, middleware.Identity{
+			WorkspaceID: workspace.ID,
+			UserID:      bobID,
+			Role:        middleware.RoleViewer,
+		})
+		require.NoError(t, err)
+
+		res, link := testutils.DoRequest[OIDCLinkResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/account/oidc",
+			nil,
+			testutils.WithToken(token),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+
+		res, _ = testutils.DoRequest[LoginResponse](
+			t,
+			server,
+			http.MethodGet,
+			followOIDCRedirect(t, link.URL),
+			nil,
+			testutils.WithCookies(res.Result().Cookies()...),
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+
+		userID, err := repo.FetchUserIdentity(context.Background(), repository.FetchUserIdentityParams{
+			Issuer:  provider.Server.URL,
+			Subject: "subject-3",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, bobID, userID)
+
+		// then logs in through the provider
+		callback, cookies = oidcCallbackPath(t, server)
+		res, _ = testutils.DoRequest[LoginResponse](t, server, http.MethodGet, callback, nil, testutils.WithCookies(cookies...))
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("should not link an identity to two users", func(t *testing.T) {
+		alice, err := repo.FetchUser(context.Background(), "alice@example.com")
+		require.NoError(t, err)
+
+		token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: options.JWTSecret}, middleware.Identity{
+			WorkspaceID: workspace.ID,
+			UserID:      alice.ID,
+			Role:        middleware.RoleEditor,
+		})
+		require.NoError(t, err)
+
+		// the provider is still logged in as bob
+		res, link := testutils.DoRequest[OIDCLinkResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/account/oidc",
+			nil,
+			testutils.WithToken(token),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			followOIDCRedirect(t, link.URL),
+			nil,
+			testutils.WithCookies(res.Result().Cookies()...),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrOIDCAlreadyLinked, body)
+	})
+
+	t.Run("should not reveal the workspaces", func(t *testing.T) {
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpAuth+"/oidc/login?workspace=missing",
+			nil,
+		)
+		require.Equal(t, http.StatusFound, res.Code)
+
+		// the provider is still logged in as bob, a member of workspace1
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			followOIDCRedirect(t, res.Header().Get("Location")),
+			nil,
+			testutils.WithCookies(res.Result().Cookies()...),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrNotMember, body)
+	})
+
+	t.Run("should refuse unknown states", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpAuth+"/oidc/callback?code=code&state=state",
+			nil,
+			testutils.WithCookies(&http.Cookie{Name: oidcStateCookie, Value: hashSecret("state")}),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidOIDCState, body)
+	})
+
+	t.Run("should bind the state to the browser", func(t *testing.T) {
+		callback, cookies := oidcCallbackPath(t, server)
+		require.Len(t, cookies, 1)
+		assert.Equal(t, oidcStateCookie, cookies[0].Name)
+		assert.Equal(t, PathHttpAuth+"/oidc/callback", cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+
+		// another browser is refused, with or without the cookie of its
+		// own login
+		res, body := testutils.DoRequest[string](t, server, http.MethodGet, callback, nil)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidOIDCState, body)
+
+		_, otherCookies := oidcCallbackPath(t, server)
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			callback,
+			nil,
+			testutils.WithCookies(otherCookies...),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidOIDCState, body)
+
+		// the login can still be completed by its browser, once
+		res, _ = testutils.DoRequest[string](t, server, http.MethodGet, callback, nil, testutils.WithCookies(cookies...))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, -1, res.Result().Cookies()[0].MaxAge)
+
+		res, body = testutils.DoRequest[string](t, server, http.MethodGet, callback, nil, testutils.WithCookies(cookies...))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidOIDCState, body)
+	})
+
+	t.Run("should throttle the logins", func(t *testing.T) {
+		pending := len(server.oidc.pending)
+		for range 100 {
+			res, _ := testutils.DoRequest[string](
+				t,
+				server,
+				http.MethodGet,
+				PathHttpAuth+"/oidc/login?workspace=missing",
+				nil,
+			)
+			if res.Code == http.StatusTooManyRequests {
+				assert.NotEmpty(t, res.Header().Get("Retry-After"))
+				break
+			}
+			require.Equal(t, http.StatusFound, res.Code)
+		}
+
+		assert.Less(t, len(server.oidc.pending)-pending, 20)
+	})
+}
+
+// oidcCallbackPath starts the login and follows the redirect to the provider,
+// it returns the callback path the provider redirects to and the cookies of
+// the browser which started the login
+func oidcCallbackPath(t *testing.T, server http.Handler) (string, []*http.Cookie) {
+	res, _ := testutils.DoRequest[string](
+		t,
+		server,
+		http.MethodGet,
+		PathHttpAuth+"/oidc/login?workspace=workspace1",
+		nil,
+	)
+	require.Equal(t, http.StatusFound, res.Code)
+
+	return followOIDCRedirect(t, res.Header().Get("Location")), res.Result().Cookies()
+}
+
+// followOIDCRedirect logs into the provider page, it returns the callback
+// path the provider redirects to
+func followOIDCRedirect(t *testing.T, location string) string {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, location, http.NoBody)
+	require.NoError(t, err)
+
+	authorizeRes, err := client.Do(req)
+	require.NoError(t, err)
+	defer authorizeRes.Body.Close()
+	require.Equal(t, http.StatusFound, authorizeRes.StatusCode)
+
+	callback, err := url.Parse(authorizeRes.Header.Get("Location"))
+	require.NoError(t, err)
+
+	return callback.Path + "?" + callback.RawQuery
+}
@@ -0,0 +1,201 @@
+package rtsync
+
+import (
+	"sync"
+	"time"
+)
+
+// maxQueuedChunks is the number of chunks queued for a subscriber over which
+// the queued chunks are replaced by snapshots of the files
+const maxQueuedChunks = 256
+
+// SnapshotMessage replaces the chunks of a file a slow client missed, the
+// client must replace its copy of the file with Content
+type SnapshotMessage struct {
+	WsMessageHeader
+	Content string `json:"content"`
+}
+
+// outboxEntry is a message waiting to be sent: the chunks of a file or, when
+// snapshot is set, its content, or an event
+type outboxEntry struct {
+	msg      ChunkMessage
+	snapshot bool
+	event    *EventMessage
+}
+
+// pushResult tells how a message has been queued
+type pushResult struct {
+	// coalesced is set if the chunks were merged into a queued message
+	coalesced bool
+	// snapshots is the number of files whose chunks were replaced by a
+	// snapshot
+	snapshots int
+	// slow is set, only once, when the subscriber has been behind for
+	// longer than the grace period
+	slow bool
+}
+
+// chunkOutbox queues the chunks and the events for a subscriber without
+// blocking the broadcast. The chunks of a file waiting to be sent are merged
+// in a single message, and when too many are waiting they're replaced by the
+// content of the files. It's guarded by its own mutex, taken after
+// ws.subscribersMu.
+type chunkOutbox struct {
+	mu      sync.Mutex
+	entries []*outboxEntry
+	// pending are the queued chunks of each file, the next chunks of the
+	// file are merged into them
+	pending map[int64]*outboxEntry
+	chunks  int
+	// queuedSince is when the first message queued since the last pop
+	// was pushed, sendingSince the same for the popped messages until
+	// they're sent
+	queuedSince  time.Time
+	sendingSince time.Time
+	slow         bool
+	ready        chan struct{}
+}
+
+func newChunkOutbox() *chunkOutbox {
+	return &chunkOutbox{
+		pending: make(map[int64]*outboxEntry),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push queues the chunks, msg.content must be the content of the file once
+// they're applied
+func (o *chunkOutbox) push(msg ChunkMessage, now time.Time, grace time.Duration) pushResult {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var result pushResult
+	entry, ok := o.pending[msg.FileId]
+	switch {
+	case !ok:
+		entry = &outboxEntry{msg: msg}
+		o.entries = append(o.entries, entry)
+		o.pending[msg.FileId] = entry
+		o.chunks += len(msg.Chunks)
+	case entry.snapshot:
+		entry.msg.content = msg.content
+		result.coalesced = true
+	default:
+		entry.msg.Chunks = append(entry.msg.Chunks, msg.Chunks...)
+		entry.msg.content = msg.content
+		o.chunks += len(msg.Chunks)
+		result.coalesced = true
+	}
+
+	if o.chunks > maxQueuedChunks {
+		for _, entry := range o.pending {
+			if !entry.snapshot {
+				entry.snapshot = true
+				entry.msg.Chunks = nil
+				result.snapshots++
+			}
+		}
+		o.chunks = 0
+	}
+
+	result.slow = o.queued(now, grace)
+	return result
+}
+
+// pushEvent queues the event after the messages already queued, the next
+// chunks of its file are sent after it
+func (o *chunkOutbox) pushEvent(msg EventMessage, now time.Time, grace time.Duration) pushResult {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.entries = append(o.entries, &outboxEntry{event: &msg})
+	delete(o.pending, msg.FileId)
+
+	return pushResult{slow: o.queued(now, grace)}
+}
+
+// queued wakes up the writer and reports, only once, if the subscriber has
+// been behind for longer than the grace period. o.mu must be held.
+func (o *chunkOutbox) queued(now time.Time, grace time.Duration) bool {
+	if o.queuedSince.IsZero() {
+		o.queuedSince = now
+	}
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+
+	if o.slow || grace <= 0 || now.Sub(o.behindSince()) <= grace {
+		return false
+	}
+	o.slow = true
+	return true
+}
+
+// pop returns the queued messages in order and empties the outbox, the
+// subscriber stays behind until sent is called
+func (o *chunkOutbox) pop() []outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]outboxEntry, 0, len(o.entries))
+	for _, entry := range o.entries {
+		entries = append(entries, *entry)
+	}
+
+	o.entries = nil
+	o.pending = make(map[int64]*outboxEntry)
+	o.chunks = 0
+	if o.sendingSince.IsZero() {
+		o.sendingSince = o.queuedSince
+	}
+	o.queuedSince = time.Time{}
+
+	return entries
+}
+
+// sent is called once the popped messages are written, the grace period
+// restarts from the next push
+func (o *chunkOutbox) sent() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sendingSince = time.Time{}
+}
+
+// behindSince is when the oldest message not sent yet was pushed, zero if
+// every message has been sent. o.mu must be held.
+func (o *chunkOutbox) behindSince() time.Time {
+	if !o.sendingSince.IsZero() {
+		return o.sendingSince
+	}
+	return o.queuedSince
+}
+
+// behind reports if messages are waiting to be sent
+func (o *chunkOutbox) behind() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return !o.behindSince().IsZero()
+}
+
+// message returns the message to send for the entry
+func (e outboxEntry) message() any {
+	if e.event != nil {
+		return *e.event
+	}
+	if !e.snapshot {
+		return e.msg
+	}
+
+	return SnapshotMessage{
+		WsMessageHeader: WsMessageHeader{
+			FileId: e.msg.FileId,
+			Type:   SnapshotEventType,
+		},
+		Content: e.msg.content,
+	}
+}
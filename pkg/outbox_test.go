@@ -0,0 +1,143 @@
+package rtsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkMsg(fileID int64, content string, chunks ...diff.DiffChunk) ChunkMessage {
+	return ChunkMessage{
+		WsMessageHeader: WsMessageHeader{FileId: fileID, Type: ChunkEventType},
+		Chunks:          chunks,
+		content:         content,
+	}
+}
+
+func TestChunkOutbox(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should coalesce the chunks of a file", func(t *testing.T) {
+		o := newChunkOutbox()
+
+		first := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+		second := diff.DiffChunk{Type: diff.DiffAdd, Position: 1, Text: "b", Len: 1}
+		other := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "c", Len: 1}
+
+		assert.False(t, o.push(chunkMsg(1, "a", first), now, time.Minute).coalesced)
+		assert.False(t, o.push(chunkMsg(2, "c", other), now, time.Minute).coalesced)
+		assert.True(t, o.push(chunkMsg(1, "ab", second), now, time.Minute).coalesced)
+
+		entries := o.pop()
+		require.Len(t, entries, 2)
+		assert.Equal(t, int64(1), entries[0].msg.FileId)
+		assert.Equal(t, []diff.DiffChunk{first, second}, entries[0].msg.Chunks)
+		assert.Equal(t, int64(2), entries[1].msg.FileId)
+		assert.Empty(t, o.pop())
+	})
+
+	t.Run("should replace the chunks with a snapshot on overflow", func(t *testing.T) {
+		o := newChunkOutbox()
+
+		chunk := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+		snapshots := 0
+		for i := 0; i <= maxQueuedChunks; i++ {
+			snapshots += o.push(chunkMsg(1, "content", chunk), now, time.Minute).snapshots
+		}
+		assert.Equal(t, 1, snapshots)
+
+		result := o.push(chunkMsg(1, "latest content", chunk), now, time.Minute)
+		assert.True(t, result.coalesced)
+		assert.Zero(t, result.snapshots)
+
+		entries := o.pop()
+		require.Len(t, entries, 1)
+		assert.Equal(t, SnapshotMessage{
+			WsMessageHeader: WsMessageHeader{FileId: 1, Type: SnapshotEventType},
+			Content:         "latest content",
+		}, entries[0].message())
+
+		o.push(chunkMsg(1, "after", chunk), now, time.Minute)
+		entries = o.pop()
+		require.Len(t, entries, 1)
+		assert.False(t, entries[0].snapshot)
+	})
+
+	t.Run("should report a subscriber behind for longer than the grace period", func(t *testing.T) {
+		o := newChunkOutbox()
+		chunk := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+
+		assert.False(t, o.push(chunkMsg(1, "a", chunk), now, time.Second).slow)
+		assert.False(t, o.push(chunkMsg(1, "a", chunk), now.Add(time.Second/2), time.Second).slow)
+		assert.True(t, o.behind())
+
+		assert.True(t, o.push(chunkMsg(1, "a", chunk), now.Add(2*time.Second), time.Second).slow)
+		assert.False(t, o.push(chunkMsg(1, "a", chunk), now.Add(3*time.Second), time.Second).slow)
+	})
+
+	t.Run("should keep the messages being written behind", func(t *testing.T) {
+		o := newChunkOutbox()
+		chunk := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+
+		o.push(chunkMsg(1, "a", chunk), now, time.Second)
+		o.pop()
+		assert.True(t, o.behind())
+
+		assert.True(t, o.push(chunkMsg(1, "a", chunk), now.Add(2*time.Second), time.Second).slow)
+	})
+
+	t.Run("should restart the grace period once sent", func(t *testing.T) {
+		o := newChunkOutbox()
+		chunk := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+
+		o.push(chunkMsg(1, "a", chunk), now, time.Second)
+		o.pop()
+		o.sent()
+		assert.False(t, o.behind())
+
+		assert.False(t, o.push(chunkMsg(1, "a", chunk), now.Add(2*time.Second), time.Second).slow)
+		assert.True(t, o.behind())
+		assert.False(t, o.push(chunkMsg(1, "a", chunk), now.Add(2*time.Second+time.Second/2), time.Second).slow)
+		assert.True(t, o.push(chunkMsg(1, "a", chunk), now.Add(3*time.Second+time.Second/2), time.Second).slow)
+	})
+
+	t.Run("should queue the events in order with the chunks", func(t *testing.T) {
+		o := newChunkOutbox()
+		first := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+		second := diff.DiffChunk{Type: diff.DiffAdd, Position: 1, Text: "b", Len: 1}
+		rename := EventMessage{
+			WsMessageHeader: WsMessageHeader{FileId: 1, Type: RenameEventType},
+			WorkspacePath:   "renamed.md",
+			ObjectType:      "file",
+		}
+
+		o.push(chunkMsg(1, "a", first), now, time.Minute)
+		o.pushEvent(rename, now, time.Minute)
+		assert.False(t, o.push(chunkMsg(1, "ab", second), now, time.Minute).coalesced)
+
+		entries := o.pop()
+		require.Len(t, entries, 3)
+		assert.Equal(t, []diff.DiffChunk{first}, entries[0].msg.Chunks)
+		assert.Equal(t, rename, entries[1].message())
+		assert.Equal(t, []diff.DiffChunk{second}, entries[2].msg.Chunks)
+	})
+
+	t.Run("should report a subscriber behind on events", func(t *testing.T) {
+		o := newChunkOutbox()
+		event := EventMessage{WsMessageHeader: WsMessageHeader{FileId: 1, Type: CreateEventType}}
+
+		assert.False(t, o.pushEvent(event, now, time.Second).slow)
+		assert.True(t, o.pushEvent(event, now.Add(2*time.Second), time.Second).slow)
+	})
+
+	t.Run("should never report with a negative grace period", func(t *testing.T) {
+		o := newChunkOutbox()
+		chunk := diff.DiffChunk{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}
+
+		o.push(chunkMsg(1, "a", chunk), now, -1)
+		assert.False(t, o.push(chunkMsg(1, "a", chunk), now.Add(time.Hour), -1).slow)
+	})
+}
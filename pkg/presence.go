@@ -0,0 +1,122 @@
+package rtsync
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+)
+
+const ErrInvalidPresence = "invalid presence"
+
+// SelectionRange is a selection of the open file as byte offsets, the head
+// is where the cursor is. A cursor without selection has the anchor equal to
+// the head.
+type SelectionRange struct {
+	Anchor int64 `json:"anchor"`
+	Head   int64 `json:"head"`
+}
+
+// PresenceMessage tells the other clients of the workspace which file a
+// client has open, FileId 0 if none, and where its cursors are. Clients
+// receive the presence of the others only once they send theirs: at the
+// first one they get the presence of every client already announced. The
+// server sets ClientId and UserId and sends Left when a client disconnects.
+//
+// The server moves the cursors through the chunks it applies, the clients
+// should do the same with the chunks they receive.
+type PresenceMessage struct {
+	WsMessageHeader
+	ClientId   string           `json:"clientId"`
+	UserId     int64            `json:"userId"`
+	Selections []SelectionRange `json:"selections"`
+	Left       bool             `json:"left,omitempty"`
+}
+
+func (rts *realTimeSyncServer) onPresenceMessage(presence PresenceMessage) ([]PresenceMessage, error) {
+	for _, selection := range presence.Selections {
+		if selection.Anchor < 0 || selection.Head < 0 {
+			return nil, errors.New(ErrInvalidPresence)
+		}
+	}
+	if presence.FileId == 0 || presence.Selections == nil {
+		presence.Selections = []SelectionRange{}
+	}
+
+	ws := rts.hub.workspace(presence.WorkspaceId)
+	ws.subscribersMu.Lock()
+	defer ws.subscribersMu.Unlock()
+
+	_, announced := ws.presences[presence.ClientId]
+	ws.presences[presence.ClientId] = presence
+	rts.broadcastPresenceMessage(ws, presence)
+
+	if announced {
+		return nil, nil
+	}
+
+	others := []PresenceMessage{}
+	for clientID, other := range ws.presences {
+		if clientID != presence.ClientId {
+			others = append(others, other)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].ClientId < others[j].ClientId
+	})
+
+	return others, nil
+}
+
+// broadcastPresenceMessage sends the presence to the clients of the workspace
+// which announced theirs. Presence is sent again at every change, so it's
+// dropped for the slow subscribers. ws.subscribersMu must be held.
+func (rts *realTimeSyncServer) broadcastPresenceMessage(ws *workspaceHub, msg PresenceMessage) {
+	for s := range ws.subscribers {
+		if _, ok := ws.presences[s.clientId]; !ok {
+			continue
+		}
+
+		select {
+		case s.presenceMsgQueue <- msg:
+		default:
+		}
+	}
+}
+
+// leavePresence deletes the presence of the subscriber and tells the others
+// it left. ws.subscribersMu must be held.
+func (rts *realTimeSyncServer) leavePresence(ws *workspaceHub, s *subscriber) {
+	presence, ok := ws.presences[s.clientId]
+	if !ok {
+		return
+	}
+	delete(ws.presences, s.clientId)
+
+	presence.FileId = 0
+	presence.Selections = []SelectionRange{}
+	presence.Left = true
+	rts.broadcastPresenceMessage(ws, presence)
+}
+
+// transformPresences moves the cursors in the file through the chunks
+func (rts *realTimeSyncServer) transformPresences(ws *workspaceHub, fileID int64, chunks []diff.DiffChunk) {
+	ws.subscribersMu.Lock()
+	defer ws.subscribersMu.Unlock()
+
+	for clientID, presence := range ws.presences {
+		if presence.FileId != fileID {
+			continue
+		}
+
+		selections := make([]SelectionRange, len(presence.Selections))
+		for i, selection := range presence.Selections {
+			selections[i] = SelectionRange{
+				Anchor: diff.TransformPosition(selection.Anchor, chunks),
+				Head:   diff.TransformPosition(selection.Head, chunks),
+			}
+		}
+		presence.Selections = selections
+		ws.presences[clientID] = presence
+	}
+}
@@ -0,0 +1,148 @@
+package rtsync
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_presence(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	mockFileStorage := new(filestorage.MockFileStorage)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+		DiskPath:      "disk_path",
+		WorkspacePath: "note.md",
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+	handler.hub.workspace(file.WorkspaceID).files[file.ID] = FileWithContent{File: file, Content: "hello world"}
+	mockFileStorage.On("WriteObject", file.DiskPath, mock.Anything).Return(nil)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	dial := func(workspaceID int64, role middleware.Role) *websocket.Conn {
+		//nolint:bodyclose
+		conn, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, workspaceID, role))
+		require.NoError(t, err)
+		return conn
+	}
+	announce := func(conn *websocket.Conn, fileID int64, selections ...SelectionRange) {
+		require.NoError(t, wsjson.Write(ctx, conn, PresenceMessage{
+			WsMessageHeader: WsMessageHeader{Type: PresenceEventType, FileId: fileID},
+			Selections:      selections,
+		}))
+	}
+	read := func(conn *websocket.Conn) PresenceMessage {
+		var msg PresenceMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		require.Equal(t, PresenceEventType, msg.Type)
+		return msg
+	}
+
+	editor := dial(1, middleware.RoleEditor)
+	defer editor.Close(websocket.StatusNormalClosure, "")
+	viewer := dial(1, middleware.RoleViewer)
+	other := dial(2, middleware.RoleEditor)
+	defer other.Close(websocket.StatusNormalClosure, "")
+
+	announce(editor, file.ID, SelectionRange{Anchor: 0, Head: 5})
+	require.Eventually(t, func() bool {
+		ws := handler.hub.workspace(1)
+		ws.subscribersMu.Lock()
+		defer ws.subscribersMu.Unlock()
+		return len(ws.presences) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("should send the presence of the others at the first announce", func(t *testing.T) {
+		announce(viewer, file.ID, SelectionRange{Anchor: 6, Head: 6})
+
+		editorPresence := read(viewer)
+		assert.Equal(t, file.ID, editorPresence.FileId)
+		assert.Equal(t, []SelectionRange{{Anchor: 0, Head: 5}}, editorPresence.Selections)
+		assert.NotEmpty(t, editorPresence.ClientId)
+
+		viewerPresence := read(editor)
+		assert.Equal(t, []SelectionRange{{Anchor: 6, Head: 6}}, viewerPresence.Selections)
+		assert.NotEqual(t, editorPresence.ClientId, viewerPresence.ClientId)
+		assert.False(t, viewerPresence.Left)
+	})
+
+	t.Run("should not share the presence with other workspaces", func(t *testing.T) {
+		announce(other, file.ID)
+		require.Eventually(t, func() bool {
+			ws := handler.hub.workspace(2)
+			ws.subscribersMu.Lock()
+			defer ws.subscribersMu.Unlock()
+			return len(ws.presences) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		// the editor would receive it before the next presence, checked below
+		readCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		var msg PresenceMessage
+		assert.Error(t, wsjson.Read(readCtx, other, &msg))
+	})
+
+	t.Run("should move the cursors through the chunks", func(t *testing.T) {
+		require.NoError(t, wsjson.Write(ctx, editor, ChunkMessage{
+			WsMessageHeader: WsMessageHeader{Type: ChunkEventType, FileId: file.ID},
+			Chunks:          []diff.DiffChunk{{Type: diff.DiffAdd, Position: 5, Text: ",", Len: 1}},
+		}))
+
+		var chunk ChunkMessage
+		require.NoError(t, wsjson.Read(ctx, viewer, &chunk))
+		require.Equal(t, ChunkEventType, chunk.Type)
+
+		ws := handler.hub.workspace(1)
+		ws.subscribersMu.Lock()
+		defer ws.subscribersMu.Unlock()
+		positions := map[int64]bool{}
+		for _, presence := range ws.presences {
+			if presence.WorkspaceId == 1 {
+				positions[presence.Selections[0].Head] = true
+			}
+		}
+		assert.Equal(t, map[int64]bool{5: true, 7: true}, positions)
+	})
+
+	t.Run("should clear the presence of the disconnected clients", func(t *testing.T) {
+		require.NoError(t, viewer.Close(websocket.StatusNormalClosure, ""))
+
+		left := read(editor)
+		assert.True(t, left.Left)
+		assert.Empty(t, left.Selections)
+
+		ws := handler.hub.workspace(1)
+		ws.subscribersMu.Lock()
+		defer ws.subscribersMu.Unlock()
+		assert.NotContains(t, ws.presences, left.ClientId)
+	})
+}
@@ -0,0 +1,61 @@
+package rtsync
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+const (
+	ErrInvalidFilter = "invalid query filter"
+	ErrQuery         = "impossible to query the files"
+)
+
+func (rts *realTimeSyncServer) queryHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := service.MetadataQuery{
+		Tags:       params["tag"],
+		PathPrefix: params.Get("path"),
+		Limit:      service.DefaultQueryLimit,
+	}
+
+	if l := params.Get("limit"); l != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(l)
+		if err != nil || query.Limit <= 0 || query.Limit > 1000 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, where := range params["where"] {
+		filter, err := service.ParsePropertyFilter(where)
+		if err != nil {
+			http.Error(w, ErrInvalidFilter, http.StatusBadRequest)
+			return
+		}
+		query.Properties = append(query.Properties, filter)
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+	results, err := rts.metadata.Query(r.Context(), workspaceID, query)
+	if errors.Is(err, service.ErrInvalidFilter) {
+		http.Error(w, ErrInvalidFilter, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, ErrQuery, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
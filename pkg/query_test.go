@@ -0,0 +1,95 @@
+package rtsync
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_queryHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	create := func(diskPath, path, content string) repository.File {
+		mockFileStorage.On("CreateObject", []byte(content)).Return(diskPath, nil).Once()
+		res, file := testutils.DoRequest[repository.File](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/file",
+			CreateFileBody{Path: path, Content: []byte(content)},
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		require.Equal(t, http.StatusCreated, res.Code)
+		return file
+	}
+
+	done := create("disk/done", "tasks/done.md", "---\nstatus: done\ndue: 2024-01-10\n---\n#task")
+	todo := create("disk/todo", "tasks/todo.md", "---\nstatus: todo\ndue: 2024-02-10\n---\n#task #urgent")
+	create("disk/note", "note.md", "#task in a note")
+
+	query := func(params url.Values) (int, []service.QueryResult) {
+		res, results := testutils.DoRequest[[]service.QueryResult](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/query?"+params.Encode(),
+			nil,
+			testutils.WithRoleAuthHeader(options.JWTSecret, 1, middleware.RoleViewer),
+		)
+		return res.Code, results
+	}
+
+	t.Run("should filter by tag, property and path", func(t *testing.T) {
+		code, results := query(url.Values{
+			"tag":   {"task"},
+			"path":  {"tasks/"},
+			"where": {"due>=2024-02-01"},
+		})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, results, 1)
+		assert.Equal(t, todo.ID, results[0].FileID)
+		assert.Equal(t, []string{"task", "urgent"}, results[0].Tags)
+		assert.Equal(t, map[string]any{"status": "todo", "due": "2024-02-10"}, results[0].Properties)
+
+		code, results = query(url.Values{"where": {"status=done"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, results, 1)
+		assert.Equal(t, done.ID, results[0].FileID)
+
+		code, results = query(url.Values{"tag": {"task"}, "limit": {"2"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, results, 2)
+	})
+
+	t.Run("should reject invalid filters", func(t *testing.T) {
+		for _, params := range []url.Values{{"where": {"status"}}, {"limit": {"0"}}} {
+			res, body := testutils.DoRequest[string](
+				t,
+				server,
+				http.MethodGet,
+				PathHttpApi+"/query?"+params.Encode(),
+				nil,
+				testutils.WithAuthHeader(options.JWTSecret, 1),
+			)
+			assert.Equal(t, http.StatusBadRequest, res.Code)
+			assert.NotEmpty(t, body)
+		}
+	})
+
+	mockFileStorage.AssertExpectations(t)
+}
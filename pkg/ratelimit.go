@@ -0,0 +1,112 @@
+package rtsync
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const ErrRateLimited = "rate limit exceeded"
+
+// Default limits of the operations sent on the sync socket
+const (
+	DefaultClientRate     = 20
+	DefaultClientBurst    = 40
+	DefaultWorkspaceRate  = 50
+	DefaultWorkspaceBurst = 100
+)
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to
+// Burst, a negative rate disables the limit
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) limiter() *rate.Limiter {
+	if l.Rate < 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(l.Rate), l.Burst)
+}
+
+type workspaceLimiter struct {
+	limiter     *rate.Limiter
+	subscribers int
+}
+
+// opsLimiter limits the operations sent by the clients on the sync socket,
+// each connection and each workspace have their own token bucket. A bucket
+// of a workspace lives as long as its workspace has subscribers.
+type opsLimiter struct {
+	mu         sync.Mutex
+	client     RateLimit
+	workspace  RateLimit
+	workspaces map[int64]*workspaceLimiter
+}
+
+func newOpsLimiter(client, workspace RateLimit) *opsLimiter {
+	return &opsLimiter{
+		client:     client,
+		workspace:  workspace,
+		workspaces: make(map[int64]*workspaceLimiter),
+	}
+}
+
+// acquire returns the buckets of a new connection to the workspace
+func (l *opsLimiter) acquire(workspaceID int64) (*rate.Limiter, *rate.Limiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ws, ok := l.workspaces[workspaceID]
+	if !ok {
+		ws = &workspaceLimiter{limiter: l.workspace.limiter()}
+		l.workspaces[workspaceID] = ws
+	}
+	ws.subscribers++
+
+	return l.client.limiter(), ws.limiter
+}
+
+// release forgets the bucket of the workspace once its last connection is
+// gone
+func (l *opsLimiter) release(workspaceID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ws, ok := l.workspaces[workspaceID]
+	if !ok {
+		return
+	}
+	ws.subscribers--
+	if ws.subscribers <= 0 {
+		delete(l.workspaces, workspaceID)
+	}
+}
+
+// allowOp takes a token from every bucket, or none if one of them is empty,
+// in which case it returns after how long the operation can be retried
+func allowOp(now time.Time, limiters ...*rate.Limiter) (time.Duration, bool) {
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	var retryAfter time.Duration
+
+	for _, limiter := range limiters {
+		reservation := limiter.ReserveN(now, 1)
+		if !reservation.OK() {
+			retryAfter = time.Second
+		} else if delay := reservation.DelayFrom(now); delay > 0 {
+			retryAfter = max(retryAfter, delay)
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	if retryAfter == 0 {
+		return 0, true
+	}
+
+	for _, reservation := range reservations {
+		reservation.CancelAt(now)
+	}
+	return retryAfter, false
+}
@@ -0,0 +1,160 @@
+package rtsync
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestAllowOp(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should take a token from every bucket", func(t *testing.T) {
+		client := rate.NewLimiter(1, 2)
+		workspace := rate.NewLimiter(1, 1)
+
+		_, ok := allowOp(now, client, workspace)
+		assert.True(t, ok)
+
+		retryAfter, ok := allowOp(now, client, workspace)
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, retryAfter)
+
+		// the token of the client isn't taken when the workspace is empty
+		assert.Equal(t, float64(1), client.TokensAt(now))
+	})
+
+	t.Run("should never limit a disabled bucket", func(t *testing.T) {
+		limiter := RateLimit{Rate: -1}.limiter()
+		for range 100 {
+			_, ok := allowOp(now, limiter)
+			assert.True(t, ok)
+		}
+	})
+}
+
+func TestOpsLimiter(t *testing.T) {
+	l := newOpsLimiter(RateLimit{Rate: 1, Burst: 1}, RateLimit{Rate: 1, Burst: 1})
+
+	client1, workspace1 := l.acquire(1)
+	client2, workspace2 := l.acquire(1)
+	_, otherWorkspace := l.acquire(2)
+
+	assert.NotSame(t, client1, client2)
+	assert.Same(t, workspace1, workspace2)
+	assert.NotSame(t, workspace1, otherWorkspace)
+
+	l.release(1)
+	assert.Contains(t, l.workspaces, int64(1))
+	l.release(1)
+	assert.NotContains(t, l.workspaces, int64(1))
+}
+
+func Test_wsRateLimit(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	options := Options{
+		JWTSecret:          []byte("secret"),
+		ClientRateLimit:    RateLimit{Rate: 0.001, Burst: 1},
+		WorkspaceRateLimit: RateLimit{Rate: 0.001, Burst: 2},
+	}
+	handler := New(db, new(filestorage.MockFileStorage), options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	dial := func(workspaceID int64, role middleware.Role) *websocket.Conn {
+		//nolint:bodyclose
+		conn, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, workspaceID, role))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+		return conn
+	}
+
+	event := EventMessage{
+		WsMessageHeader: WsMessageHeader{Type: CreateEventType, FileId: 1},
+		WorkspacePath:   "note.md",
+		ObjectType:      "file",
+	}
+
+	// the viewers receive the events which aren't limited
+	viewers := map[int64]*websocket.Conn{
+		1: dial(1, middleware.RoleViewer),
+		2: dial(2, middleware.RoleViewer),
+	}
+
+	expectAllowed := func(conn *websocket.Conn, workspaceID int64) {
+		require.NoError(t, wsjson.Write(ctx, conn, event))
+
+		var msg EventMessage
+		require.NoError(t, wsjson.Read(ctx, viewers[workspaceID], &msg))
+		assert.Equal(t, event.WorkspacePath, msg.WorkspacePath)
+	}
+
+	expectLimited := func(conn *websocket.Conn) {
+		require.NoError(t, wsjson.Write(ctx, conn, event))
+
+		var msg ErrorMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, ErrorEventType, msg.Type)
+		assert.Equal(t, int64(1), msg.FileId)
+		assert.Equal(t, ErrRateLimited, msg.Error)
+		assert.Positive(t, msg.RetryAfter)
+	}
+
+	first := dial(1, middleware.RoleEditor)
+	expectAllowed(first, 1)
+	expectLimited(first)
+
+	// the workspace has a token left
+	second := dial(1, middleware.RoleEditor)
+	expectAllowed(second, 1)
+
+	third := dial(1, middleware.RoleEditor)
+	expectLimited(third)
+
+	// other workspaces aren't affected
+	other := dial(2, middleware.RoleEditor)
+	expectAllowed(other, 2)
+
+	t.Run("should limit the presences and the subscriptions of the connection", func(t *testing.T) {
+		expectError := func(conn *websocket.Conn, reason string) {
+			var msg ErrorMessage
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, ErrorEventType, msg.Type)
+			assert.Equal(t, reason, msg.Error)
+		}
+
+		subscription := SubscriptionMessage{WsMessageHeader: WsMessageHeader{Type: SubscribeEventType}}
+		conn := dial(3, middleware.RoleViewer)
+		require.NoError(t, wsjson.Write(ctx, conn, subscription))
+		expectError(conn, ErrInvalidSubscription)
+		require.NoError(t, wsjson.Write(ctx, conn, subscription))
+		expectError(conn, ErrRateLimited)
+
+		presence := PresenceMessage{WsMessageHeader: WsMessageHeader{Type: PresenceEventType}}
+		conn = dial(3, middleware.RoleViewer)
+		require.NoError(t, wsjson.Write(ctx, conn, presence))
+		require.NoError(t, wsjson.Write(ctx, conn, presence))
+		expectError(conn, ErrRateLimited)
+	})
+}
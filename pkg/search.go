@@ -0,0 +1,46 @@
+package rtsync
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+const (
+	ErrInvalidQuery = "invalid search query"
+	ErrSearch       = "impossible to search"
+)
+
+func (rts *realTimeSyncServer) searchHandler(w http.ResponseWriter, r *http.Request) {
+	limit := service.DefaultSearchLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > 100 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+	results, err := rts.search.Search(r.Context(), workspaceID, r.URL.Query().Get("q"), limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, ErrInvalidQuery, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, ErrSearch, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,105 @@
+package rtsync
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_searchHandler(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	mockFileStorage.On("CreateObject", mock.Anything).Return("disk/note", nil)
+	res, file := testutils.DoRequest[repository.File](
+		t,
+		server,
+		http.MethodPost,
+		PathHttpApi+"/file",
+		CreateFileBody{Path: "note.md", Content: []byte("the quick brown fox")},
+		testutils.WithAuthHeader(options.JWTSecret, 1),
+	)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	search := func(query string) []service.SearchResult {
+		res, results := testutils.DoRequest[[]service.SearchResult](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/search?q="+query,
+			nil,
+			testutils.WithRoleAuthHeader(options.JWTSecret, 1, middleware.RoleViewer),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		return results
+	}
+
+	t.Run("should find the created files", func(t *testing.T) {
+		results := search("fox")
+		require.Len(t, results, 1)
+		assert.Equal(t, file.ID, results[0].FileID)
+		assert.Equal(t, []service.SearchHighlight{{Start: 16, End: 19}}, results[0].Highlights)
+	})
+
+	t.Run("should index the chunks once saved", func(t *testing.T) {
+		server.hub.workspace(file.WorkspaceID).files[file.ID] = FileWithContent{File: file, Content: "the quick brown fox"}
+		chunk := diff.DiffChunk{Position: 19, Type: diff.DiffAdd, Text: " jumps", Len: 6}
+		mockFileStorage.On("WriteObject", file.DiskPath, []byte("the quick brown fox jumps")).Return(nil)
+
+		require.NoError(t, server.onChunkMessage(ChunkMessage{
+			WsMessageHeader: WsMessageHeader{
+				FileId:      file.ID,
+				WorkspaceId: 1,
+				SenderRole:  middleware.RoleEditor,
+				Type:        ChunkEventType,
+			},
+			Chunks: []diff.DiffChunk{chunk},
+		}))
+		server.hub.pause()()
+
+		results := search("jumps")
+		require.Len(t, results, 1)
+		assert.Equal(t, "the quick brown fox jumps", results[0].Snippet)
+	})
+
+	t.Run("should refuse an empty query", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/search?q=",
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, 1),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidQuery, body)
+	})
+
+	t.Run("should be scoped to the workspace", func(t *testing.T) {
+		res, results := testutils.DoRequest[[]service.SearchResult](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/search?q=fox",
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, 2),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, results)
+	})
+}
@@ -1,15 +1,17 @@
 package rtsync
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
-	"golang.org/x/time/rate"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
 )
 
 const (
@@ -18,85 +20,181 @@ const (
 	PathWebSocket = ApiV1Prefix + "/sync"
 	PathHttpApi   = ApiV1Prefix + "/api"
 	PathHttpAuth  = ApiV1Prefix + "/auth"
+	PathHttpAdmin = ApiV1Prefix + "/admin"
+)
+
+const (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPingTimeout  = 10 * time.Second
+	// DefaultSlowGracePeriod is how long a sync client can stay behind
+	// before being disconnected
+	DefaultSlowGracePeriod = 30 * time.Second
 )
 
 type Options struct {
 	JWTSecret []byte
+	OIDC      OIDCOptions
+	// AdminToken authenticates the admin endpoints, which are disabled
+	// when it is empty
+	AdminToken string
+	// PingInterval is the interval between the pings to the sync clients,
+	// which are disconnected if they don't answer within PingTimeout.
+	// Defaults to DefaultPingInterval and DefaultPingTimeout, a negative
+	// interval disables the pings.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// SlowGracePeriod is how long a sync client can have messages waiting
+	// to be sent before being disconnected. Defaults to
+	// DefaultSlowGracePeriod, a negative period never disconnects.
+	SlowGracePeriod time.Duration
+	// ClientRateLimit and WorkspaceRateLimit limit the chunks and the
+	// events sent on the sync socket by each connection and by all the
+	// connections of a workspace. Default to DefaultClientRate,
+	// DefaultClientBurst, DefaultWorkspaceRate and DefaultWorkspaceBurst.
+	ClientRateLimit    RateLimit
+	WorkspaceRateLimit RateLimit
+	// MaxFilesInMemory is the number of files of each workspace kept in
+	// memory, the least recently used are evicted. Defaults to
+	// DefaultMaxFilesInMemory, a negative number never evicts.
+	MaxFilesInMemory int
+	// FlushIdle and FlushInterval are how long after its last edit, and at
+	// most after its first one, an edited file is saved. Default to
+	// DefaultFlushIdle and DefaultFlushInterval.
+	FlushIdle     time.Duration
+	FlushInterval time.Duration
 }
 
 type realTimeSyncServer struct {
 	ctx    context.Context
 	cancel context.CancelFunc
-	mut    sync.Mutex
-
-	jwtSecret []byte
-
-	publishLimiter *rate.Limiter
-	serverMux      *http.ServeMux
-	subscribersMu  sync.Mutex
-	subscribers    map[*subscriber]struct{}
-	files          map[int64]FileWithContent
-	storageQueue   chan ChunkMessage
-	eventQueue     chan EventMessage
-	storage        filestorage.Storage
-	db             *repository.Queries
+	hub    *hub
+
+	jwtSecret  []byte
+	adminToken string
+	oidc       *oidcAuthenticator
+	loginGuard *loginGuard
+	heartbeat  heartbeat
+	// slowGracePeriod is how long a subscriber can be behind
+	slowGracePeriod time.Duration
+	metrics         metrics
+
+	opsLimiter  *opsLimiter
+	serverMux   *http.ServeMux
+	storage     filestorage.Storage
+	db          *repository.Queries
+	workspaces  *service.WorkspaceService
+	users       *service.UserService
+	members     *service.MemberService
+	fsck        *service.FsckService
+	backup      *service.BackupService
+	fileService *service.FileService
+	search      *service.SearchService
+	index       *service.IndexService
+	links       *service.LinkService
+	metadata    *service.MetadataService
 }
 
-func New(db *repository.Queries, s filestorage.Storage, opts Options) *realTimeSyncServer {
+func New(db *sql.DB, s filestorage.Storage, opts Options) *realTimeSyncServer {
 	ctx, cancel := context.WithCancel(context.Background())
 	rts := &realTimeSyncServer{
 		ctx:    ctx,
 		cancel: cancel,
 
-		jwtSecret: opts.JWTSecret,
+		jwtSecret:  opts.JWTSecret,
+		adminToken: opts.AdminToken,
+		loginGuard: newLoginGuard(),
+		heartbeat: heartbeat{
+			interval: cmp.Or(opts.PingInterval, DefaultPingInterval),
+			timeout:  cmp.Or(opts.PingTimeout, DefaultPingTimeout),
+		},
+		slowGracePeriod: cmp.Or(opts.SlowGracePeriod, DefaultSlowGracePeriod),
+
+		serverMux: http.NewServeMux(),
+		opsLimiter: newOpsLimiter(
+			RateLimit{
+				Rate:  cmp.Or(opts.ClientRateLimit.Rate, DefaultClientRate),
+				Burst: cmp.Or(opts.ClientRateLimit.Burst, DefaultClientBurst),
+			},
+			RateLimit{
+				Rate:  cmp.Or(opts.WorkspaceRateLimit.Rate, DefaultWorkspaceRate),
+				Burst: cmp.Or(opts.WorkspaceRateLimit.Burst, DefaultWorkspaceBurst),
+			},
+		),
+		storage:     s,
+		db:          repository.New(db),
+		workspaces:  service.NewWorkspaceService(db, s),
+		users:       service.NewUserService(db),
+		members:     service.NewMemberService(db),
+		fsck:        service.NewFsckService(db, s),
+		backup:      service.NewBackupService(db, s),
+		fileService: service.NewFileService(db, s),
+		search:      service.NewSearchService(db),
+		index:       service.NewIndexService(db),
+		links:       service.NewLinkService(db),
+		metadata:    service.NewMetadataService(db),
+	}
+
+	rts.hub = newHub(
+		ctx,
+		cmp.Or(opts.MaxFilesInMemory, DefaultMaxFilesInMemory),
+		cmp.Or(opts.FlushIdle, DefaultFlushIdle),
+		cmp.Or(opts.FlushInterval, DefaultFlushInterval),
+		rts.saveFile,
+	)
 
-		serverMux:      http.NewServeMux(),
-		publishLimiter: rate.NewLimiter(rate.Every(100*time.Millisecond), 8),
-		subscribers:    make(map[*subscriber]struct{}),
-		files:          make(map[int64]FileWithContent),
-		storageQueue:   make(chan ChunkMessage, 128),
-		eventQueue:     make(chan EventMessage, 128),
-		storage:        s,
-		db:             db,
+	if opts.OIDC.Issuer != "" {
+		rts.oidc = newOIDCAuthenticator(opts.OIDC)
 	}
 
 	rts.init()
 
 	rts.serverMux.Handle(PathHttpApi+"/", http.StripPrefix(PathHttpApi, rts.apiHandler()))
 	rts.serverMux.Handle(PathHttpAuth+"/", http.StripPrefix(PathHttpAuth, rts.authHandler()))
-	rts.serverMux.HandleFunc(PathWebSocket, rts.wsHandler)
-
-	go rts.internalBusProcessor()
+	rts.serverMux.Handle(PathHttpAdmin+"/", http.StripPrefix(PathHttpAdmin, rts.adminHandler()))
+	rts.serverMux.Handle(PathWebSocket, rts.wsAuthHandler())
 
 	return rts
 }
 
+// init indexes the files created before the index, the content of the files
+// is loaded only when they're edited. A file which can't be read is reported
+// and skipped.
 func (rts *realTimeSyncServer) init() {
-	files, err := rts.db.FetchAllFiles(rts.ctx)
+	unindexed, err := rts.index.Unindexed(rts.ctx)
 	if err != nil {
-		log.Panicf("error while fetching all files, %v\n", err)
+		log.Panicf("error while fetching the files to index, %v\n", err)
 	}
 
-	for _, file := range files {
+	for _, file := range unindexed {
 		content, err := rts.storage.ReadObject(file.DiskPath)
 		if err != nil {
-			log.Panicf("error while reading file, %v\n", err)
+			log.Printf("error while reading file %d (%s), %v", file.ID, file.DiskPath, err)
+			continue
 		}
 
-		rts.files[file.ID] = FileWithContent{
-			File:    file,
-			Content: string(content),
+		if err := rts.index.Index(rts.ctx, file, string(content)); err != nil {
+			log.Panicf("error while indexing file, %v\n", err)
 		}
 	}
 }
 
+// Close stops the server and saves the edited files
 func (rts *realTimeSyncServer) Close() error {
-	if rts.ctx.Err() != nil {
-		rts.cancel()
-	}
+	rts.cancel()
+	rts.hub.pause()()
 	return nil
 }
 
+// saveFile writes the content of the file, a file deleted while being edited
+// is skipped
+func (rts *realTimeSyncServer) saveFile(file FileWithContent) error {
+	err := rts.fileService.Save(context.Background(), file.ID, []byte(file.Content))
+	if errors.Is(err, service.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
+
 func (rts *realTimeSyncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rts.serverMux.ServeHTTP(w, r)
 }
@@ -2,6 +2,7 @@ package rtsync
 
 import (
 	"context"
+	"io/fs"
 	"testing"
 
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
@@ -16,41 +17,91 @@ func TestNew(t *testing.T) {
 	db := testutils.CreateDB(t)
 	repo := repository.New(db)
 
-	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
-		DiskPath:      "disk_path",
-		WorkspacePath: "workspace_path",
-		MimeType:      "text/plain; charset=utf-8",
-		Hash:          "123",
-		WorkspaceID:   1,
-	})
-	require.NoError(t, err)
+	createFile := func(diskPath string) repository.File {
+		file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+			DiskPath:      diskPath,
+			WorkspacePath: diskPath + ".md",
+			MimeType:      "text/plain; charset=utf-8",
+			Hash:          "123",
+			WorkspaceID:   1,
+		})
+		require.NoError(t, err)
+		return file
+	}
+
+	file := createFile("disk_path")
+	other := createFile("other_path")
+	missing := createFile("missing_path")
 
 	fileContent := []byte("hello world!")
-	mockFileStorage.On("CreateObject", fileContent).Return(file.DiskPath, nil)
 	mockFileStorage.On("ReadObject", file.DiskPath).Return(fileContent, nil)
-
-	_, err = mockFileStorage.CreateObject(fileContent)
-	require.NoError(t, err)
+	mockFileStorage.On("ReadObject", other.DiskPath).Return([]byte("other"), nil)
+	mockFileStorage.On("ReadObject", missing.DiskPath).Return([]byte{}, fs.ErrNotExist)
 
 	var server *realTimeSyncServer
 	require.NotPanics(t, func() {
-		options := Options{JWTSecret: []byte("secret")}
-		server = New(repo, mockFileStorage, options)
+		options := Options{JWTSecret: []byte("secret"), MaxFilesInMemory: 1}
+		server = New(db, mockFileStorage, options)
 	})
 	t.Cleanup(func() { server.Close() })
 
-	assert.Len(t, server.files, 1)
-	assert.Equal(t, FileWithContent{
-		File: repository.File{
-			ID:            1,
-			DiskPath:      "disk_path",
-			WorkspacePath: "workspace_path",
-			MimeType:      "text/plain; charset=utf-8",
-			Hash:          "123",
-			WorkspaceID:   1,
-			CreatedAt:     server.files[file.ID].CreatedAt,
-			UpdatedAt:     server.files[file.ID].UpdatedAt,
-		},
-		Content: string(fileContent),
-	}, server.files[file.ID])
+	ws := server.hub.workspace(1)
+	assert.Empty(t, ws.files)
+
+	t.Run("should load the files on first use", func(t *testing.T) {
+		ws.mut.Lock()
+		defer ws.mut.Unlock()
+
+		loaded, err := server.loadFile(ws, file.ID)
+		require.NoError(t, err)
+		assert.Equal(t, FileWithContent{File: file, Content: string(fileContent)}, loaded)
+		assert.Equal(t, loaded, ws.files[file.ID])
+	})
+
+	t.Run("should report the missing objects", func(t *testing.T) {
+		ws.mut.Lock()
+		defer ws.mut.Unlock()
+
+		_, err := server.loadFile(ws, missing.ID)
+		assert.EqualError(t, err, ErrReadingFile)
+	})
+
+	t.Run("should not load the files of other workspaces", func(t *testing.T) {
+		ws := server.hub.workspace(2)
+		ws.mut.Lock()
+		defer ws.mut.Unlock()
+
+		_, err := server.loadFile(ws, file.ID)
+		assert.EqualError(t, err, ErrNotExistingFile)
+		assert.Empty(t, ws.files)
+	})
+
+	t.Run("should evict the least recently used files", func(t *testing.T) {
+		ws.mut.Lock()
+		defer ws.mut.Unlock()
+
+		_, err := server.loadFile(ws, other.ID)
+		require.NoError(t, err)
+		assert.Contains(t, ws.files, other.ID)
+		assert.NotContains(t, ws.files, file.ID)
+	})
+}
+
+func TestFileCache(t *testing.T) {
+	c := newFileCache(2)
+
+	c.touch(1)
+	c.touch(2)
+	c.touch(3)
+	c.touch(1)
+	assert.Equal(t, []int64{2}, c.overflow())
+
+	c.remove(2)
+	assert.Empty(t, c.overflow())
+
+	unlimited := newFileCache(-1)
+	for fileID := range int64(10) {
+		unlimited.touch(fileID)
+	}
+	assert.Empty(t, unlimited.overflow())
 }
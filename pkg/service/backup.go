@@ -0,0 +1,432 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Layout of a backup archive, a tar.gz with the database, the objects
+// under objects/ and the manifest as last entry
+const (
+	BackupVersion = 1
+
+	backupDatabase = "db.sqlite3"
+	backupManifest = "manifest.json"
+	backupObjects  = "objects/"
+)
+
+var (
+	ErrInvalidBackup   = errors.New("invalid backup")
+	ErrRestoreNotEmpty = errors.New("the restore destination is not empty")
+)
+
+// BackupEntry is a file of the archive with the sha256 of its content
+type BackupEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+type BackupManifest struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Database  BackupEntry   `json:"database"`
+	Objects   []BackupEntry `json:"objects"`
+}
+
+type BackupService struct {
+	sqlDB   *sql.DB
+	storage filestorage.Storage
+}
+
+func NewBackupService(db *sql.DB, s filestorage.Storage) *BackupService {
+	return &BackupService{
+		sqlDB:   db,
+		storage: s,
+	}
+}
+
+// BackupSnapshot is a copy of the database and of the objects it refers to,
+// taken in a temporary directory, from which the archive is written
+type BackupSnapshot struct {
+	dir       string
+	createdAt time.Time
+	diskPaths []string
+}
+
+// Backup writes to w a snapshot of the database and of the objects it refers
+// to. Writes to the objects must be stopped while it runs.
+func (bs *BackupService) Backup(ctx context.Context, w io.Writer) (BackupManifest, error) {
+	snapshot, err := bs.Snapshot(ctx)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer snapshot.Close()
+
+	return snapshot.Archive(w)
+}
+
+// Snapshot copies the database, with the SQLite online backup, and the
+// objects it refers to in a temporary directory, which takes as much disk
+// space as the storage. Writes to the objects must be stopped only while it
+// runs, not while the archive is written; Close removes the copy.
+func (bs *BackupService) Snapshot(ctx context.Context) (*BackupSnapshot, error) {
+	dir, err := os.MkdirTemp("", "backup-*")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &BackupSnapshot{dir: dir, createdAt: time.Now().UTC()}
+	if err := bs.snapshot(ctx, snapshot); err != nil {
+		return nil, errors.Join(err, snapshot.Close())
+	}
+	return snapshot, nil
+}
+
+func (bs *BackupService) snapshot(ctx context.Context, snapshot *BackupSnapshot) error {
+	dbPath := filepath.Join(snapshot.dir, backupDatabase)
+	if err := bs.snapshotDB(ctx, dbPath); err != nil {
+		return fmt.Errorf("snapshot of the database: %w", err)
+	}
+
+	var err error
+	snapshot.diskPaths, err = snapshotObjects(ctx, dbPath)
+	if err != nil {
+		return err
+	}
+
+	for i, diskPath := range snapshot.diskPaths {
+		content, err := bs.storage.ReadObject(diskPath)
+		if err != nil {
+			return fmt.Errorf("object %s: %w", diskPath, err)
+		}
+		if err := os.WriteFile(snapshot.objectPath(i), content, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectPath is where the i-th object is copied, disk paths can have
+// directories
+func (s *BackupSnapshot) objectPath(i int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("object-%d", i))
+}
+
+// Archive writes the snapshot to w as a tar.gz, with the manifest as last
+// entry so that an interrupted archive is refused by the restore
+func (s *BackupSnapshot) Archive(w io.Writer) (BackupManifest, error) {
+	manifest := BackupManifest{
+		Version:   BackupVersion,
+		CreatedAt: s.createdAt,
+		Objects:   []BackupEntry{},
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	dbContent, err := os.ReadFile(filepath.Join(s.dir, backupDatabase))
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Database, err = writeTarEntry(tw, backupDatabase, dbContent)
+	if err != nil {
+		return manifest, err
+	}
+
+	for i, diskPath := range s.diskPaths {
+		content, err := os.ReadFile(s.objectPath(i))
+		if err != nil {
+			return manifest, fmt.Errorf("object %s: %w", diskPath, err)
+		}
+
+		entry, err := writeTarEntry(tw, backupObjects+diskPath, content)
+		if err != nil {
+			return manifest, err
+		}
+		entry.Path = diskPath
+		manifest.Objects = append(manifest.Objects, entry)
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if _, err := writeTarEntry(tw, backupManifest, content); err != nil {
+		return manifest, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+// Close removes the copy
+func (s *BackupSnapshot) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// snapshotDB copies the database to dst with the SQLite online backup, which
+// is consistent even while other connections write
+func (bs *BackupService) snapshotDB(ctx context.Context, dst string) error {
+	dstDB, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	srcConn, err := bs.sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			dst, ok := dstDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("unsupported database driver")
+			}
+			src, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("unsupported database driver")
+			}
+
+			backup, err := dst.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+
+			if _, err := backup.Step(-1); err != nil {
+				return errors.Join(err, backup.Finish())
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// snapshotObjects returns the sorted disk paths of the files in the database
+// at dbPath
+func snapshotObjects(ctx context.Context, dbPath string) ([]string, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	files, err := repository.New(db).FetchAllFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(files))
+	diskPaths := make([]string, 0, len(files))
+	for _, file := range files {
+		if !seen[file.DiskPath] {
+			seen[file.DiskPath] = true
+			diskPaths = append(diskPaths, file.DiskPath)
+		}
+	}
+	sort.Strings(diskPaths)
+
+	return diskPaths, nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, content []byte) (BackupEntry, error) {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return BackupEntry{}, err
+	}
+
+	if _, err := tw.Write(content); err != nil {
+		return BackupEntry{}, err
+	}
+
+	return BackupEntry{
+		Path: name,
+		Size: int64(len(content)),
+		Hash: filestorage.GenerateHash(content),
+	}, nil
+}
+
+// Restore loads the backup read from r into dbPath and storageDir, which
+// must not exist or be empty. The archive is validated against its
+// manifest and the database against the objects; on failure everything
+// written is removed.
+func Restore(ctx context.Context, r io.Reader, dbPath, storageDir string) (manifest BackupManifest, err error) {
+	if _, err := os.Stat(dbPath); !errors.Is(err, os.ErrNotExist) {
+		return manifest, fmt.Errorf("%w: %s exists", ErrRestoreNotEmpty, dbPath)
+	}
+
+	entries, err := os.ReadDir(storageDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return manifest, err
+	}
+	if len(entries) > 0 {
+		return manifest, fmt.Errorf("%w: %s", ErrRestoreNotEmpty, storageDir)
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(dbPath)
+			os.RemoveAll(storageDir)
+		}
+	}()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	tr := tar.NewReader(gz)
+
+	written := make(map[string]BackupEntry)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+
+		var dst string
+		switch {
+		case header.Name == backupManifest:
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return manifest, fmt.Errorf("%w: manifest: %w", ErrInvalidBackup, err)
+			}
+			continue
+		case header.Name == backupDatabase:
+			dst = dbPath
+		case strings.HasPrefix(header.Name, backupObjects):
+			relativePath := strings.TrimPrefix(header.Name, backupObjects)
+			if !filepath.IsLocal(relativePath) || path.Clean(relativePath) != relativePath {
+				return manifest, fmt.Errorf("%w: invalid object path %q", ErrInvalidBackup, header.Name)
+			}
+			dst = filepath.Join(storageDir, relativePath)
+		default:
+			return manifest, fmt.Errorf("%w: unexpected entry %q", ErrInvalidBackup, header.Name)
+		}
+
+		entry, err := extractTarEntry(tr, dst)
+		if err != nil {
+			return manifest, err
+		}
+		written[header.Name] = entry
+	}
+
+	if err := validateBackup(manifest, written); err != nil {
+		return manifest, err
+	}
+
+	return manifest, validateRestoredFiles(ctx, dbPath, manifest)
+}
+
+func extractTarEntry(r io.Reader, dst string) (BackupEntry, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return BackupEntry{}, err
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return BackupEntry{}, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	if err := os.WriteFile(dst, content, 0o644); err != nil {
+		return BackupEntry{}, err
+	}
+
+	return BackupEntry{
+		Size: int64(len(content)),
+		Hash: filestorage.GenerateHash(content),
+	}, nil
+}
+
+// validateBackup checks that the archive contains exactly the entries of the
+// manifest, with the same content
+func validateBackup(manifest BackupManifest, written map[string]BackupEntry) error {
+	if manifest.Version == 0 {
+		return fmt.Errorf("%w: missing manifest", ErrInvalidBackup)
+	}
+	if manifest.Version > BackupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, manifest.Version)
+	}
+
+	expected := make(map[string]BackupEntry, len(manifest.Objects)+1)
+	expected[backupDatabase] = manifest.Database
+	for _, object := range manifest.Objects {
+		expected[backupObjects+object.Path] = object
+	}
+
+	if len(expected) != len(written) {
+		return fmt.Errorf("%w: %d entries expected, %d found", ErrInvalidBackup, len(expected), len(written))
+	}
+
+	for name, entry := range expected {
+		got, ok := written[name]
+		if !ok {
+			return fmt.Errorf("%w: missing %s", ErrInvalidBackup, name)
+		}
+		if got.Size != entry.Size || got.Hash != entry.Hash {
+			return fmt.Errorf("%w: %s doesn't match the manifest", ErrInvalidBackup, name)
+		}
+	}
+
+	return nil
+}
+
+// validateRestoredFiles checks that every file of the restored database has
+// its object
+func validateRestoredFiles(ctx context.Context, dbPath string, manifest BackupManifest) error {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	files, err := repository.New(db).FetchAllFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	objects := make(map[string]bool, len(manifest.Objects))
+	for _, object := range manifest.Objects {
+		objects[object.Path] = true
+	}
+
+	for _, file := range files {
+		if !objects[file.DiskPath] {
+			return fmt.Errorf("%w: missing object of %s", ErrInvalidBackup, file.WorkspacePath)
+		}
+	}
+
+	return nil
+}
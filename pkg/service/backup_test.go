@@ -0,0 +1,174 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestBackupService(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	disk := filestorage.NewDisk(t.TempDir())
+
+	contents := map[string]string{"a.md": "first note", "dir/b.md": "second note"}
+	for workspacePath, content := range contents {
+		diskPath, err := disk.CreateObject([]byte(content))
+		require.NoError(t, err)
+		_, err = repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      diskPath,
+			WorkspacePath: workspacePath,
+			MimeType:      "text/plain",
+			Hash:          filestorage.GenerateHash([]byte(content)),
+			WorkspaceID:   1,
+		})
+		require.NoError(t, err)
+	}
+
+	// orphaned objects are not backed up
+	_, err := disk.CreateObject([]byte("orphan"))
+	require.NoError(t, err)
+
+	var archive bytes.Buffer
+	manifest, err := NewBackupService(db, disk).Backup(ctx, &archive)
+	require.NoError(t, err)
+	assert.Equal(t, BackupVersion, manifest.Version)
+	assert.Len(t, manifest.Objects, 2)
+
+	t.Run("should restore the backup", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "data", "db.sqlite3")
+		storageDir := filepath.Join(dir, "data")
+
+		restored, err := Restore(ctx, bytes.NewReader(archive.Bytes()), dbPath, storageDir)
+		require.NoError(t, err)
+		assert.Equal(t, manifest.Database, restored.Database)
+
+		restoredDB, err := sql.Open("sqlite3", dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { restoredDB.Close() })
+
+		files, err := repository.New(restoredDB).FetchAllFiles(ctx)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+
+		restoredDisk := filestorage.NewDisk(storageDir)
+		for _, file := range files {
+			content, err := restoredDisk.ReadObject(file.DiskPath)
+			require.NoError(t, err)
+			assert.Equal(t, contents[file.WorkspacePath], string(content))
+		}
+
+		// the destination is not empty anymore
+		_, err = Restore(ctx, bytes.NewReader(archive.Bytes()), filepath.Join(dir, "other.sqlite3"), storageDir)
+		assert.ErrorIs(t, err, ErrRestoreNotEmpty)
+	})
+
+	t.Run("should refuse a tampered backup", func(t *testing.T) {
+		tampered := rewriteArchive(t, archive.Bytes(), func(name string, content []byte) []byte {
+			if name == backupObjects+manifest.Objects[0].Path {
+				return []byte("tampered")
+			}
+			return content
+		})
+
+		storageDir := filepath.Join(t.TempDir(), "data")
+		_, err := Restore(ctx, bytes.NewReader(tampered), filepath.Join(storageDir, "db.sqlite3"), storageDir)
+		assert.ErrorIs(t, err, ErrInvalidBackup)
+
+		_, err = os.Stat(storageDir)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("should refuse a truncated backup", func(t *testing.T) {
+		truncated := rewriteArchive(t, archive.Bytes(), func(name string, content []byte) []byte {
+			if name == backupManifest {
+				return nil
+			}
+			return content
+		})
+
+		storageDir := filepath.Join(t.TempDir(), "data")
+		_, err := Restore(ctx, bytes.NewReader(truncated), filepath.Join(storageDir, "db.sqlite3"), storageDir)
+		assert.ErrorIs(t, err, ErrInvalidBackup)
+	})
+
+	t.Run("should archive the snapshot once the writes resumed", func(t *testing.T) {
+		snapshot, err := NewBackupService(db, disk).Snapshot(ctx)
+		require.NoError(t, err)
+
+		files, err := repo.FetchAllFiles(ctx)
+		require.NoError(t, err)
+		require.NoError(t, disk.WriteObject(files[0].DiskPath, []byte("changed")))
+		require.NoError(t, disk.DeleteObject(files[1].DiskPath))
+
+		var archive bytes.Buffer
+		_, err = snapshot.Archive(&archive)
+		require.NoError(t, err)
+		require.NoError(t, snapshot.Close())
+		assert.NoDirExists(t, snapshot.dir)
+
+		storageDir := filepath.Join(t.TempDir(), "data")
+		_, err = Restore(ctx, &archive, filepath.Join(storageDir, "db.sqlite3"), storageDir)
+		require.NoError(t, err)
+
+		restoredDisk := filestorage.NewDisk(storageDir)
+		for _, file := range files {
+			content, err := restoredDisk.ReadObject(file.DiskPath)
+			require.NoError(t, err)
+			assert.Equal(t, contents[file.WorkspacePath], string(content))
+		}
+	})
+}
+
+// rewriteArchive returns a copy of the archive with the content returned by
+// fn, entries are dropped if it returns nil
+func rewriteArchive(t *testing.T, archive []byte, fn func(name string, content []byte) []byte) []byte {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		content = fn(header.Name, content)
+		if content == nil {
+			continue
+		}
+
+		header.Size = int64(len(content))
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(content)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return out.Bytes()
+}
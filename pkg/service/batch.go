@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+)
+
+// Operations of a batch
+const (
+	BatchCreate = "create"
+	BatchRename = "rename"
+	BatchDelete = "delete"
+	BatchUpdate = "update"
+)
+
+// Status of an operation of a batch
+const (
+	BatchApplied    = "applied"
+	BatchFailed     = "failed"
+	BatchRolledBack = "rolledBack"
+	BatchSkipped    = "skipped"
+)
+
+// MaxBatchOperations is the maximum number of operations of a batch
+const MaxBatchOperations = 1000
+
+var (
+	ErrBatchFailed      = errors.New("batch failed")
+	ErrInvalidOperation = errors.New("invalid operation")
+	ErrDuplicatePath    = errors.New("path already exists")
+)
+
+// BatchOperation creates a file with Path and Content, renames the file
+// FileID to Path, deletes it or replaces its Content
+type BatchOperation struct {
+	Op      string `json:"op"`
+	FileID  int64  `json:"fileId,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Content []byte `json:"content,omitempty"`
+}
+
+// BatchResult is the outcome of an operation, File is the file once the
+// operation is applied or, for a deletion, the deleted one
+type BatchResult struct {
+	Op     string           `json:"op"`
+	Status string           `json:"status"`
+	File   *repository.File `json:"file,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// Batch applies the operations in a single transaction. If one fails
+// nothing is applied, the objects created are deleted and ErrBatchFailed is
+// returned with the results; the objects replaced or deleted are deleted
+// only once the transaction is committed.
+func (fs *FileService) Batch(ctx context.Context, workspaceID int64, ops []BatchOperation) ([]BatchResult, error) {
+	if len(ops) > MaxBatchOperations {
+		return nil, fmt.Errorf("%w: more than %d operations", ErrInvalidOperation, MaxBatchOperations)
+	}
+
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = BatchResult{Op: op.Op, Status: BatchSkipped}
+	}
+
+	var created, replaced []string
+	err := withTx(ctx, fs.sqlDB, func(q *repository.Queries) error {
+		for i, op := range ops {
+			file, obsolete, err := fs.applyOperation(ctx, q, workspaceID, op, &created)
+			if err != nil {
+				for j := range i {
+					results[j].Status = BatchRolledBack
+				}
+				results[i].Status = BatchFailed
+				results[i].Error = err.Error()
+				return fmt.Errorf("%w: operation %d: %w", ErrBatchFailed, i, err)
+			}
+
+			if obsolete != "" {
+				replaced = append(replaced, obsolete)
+			}
+			results[i].Status = BatchApplied
+			results[i].File = &file
+		}
+		return nil
+	})
+	if err != nil {
+		for _, diskPath := range created {
+			if err := fs.storage.DeleteObject(diskPath); err != nil {
+				log.Printf("error while deleting object %s of a failed batch, %v\n", diskPath, err)
+			}
+		}
+		return results, err
+	}
+
+	for _, diskPath := range replaced {
+		if err := fs.storage.DeleteObject(diskPath); err != nil {
+			log.Printf("error while deleting object %s, %v\n", diskPath, err)
+		}
+	}
+
+	return results, nil
+}
+
+// applyOperation returns the file and the object to delete once the
+// transaction is committed, if any. The objects created are appended to
+// created.
+func (fs *FileService) applyOperation(
+	ctx context.Context,
+	q *repository.Queries,
+	workspaceID int64,
+	op BatchOperation,
+	created *[]string,
+) (repository.File, string, error) {
+	switch op.Op {
+	case BatchCreate:
+		if err := checkPathAvailable(ctx, q, workspaceID, op.Path); err != nil {
+			return repository.File{}, "", err
+		}
+
+		diskPath, err := fs.storage.CreateObject(op.Content)
+		if err != nil {
+			return repository.File{}, "", err
+		}
+		*created = append(*created, diskPath)
+
+		file, err := q.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      diskPath,
+			WorkspacePath: op.Path,
+			MimeType:      http.DetectContentType(op.Content),
+			Hash:          filestorage.GenerateHash(op.Content),
+			WorkspaceID:   workspaceID,
+		})
+		if err != nil {
+			return file, "", err
+		}
+
+		return file, "", indexFile(ctx, q, file, string(op.Content))
+	case BatchRename:
+		if _, err := fetchFile(ctx, q, workspaceID, op.FileID); err != nil {
+			return repository.File{}, "", err
+		}
+		if err := checkPathAvailable(ctx, q, workspaceID, op.Path); err != nil {
+			return repository.File{}, "", err
+		}
+
+		err := q.UpdateWorkspacePath(ctx, repository.UpdateWorkspacePathParams{
+			WorkspacePath: op.Path,
+			ID:            op.FileID,
+		})
+		if err != nil {
+			return repository.File{}, "", err
+		}
+
+		file, err := q.FetchFile(ctx, op.FileID)
+		return file, "", err
+	case BatchDelete:
+		file, err := fetchFile(ctx, q, workspaceID, op.FileID)
+		if err != nil {
+			return file, "", err
+		}
+
+		return file, file.DiskPath, q.DeleteFile(ctx, file.ID)
+	case BatchUpdate:
+		file, err := fetchFile(ctx, q, workspaceID, op.FileID)
+		if err != nil {
+			return file, "", err
+		}
+
+		diskPath, err := fs.storage.CreateObject(op.Content)
+		if err != nil {
+			return file, "", err
+		}
+		*created = append(*created, diskPath)
+
+		err = q.UpdateDiskPath(ctx, repository.UpdateDiskPathParams{
+			DiskPath: diskPath,
+			Hash:     filestorage.GenerateHash(op.Content),
+			ID:       file.ID,
+		})
+		if err != nil {
+			return file, "", err
+		}
+
+		updated, err := q.FetchFile(ctx, file.ID)
+		if err != nil {
+			return updated, "", err
+		}
+
+		return updated, file.DiskPath, indexFile(ctx, q, updated, string(op.Content))
+	default:
+		return repository.File{}, "", fmt.Errorf("%w %q", ErrInvalidOperation, op.Op)
+	}
+}
+
+// fetchFile returns the file if it belongs to the workspace
+func fetchFile(ctx context.Context, q *repository.Queries, workspaceID, fileID int64) (repository.File, error) {
+	file, err := q.FetchFile(ctx, fileID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && file.WorkspaceID != workspaceID) {
+		return repository.File{}, ErrFileNotFound
+	}
+	return file, err
+}
+
+func checkPathAvailable(ctx context.Context, q *repository.Queries, workspaceID int64, path string) error {
+	if path == "" {
+		return ErrInvalidPath
+	}
+
+	_, err := q.FetchWorkspaceFile(ctx, repository.FetchWorkspaceFileParams{
+		WorkspaceID:   workspaceID,
+		WorkspacePath: path,
+	})
+	switch {
+	case err == nil:
+		return ErrDuplicatePath
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	default:
+		return err
+	}
+}
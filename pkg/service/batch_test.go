@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFileServiceBatch(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	disk := filestorage.NewDisk(t.TempDir())
+	fs := NewFileService(db, disk)
+
+	createFile := func(workspaceID int64, path, content string) repository.File {
+		diskPath, err := disk.CreateObject([]byte(content))
+		require.NoError(t, err)
+		file, err := repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      diskPath,
+			WorkspacePath: path,
+			Hash:          filestorage.GenerateHash([]byte(content)),
+			WorkspaceID:   workspaceID,
+		})
+		require.NoError(t, err)
+		return file
+	}
+
+	toRename := createFile(1, "old/note.md", "note")
+	toDelete := createFile(1, "attachment.png", "image")
+	toUpdate := createFile(1, "todo.md", "todo")
+	other := createFile(2, "other.md", "other")
+
+	t.Run("should roll back everything if an operation fails", func(t *testing.T) {
+		objects, err := disk.ListObjects()
+		require.NoError(t, err)
+
+		results, err := fs.Batch(ctx, 1, []BatchOperation{
+			{Op: BatchCreate, Path: "created.md", Content: []byte("created")},
+			{Op: BatchUpdate, FileID: toUpdate.ID, Content: []byte("done")},
+			{Op: BatchDelete, FileID: other.ID},
+			{Op: BatchRename, FileID: toRename.ID, Path: "new/note.md"},
+		})
+		assert.ErrorIs(t, err, ErrBatchFailed)
+		assert.Equal(t, BatchRolledBack, results[0].Status)
+		assert.Equal(t, BatchRolledBack, results[1].Status)
+		assert.Equal(t, BatchFailed, results[2].Status)
+		assert.Equal(t, ErrFileNotFound.Error(), results[2].Error)
+		assert.Equal(t, BatchSkipped, results[3].Status)
+
+		_, err = fs.Fetch(ctx, 1, "created.md")
+		assert.ErrorIs(t, err, ErrFileNotFound)
+		_, content, err := fs.Read(ctx, 1, "todo.md")
+		require.NoError(t, err)
+		assert.Equal(t, "todo", string(content))
+
+		after, err := disk.ListObjects()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, objects, after)
+	})
+
+	t.Run("should refuse duplicated paths, also within the batch", func(t *testing.T) {
+		results, err := fs.Batch(ctx, 1, []BatchOperation{
+			{Op: BatchCreate, Path: "created.md"},
+			{Op: BatchRename, FileID: toRename.ID, Path: "created.md"},
+		})
+		assert.ErrorIs(t, err, ErrBatchFailed)
+		assert.Equal(t, ErrDuplicatePath.Error(), results[1].Error)
+
+		results, err = fs.Batch(ctx, 1, []BatchOperation{{Op: "move"}})
+		assert.ErrorIs(t, err, ErrBatchFailed)
+		assert.Equal(t, BatchFailed, results[0].Status)
+	})
+
+	t.Run("should apply all the operations", func(t *testing.T) {
+		results, err := fs.Batch(ctx, 1, []BatchOperation{
+			{Op: BatchCreate, Path: "created.md", Content: []byte("created")},
+			{Op: BatchRename, FileID: toRename.ID, Path: "new/note.md"},
+			{Op: BatchDelete, FileID: toDelete.ID},
+			{Op: BatchUpdate, FileID: toUpdate.ID, Content: []byte("done")},
+		})
+		require.NoError(t, err)
+		for _, result := range results {
+			assert.Equal(t, BatchApplied, result.Status)
+		}
+
+		_, content, err := fs.Read(ctx, 1, "created.md")
+		require.NoError(t, err)
+		assert.Equal(t, "created", string(content))
+
+		renamed, err := fs.Fetch(ctx, 1, "new/note.md")
+		require.NoError(t, err)
+		assert.Equal(t, toRename.ID, renamed.ID)
+
+		_, err = fs.Fetch(ctx, 1, "attachment.png")
+		assert.ErrorIs(t, err, ErrFileNotFound)
+		_, err = disk.ReadObject(toDelete.DiskPath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		updated, content, err := fs.Read(ctx, 1, "todo.md")
+		require.NoError(t, err)
+		assert.Equal(t, "done", string(content))
+		assert.Equal(t, filestorage.GenerateHash([]byte("done")), updated.Hash)
+		_, err = disk.ReadObject(toUpdate.DiskPath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
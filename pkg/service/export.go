@@ -0,0 +1,136 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"time"
+)
+
+// Formats of the exported vault archives
+const (
+	ExportZip   = "zip"
+	ExportTarGz = "tar.gz"
+)
+
+var ErrInvalidFormat = errors.New("invalid export format")
+
+// vaultWriter adds the files to an archive
+type vaultWriter interface {
+	add(name string, modTime time.Time, content []byte) error
+	Close() error
+}
+
+// Export writes to w the files of the workspace laid out by their workspace
+// path, as a zip or tar.gz archive. contentOf, if set, returns the content
+// of the files still to be persisted.
+func (fs *FileService) Export(
+	ctx context.Context,
+	workspaceID int64,
+	w io.Writer,
+	format string,
+	contentOf func(fileID int64) (string, bool),
+) error {
+	var vw vaultWriter
+	switch format {
+	case ExportZip:
+		vw = zipVaultWriter{zip.NewWriter(w)}
+	case ExportTarGz:
+		gz := gzip.NewWriter(w)
+		vw = tarVaultWriter{tar.NewWriter(gz), gz}
+	default:
+		return ErrInvalidFormat
+	}
+
+	files, err := fs.List(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		var content []byte
+		if c, ok := lookupContent(contentOf, file.ID); ok {
+			content = []byte(c)
+		} else {
+			content, err = fs.storage.ReadObject(file.DiskPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		name := vaultPath(file.WorkspacePath)
+		if names[name] {
+			name = conflictPath(name, file.ID)
+		}
+		names[name] = true
+
+		if err := vw.add(name, file.UpdatedAt, content); err != nil {
+			return err
+		}
+	}
+
+	return vw.Close()
+}
+
+func lookupContent(contentOf func(int64) (string, bool), fileID int64) (string, bool) {
+	if contentOf == nil {
+		return "", false
+	}
+	return contentOf(fileID)
+}
+
+// vaultPath returns the workspace path relative to the root of the archive,
+// so that it can't be extracted outside of it
+func vaultPath(workspacePath string) string {
+	return path.Clean("/" + workspacePath)[1:]
+}
+
+type zipVaultWriter struct {
+	*zip.Writer
+}
+
+func (zw zipVaultWriter) add(name string, modTime time.Time, content []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+type tarVaultWriter struct {
+	*tar.Writer
+	gz *gzip.Writer
+}
+
+func (tw tarVaultWriter) add(name string, modTime time.Time, content []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(content)
+	return err
+}
+
+func (tw tarVaultWriter) Close() error {
+	if err := tw.Writer.Close(); err != nil {
+		return err
+	}
+	return tw.gz.Close()
+}
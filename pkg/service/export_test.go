@@ -0,0 +1,99 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFileServiceExport(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	fs := NewFileService(db, mockFileStorage)
+
+	files := []repository.CreateFileParams{
+		{DiskPath: "disk/1", WorkspacePath: "note.md", WorkspaceID: 1},
+		{DiskPath: "disk/2", WorkspacePath: "../dir/pending.md", WorkspaceID: 1},
+		{DiskPath: "disk/3", WorkspacePath: "note.md", WorkspaceID: 1},
+		{DiskPath: "disk/4", WorkspacePath: "other.md", WorkspaceID: 2},
+	}
+	ids := make([]int64, len(files))
+	for i, params := range files {
+		file, err := repo.CreateFile(ctx, params)
+		require.NoError(t, err)
+		ids[i] = file.ID
+	}
+
+	mockFileStorage.On("ReadObject", "disk/1").Return([]byte("stored"), nil)
+	mockFileStorage.On("ReadObject", "disk/3").Return([]byte("duplicate"), nil)
+
+	contentOf := func(fileID int64) (string, bool) {
+		return "in memory", fileID == ids[1]
+	}
+
+	expected := map[string]string{
+		"note.md":                       "stored",
+		"dir/pending.md":                "in memory",
+		conflictPath("note.md", ids[2]): "duplicate",
+	}
+
+	t.Run("should export a zip", func(t *testing.T) {
+		var archive bytes.Buffer
+		require.NoError(t, fs.Export(ctx, 1, &archive, ExportZip, contentOf))
+
+		zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+		require.NoError(t, err)
+
+		got := make(map[string]string)
+		for _, f := range zr.File {
+			r, err := f.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(r)
+			require.NoError(t, err)
+			got[f.Name] = string(content)
+		}
+		assert.Equal(t, expected, got)
+	})
+
+	t.Run("should export a tar.gz", func(t *testing.T) {
+		var archive bytes.Buffer
+		require.NoError(t, fs.Export(ctx, 1, &archive, ExportTarGz, contentOf))
+
+		gr, err := gzip.NewReader(&archive)
+		require.NoError(t, err)
+		tr := tar.NewReader(gr)
+
+		got := make(map[string]string)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			got[header.Name] = string(content)
+		}
+		assert.Equal(t, expected, got)
+	})
+
+	t.Run("should refuse an unknown format", func(t *testing.T) {
+		assert.ErrorIs(t, fs.Export(ctx, 1, io.Discard, "rar", nil), ErrInvalidFormat)
+	})
+
+	mockFileStorage.AssertExpectations(t)
+}
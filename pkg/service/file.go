@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+)
+
+// FileService accesses the files directly in the database and the storage,
+// bypassing the in-memory state of a running server
+type FileService struct {
+	sqlDB   *sql.DB
+	db      *repository.Queries
+	storage filestorage.Storage
+}
+
+func NewFileService(db *sql.DB, s filestorage.Storage) *FileService {
+	return &FileService{
+		sqlDB:   db,
+		db:      repository.New(db),
+		storage: s,
+	}
+}
+
+func (fs *FileService) List(ctx context.Context, workspaceID int64) ([]repository.File, error) {
+	return fs.db.FetchFiles(ctx, workspaceID)
+}
+
+func (fs *FileService) Fetch(ctx context.Context, workspaceID int64, path string) (repository.File, error) {
+	file, err := fs.db.FetchWorkspaceFile(ctx, repository.FetchWorkspaceFileParams{
+		WorkspaceID:   workspaceID,
+		WorkspacePath: path,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return file, ErrFileNotFound
+	}
+	return file, err
+}
+
+// Read returns the file with its content
+func (fs *FileService) Read(ctx context.Context, workspaceID int64, path string) (repository.File, []byte, error) {
+	file, err := fs.Fetch(ctx, workspaceID, path)
+	if err != nil {
+		return file, nil, err
+	}
+
+	content, err := fs.storage.ReadObject(file.DiskPath)
+	return file, content, err
+}
+
+// Delete deletes the file and then its object, as Delete of WorkspaceService
+func (fs *FileService) Delete(ctx context.Context, workspaceID int64, path string) error {
+	file, err := fs.Fetch(ctx, workspaceID, path)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.db.DeleteFile(ctx, file.ID); err != nil {
+		return err
+	}
+
+	return fs.storage.DeleteObject(file.DiskPath)
+}
+
+// Save replaces the content of the file, then updates its hash and its
+// indexes in a single transaction
+func (fs *FileService) Save(ctx context.Context, fileID int64, content []byte) error {
+	file, err := fs.db.FetchFile(ctx, fileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fs.storage.WriteObject(file.DiskPath, content); err != nil {
+		return err
+	}
+
+	return withTx(ctx, fs.sqlDB, func(q *repository.Queries) error {
+		err := q.UpdateFileHash(ctx, repository.UpdateFileHashParams{
+			Hash: filestorage.GenerateHash(content),
+			ID:   file.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return indexFile(ctx, q, file, string(content))
+	})
+}
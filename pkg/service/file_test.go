@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFileService(t *testing.T) {
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	fs := NewFileService(db, mockFileStorage)
+	ctx := context.Background()
+
+	// the same path in two workspaces
+	for _, workspaceID := range []int64{1, 2} {
+		_, err := repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      "disk/" + string(rune('0'+workspaceID)),
+			WorkspacePath: "note.md",
+			MimeType:      "text/plain",
+			Hash:          "hash",
+			WorkspaceID:   workspaceID,
+		})
+		require.NoError(t, err)
+	}
+
+	mockFileStorage.On("ReadObject", "disk/2").Return([]byte("content"), nil)
+	file, content, err := fs.Read(ctx, 2, "note.md")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), file.WorkspaceID)
+	assert.Equal(t, "content", string(content))
+
+	mockFileStorage.On("WriteObject", "disk/2", []byte("new content")).Return(nil)
+	require.NoError(t, fs.Save(ctx, file.ID, []byte("new content")))
+	saved, err := repo.FetchFile(ctx, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, filestorage.GenerateHash([]byte("new content")), saved.Hash)
+	assert.ErrorIs(t, fs.Save(ctx, 42, []byte("new content")), ErrFileNotFound)
+
+	mockFileStorage.On("DeleteObject", "disk/1").Return(nil)
+	require.NoError(t, fs.Delete(ctx, 1, "note.md"))
+	assert.ErrorIs(t, fs.Delete(ctx, 1, "note.md"), ErrFileNotFound)
+
+	files, err := fs.List(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	mockFileStorage.AssertExpectations(t)
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+)
+
+const (
+	FsckDeleted     = "deleted"
+	FsckRestored    = "restored"
+	FsckRenamed     = "renamed"
+	FsckQuarantined = "quarantined"
+)
+
+type FsckOptions struct {
+	// Repair fixes the issues: missing and corrupted objects are restored
+	// from Content, orphaned objects are deleted and duplicated paths are
+	// renamed. The files whose content isn't known are only reported.
+	Repair bool
+	// DeleteMissing repairs deleting the files whose object is missing and
+	// can't be restored from Content
+	DeleteMissing bool
+	// Quarantine repairs moving orphaned objects out of the storage instead,
+	// with the corrupted ones which can't be restored from Content, whose
+	// files are deleted
+	Quarantine bool
+	// Content returns the up-to-date content of a file, if known
+	Content func(fileID int64) (string, bool)
+}
+
+// FsckIssue is an inconsistency found, Action is what has been done to fix
+// it, if anything
+type FsckIssue struct {
+	FileID        int64  `json:"fileId,omitempty"`
+	WorkspaceID   int64  `json:"workspaceId,omitempty"`
+	WorkspacePath string `json:"workspacePath,omitempty"`
+	DiskPath      string `json:"diskPath"`
+	Action        string `json:"action,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type FsckReport struct {
+	Files      int         `json:"files"`
+	Objects    int         `json:"objects"`
+	Missing    []FsckIssue `json:"missing"`
+	Orphaned   []FsckIssue `json:"orphaned"`
+	Corrupted  []FsckIssue `json:"corrupted"`
+	Duplicates []FsckIssue `json:"duplicates"`
+}
+
+// Clean reports whether no issue has been found
+func (r FsckReport) Clean() bool {
+	return len(r.Missing) == 0 && len(r.Orphaned) == 0 && len(r.Corrupted) == 0 && len(r.Duplicates) == 0
+}
+
+// ChangedFiles returns the ids of the files deleted or updated by the
+// repair
+func (r FsckReport) ChangedFiles() []int64 {
+	var ids []int64
+	for _, issues := range [][]FsckIssue{r.Missing, r.Corrupted, r.Duplicates} {
+		for _, issue := range issues {
+			if issue.FileID != 0 && issue.Action != "" {
+				ids = append(ids, issue.FileID)
+			}
+		}
+	}
+	return ids
+}
+
+type FsckService struct {
+	db      *repository.Queries
+	storage filestorage.Storage
+}
+
+func NewFsckService(db *sql.DB, s filestorage.Storage) *FsckService {
+	return &FsckService{
+		db:      repository.New(db),
+		storage: s,
+	}
+}
+
+// Run checks the database against the storage and repairs the issues found,
+// if asked to. Writes to the files must be stopped while it runs.
+func (fk *FsckService) Run(ctx context.Context, opts FsckOptions) (FsckReport, error) {
+	report, err := fk.Check(ctx)
+	if err != nil || !(opts.Repair || opts.Quarantine) {
+		return report, err
+	}
+
+	return fk.Repair(ctx, report, opts), nil
+}
+
+// Check checks that every file has an object matching its hash, that every
+// object belongs to a file and that paths are unique in each workspace. It
+// doesn't change anything and can run along the writes: an issue found may
+// be a write in progress, Repair checks them again.
+func (fk *FsckService) Check(ctx context.Context) (FsckReport, error) {
+	report := FsckReport{
+		Missing:   []FsckIssue{},
+		Orphaned:  []FsckIssue{},
+		Corrupted: []FsckIssue{},
+	}
+
+	// the objects are listed first, so that the ones created meanwhile
+	// aren't taken for orphans
+	objects, err := fk.storage.ListObjects()
+	if err != nil {
+		return report, err
+	}
+	report.Objects = len(objects)
+
+	files, err := fk.db.FetchAllFiles(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Files = len(files)
+
+	referenced := make(map[string]bool, len(files))
+	for _, file := range files {
+		referenced[file.DiskPath] = true
+	}
+
+	for _, object := range objects {
+		if !referenced[object] {
+			report.Orphaned = append(report.Orphaned, FsckIssue{DiskPath: object})
+		}
+	}
+
+	remaining := make([]repository.File, 0, len(files))
+	for _, file := range files {
+		issue := fileIssue(file)
+
+		content, err := fk.storage.ReadObject(file.DiskPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			report.Missing = append(report.Missing, issue)
+		case err != nil:
+			report.Corrupted = append(report.Corrupted, withError(issue, err))
+		case filestorage.GenerateHash(content) != file.Hash:
+			report.Corrupted = append(report.Corrupted, issue)
+		default:
+			remaining = append(remaining, file)
+		}
+	}
+
+	report.Duplicates = checkDuplicates(remaining)
+
+	return report, nil
+}
+
+// Repair fixes the issues of the report, which are checked again first:
+// the ones fixed meanwhile are left without an action. Writes to the files
+// must be stopped while it runs.
+func (fk *FsckService) Repair(ctx context.Context, report FsckReport, opts FsckOptions) FsckReport {
+	for i, issue := range report.Orphaned {
+		var err error
+		switch {
+		case !fk.isOrphaned(ctx, issue.DiskPath):
+		case opts.Quarantine:
+			issue.Action, err = FsckQuarantined, fk.storage.QuarantineObject(issue.DiskPath)
+		default:
+			issue.Action, err = FsckDeleted, fk.storage.DeleteObject(issue.DiskPath)
+		}
+		report.Orphaned[i] = withError(issue, err)
+	}
+
+	for i, issue := range report.Missing {
+		file, _, err := fk.current(ctx, issue)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			issue.Action, err = fk.repairMissing(ctx, file, opts)
+		case err == nil || errors.Is(err, errFsckChanged):
+			// saved or deleted meanwhile
+			err = nil
+		}
+		report.Missing[i] = withError(issue, err)
+	}
+
+	for i, issue := range report.Corrupted {
+		// the objects which can't be read are only reported
+		if issue.Error != "" {
+			continue
+		}
+
+		file, stored, err := fk.current(ctx, issue)
+		switch {
+		case err == nil && filestorage.GenerateHash(stored) != file.Hash:
+			issue.Action, err = fk.repairCorrupted(ctx, file, opts)
+		case err == nil || errors.Is(err, errFsckChanged):
+			err = nil
+		}
+		report.Corrupted[i] = withError(issue, err)
+	}
+
+	for i, issue := range report.Duplicates {
+		file, err := fk.db.FetchFile(ctx, issue.FileID)
+		if err == nil && file.WorkspacePath == issue.WorkspacePath {
+			issue.Action, err = FsckRenamed, fk.db.UpdateWorkspacePath(ctx, repository.UpdateWorkspacePathParams{
+				WorkspacePath: conflictPath(file.WorkspacePath, file.ID),
+				ID:            file.ID,
+			})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		report.Duplicates[i] = withError(issue, err)
+	}
+
+	return report
+}
+
+// errFsckChanged is returned when a file changed since the check
+var errFsckChanged = errors.New("file changed since the check")
+
+// current returns the file of the issue and its object as they are now, an
+// error wrapping fs.ErrNotExist if the object is missing
+func (fk *FsckService) current(ctx context.Context, issue FsckIssue) (repository.File, []byte, error) {
+	file, err := fk.db.FetchFile(ctx, issue.FileID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && file.DiskPath != issue.DiskPath) {
+		return file, nil, errFsckChanged
+	}
+	if err != nil {
+		return file, nil, err
+	}
+
+	stored, err := fk.storage.ReadObject(file.DiskPath)
+	return file, stored, err
+}
+
+// isOrphaned reports whether no file refers to the object
+func (fk *FsckService) isOrphaned(ctx context.Context, diskPath string) bool {
+	referenced, err := fk.db.CountFilesByDiskPath(ctx, diskPath)
+	return err == nil && referenced == 0
+}
+
+// repairMissing restores the object from the content in memory, without it
+// the file is deleted only if opts.DeleteMissing is set
+func (fk *FsckService) repairMissing(ctx context.Context, file repository.File, opts FsckOptions) (string, error) {
+	if action, err := fk.restore(ctx, file, opts.Content); action != "" || err != nil {
+		return action, err
+	}
+
+	if !opts.DeleteMissing {
+		return "", nil
+	}
+	return FsckDeleted, fk.db.DeleteFile(ctx, file.ID)
+}
+
+// repairCorrupted rewrites the object from the content in memory, without
+// it the object is quarantined only if opts.Quarantine is set. The stored
+// content is never trusted: rehashing it would hide the corruption.
+func (fk *FsckService) repairCorrupted(ctx context.Context, file repository.File, opts FsckOptions) (string, error) {
+	action, err := fk.restore(ctx, file, opts.Content)
+	if action != "" || err != nil {
+		if err == nil {
+			// the restored file points to a new object
+			err = fk.storage.DeleteObject(file.DiskPath)
+		}
+		return action, err
+	}
+
+	if !opts.Quarantine {
+		return "", nil
+	}
+	if err := fk.storage.QuarantineObject(file.DiskPath); err != nil {
+		return "", err
+	}
+	return FsckQuarantined, fk.db.DeleteFile(ctx, file.ID)
+}
+
+// restore writes the content in memory of the file to a new object, it
+// returns an empty action if the content isn't known
+func (fk *FsckService) restore(ctx context.Context, file repository.File, contentOf func(int64) (string, bool)) (string, error) {
+	if contentOf == nil {
+		return "", nil
+	}
+	content, ok := contentOf(file.ID)
+	if !ok {
+		return "", nil
+	}
+
+	diskPath, err := fk.storage.CreateObject([]byte(content))
+	if err != nil {
+		return "", err
+	}
+
+	return FsckRestored, fk.db.UpdateDiskPath(ctx, repository.UpdateDiskPathParams{
+		DiskPath: diskPath,
+		Hash:     filestorage.GenerateHash([]byte(content)),
+		ID:       file.ID,
+	})
+}
+
+func fileIssue(file repository.File) FsckIssue {
+	return FsckIssue{
+		FileID:        file.ID,
+		WorkspaceID:   file.WorkspaceID,
+		WorkspacePath: file.WorkspacePath,
+		DiskPath:      file.DiskPath,
+	}
+}
+
+// checkDuplicates reports the files sharing the path with an older file of
+// the same workspace
+func checkDuplicates(files []repository.File) []FsckIssue {
+	type key struct {
+		workspaceID int64
+		path        string
+	}
+
+	byPath := make(map[key][]repository.File)
+	for _, file := range files {
+		k := key{file.WorkspaceID, file.WorkspacePath}
+		byPath[k] = append(byPath[k], file)
+	}
+
+	issues := []FsckIssue{}
+	for _, group := range byPath {
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.Slice(group, func(i, j int) bool { return group[i].ID < group[j].ID })
+		for _, file := range group[1:] {
+			issues = append(issues, fileIssue(file))
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool { return issues[i].FileID < issues[j].FileID })
+	return issues
+}
+
+// conflictPath returns "dir/name (id).ext" for "dir/name.ext"
+func conflictPath(p string, id int64) string {
+	ext := path.Ext(p)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(p, ext), id, ext)
+}
+
+func withError(issue FsckIssue, err error) FsckIssue {
+	if err != nil {
+		issue.Action = ""
+		issue.Error = err.Error()
+	}
+	return issue
+}
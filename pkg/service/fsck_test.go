@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFsckService(t *testing.T) {
+	ctx := context.Background()
+
+	// setup creates a clean file, a file with a missing object, a corrupted
+	// one, an orphaned object and two files sharing the same path
+	setup := func(t *testing.T) (*repository.Queries, filestorage.Disk, *FsckService, map[string]repository.File, string) {
+		db := testutils.CreateDB(t)
+		repo := repository.New(db)
+		dir := t.TempDir()
+		disk := filestorage.NewDisk(dir)
+
+		files := make(map[string]repository.File)
+		create := func(name, path, content string) {
+			diskPath, err := disk.CreateObject([]byte(content))
+			require.NoError(t, err)
+			file, err := repo.CreateFile(ctx, repository.CreateFileParams{
+				DiskPath:      diskPath,
+				WorkspacePath: path,
+				MimeType:      "text/plain",
+				Hash:          filestorage.GenerateHash([]byte(content)),
+				WorkspaceID:   1,
+			})
+			require.NoError(t, err)
+			files[name] = file
+		}
+
+		create("clean", "clean.md", "clean")
+		create("missing", "missing.md", "missing")
+		create("corrupted", "corrupted.md", "corrupted")
+		create("first", "dup.md", "first")
+		create("second", "dup.md", "second")
+
+		require.NoError(t, disk.DeleteObject(files["missing"].DiskPath))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, files["corrupted"].DiskPath), []byte("bit rot"), 0o644))
+
+		orphan, err := disk.CreateObject([]byte("orphan"))
+		require.NoError(t, err)
+
+		return repo, disk, NewFsckService(db, disk), files, orphan
+	}
+
+	t.Run("should report the issues without changing anything", func(t *testing.T) {
+		repo, disk, fk, files, orphan := setup(t)
+
+		report, err := fk.Run(ctx, FsckOptions{})
+		require.NoError(t, err)
+		assert.False(t, report.Clean())
+		assert.Equal(t, 5, report.Files)
+		assert.Equal(t, 5, report.Objects)
+
+		require.Len(t, report.Missing, 1)
+		assert.Equal(t, files["missing"].ID, report.Missing[0].FileID)
+		assert.Empty(t, report.Missing[0].Action)
+		require.Len(t, report.Orphaned, 1)
+		assert.Equal(t, orphan, report.Orphaned[0].DiskPath)
+		require.Len(t, report.Corrupted, 1)
+		assert.Equal(t, files["corrupted"].ID, report.Corrupted[0].FileID)
+		require.Len(t, report.Duplicates, 1)
+		assert.Equal(t, files["second"].ID, report.Duplicates[0].FileID)
+		assert.Empty(t, report.ChangedFiles())
+
+		_, err = disk.ReadObject(orphan)
+		assert.NoError(t, err)
+		all, err := repo.FetchAllFiles(ctx)
+		require.NoError(t, err)
+		assert.Len(t, all, 5)
+	})
+
+	t.Run("should repair the issues", func(t *testing.T) {
+		repo, disk, fk, files, orphan := setup(t)
+
+		report, err := fk.Run(ctx, FsckOptions{
+			Repair: true,
+			Content: func(fileID int64) (string, bool) {
+				if fileID == files["missing"].ID {
+					return "restored", true
+				}
+				return "", false
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, FsckRestored, report.Missing[0].Action)
+		assert.Equal(t, FsckDeleted, report.Orphaned[0].Action)
+		assert.Equal(t, FsckRenamed, report.Duplicates[0].Action)
+		assert.ElementsMatch(t, []int64{files["missing"].ID, files["second"].ID}, report.ChangedFiles())
+
+		// without a copy in memory the corrupted object is only reported
+		assert.Empty(t, report.Corrupted[0].Action)
+		corrupted, err := repo.FetchFile(ctx, files["corrupted"].ID)
+		require.NoError(t, err)
+		assert.Equal(t, files["corrupted"].Hash, corrupted.Hash)
+
+		_, err = disk.ReadObject(orphan)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		restored, err := repo.FetchFile(ctx, files["missing"].ID)
+		require.NoError(t, err)
+		content, err := disk.ReadObject(restored.DiskPath)
+		require.NoError(t, err)
+		assert.Equal(t, "restored", string(content))
+
+		renamed, err := repo.FetchFile(ctx, files["second"].ID)
+		require.NoError(t, err)
+		assert.Equal(t, conflictPath("dup.md", files["second"].ID), renamed.WorkspacePath)
+
+		report, err = fk.Run(ctx, FsckOptions{})
+		require.NoError(t, err)
+		assert.Len(t, report.Corrupted, 1)
+		assert.Empty(t, report.Missing)
+		assert.Empty(t, report.Orphaned)
+		assert.Empty(t, report.Duplicates)
+	})
+
+	t.Run("should restore the corrupted objects from memory", func(t *testing.T) {
+		repo, disk, fk, files, _ := setup(t)
+
+		report, err := fk.Run(ctx, FsckOptions{
+			Repair: true,
+			Content: func(fileID int64) (string, bool) {
+				return "in memory", fileID == files["corrupted"].ID
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, FsckRestored, report.Corrupted[0].Action)
+
+		restored, err := repo.FetchFile(ctx, files["corrupted"].ID)
+		require.NoError(t, err)
+		content, err := disk.ReadObject(restored.DiskPath)
+		require.NoError(t, err)
+		assert.Equal(t, "in memory", string(content))
+
+		_, err = disk.ReadObject(files["corrupted"].DiskPath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("should delete the missing files only when asked", func(t *testing.T) {
+		repo, _, fk, files, _ := setup(t)
+
+		report, err := fk.Run(ctx, FsckOptions{Repair: true})
+		require.NoError(t, err)
+		assert.Empty(t, report.Missing[0].Action)
+		_, err = repo.FetchFile(ctx, files["missing"].ID)
+		assert.NoError(t, err)
+
+		report, err = fk.Run(ctx, FsckOptions{Repair: true, DeleteMissing: true})
+		require.NoError(t, err)
+		assert.Equal(t, FsckDeleted, report.Missing[0].Action)
+		_, err = repo.FetchFile(ctx, files["missing"].ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("should not repair the issues fixed since the check", func(t *testing.T) {
+		repo, disk, fk, files, orphan := setup(t)
+
+		report, err := fk.Check(ctx)
+		require.NoError(t, err)
+
+		// a save of the missing file and a file created with the orphan
+		diskPath, err := disk.CreateObject([]byte("saved"))
+		require.NoError(t, err)
+		require.NoError(t, repo.UpdateDiskPath(ctx, repository.UpdateDiskPathParams{
+			DiskPath: diskPath,
+			Hash:     filestorage.GenerateHash([]byte("saved")),
+			ID:       files["missing"].ID,
+		}))
+		_, err = repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      orphan,
+			WorkspacePath: "new.md",
+			MimeType:      "text/plain",
+			Hash:          filestorage.GenerateHash([]byte("orphan")),
+			WorkspaceID:   1,
+		})
+		require.NoError(t, err)
+
+		report = fk.Repair(ctx, report, FsckOptions{Repair: true, DeleteMissing: true, Quarantine: true})
+		assert.Empty(t, report.Missing[0].Action)
+		assert.Empty(t, report.Missing[0].Error)
+		assert.Empty(t, report.Orphaned[0].Action)
+
+		_, err = repo.FetchFile(ctx, files["missing"].ID)
+		assert.NoError(t, err)
+		_, err = disk.ReadObject(orphan)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should quarantine the corrupted objects", func(t *testing.T) {
+		repo, _, fk, files, _ := setup(t)
+
+		report, err := fk.Run(ctx, FsckOptions{Quarantine: true, DeleteMissing: true})
+		require.NoError(t, err)
+		assert.Equal(t, FsckDeleted, report.Missing[0].Action)
+		assert.Equal(t, FsckQuarantined, report.Orphaned[0].Action)
+		assert.Equal(t, FsckQuarantined, report.Corrupted[0].Action)
+
+		_, err = repo.FetchFile(ctx, files["corrupted"].ID)
+		assert.Error(t, err)
+		_, err = repo.FetchFile(ctx, files["missing"].ID)
+		assert.Error(t, err)
+
+		// quarantined objects are not listed anymore
+		report, err = fk.Run(ctx, FsckOptions{})
+		require.NoError(t, err)
+		assert.True(t, report.Clean())
+		assert.Equal(t, 3, report.Objects)
+	})
+}
+
+func TestConflictPath(t *testing.T) {
+	assert.Equal(t, "dir/note (3).md", conflictPath("dir/note.md", 3))
+	assert.Equal(t, "README (12)", conflictPath("README", 12))
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+)
+
+// Status of an imported file
+const (
+	ImportCreated  = "created"
+	ImportSkipped  = "skipped"
+	ImportConflict = "conflict"
+)
+
+// ImportEntry is a file to import
+type ImportEntry struct {
+	Path    string
+	Content []byte
+}
+
+type ImportResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	FileID int64  `json:"fileId,omitempty"`
+}
+
+// ImportReport lists what has been done for each file: files already
+// existing with the same content are skipped, the ones with a different
+// content are reported as conflicts and left untouched
+type ImportReport struct {
+	Created   int            `json:"created"`
+	Skipped   int            `json:"skipped"`
+	Conflicts int            `json:"conflicts"`
+	Files     []ImportResult `json:"files"`
+}
+
+// Import creates the files in the workspace in a single transaction, the
+// objects created are deleted if it fails
+func (fs *FileService) Import(ctx context.Context, workspaceID int64, entries []ImportEntry) (ImportReport, error) {
+	var (
+		report  ImportReport
+		objects []string
+	)
+
+	err := withTx(ctx, fs.sqlDB, func(q *repository.Queries) error {
+		report = ImportReport{Files: make([]ImportResult, 0, len(entries))}
+		hashes := make(map[string]string, len(entries))
+
+		for _, entry := range entries {
+			result := ImportResult{Path: vaultPath(entry.Path)}
+			if result.Path == "" {
+				return fmt.Errorf("%w: %q", ErrInvalidPath, entry.Path)
+			}
+
+			hash := filestorage.GenerateHash(entry.Content)
+
+			existingHash, ok := hashes[result.Path]
+			if !ok {
+				existing, err := q.FetchWorkspaceFile(ctx, repository.FetchWorkspaceFileParams{
+					WorkspaceID:   workspaceID,
+					WorkspacePath: result.Path,
+				})
+				switch {
+				case err == nil:
+					existingHash, ok = existing.Hash, true
+					result.FileID = existing.ID
+				case !errors.Is(err, sql.ErrNoRows):
+					return err
+				}
+			}
+
+			switch {
+			case ok && existingHash == hash:
+				result.Status = ImportSkipped
+				report.Skipped++
+			case ok:
+				result.Status = ImportConflict
+				report.Conflicts++
+			default:
+				diskPath, err := fs.storage.CreateObject(entry.Content)
+				if err != nil {
+					return err
+				}
+				objects = append(objects, diskPath)
+
+				file, err := q.CreateFile(ctx, repository.CreateFileParams{
+					DiskPath:      diskPath,
+					WorkspacePath: result.Path,
+					MimeType:      http.DetectContentType(entry.Content),
+					Hash:          hash,
+					WorkspaceID:   workspaceID,
+				})
+				if err != nil {
+					return err
+				}
+				if err := indexFile(ctx, q, file, string(entry.Content)); err != nil {
+					return err
+				}
+
+				hashes[result.Path] = hash
+				result.Status = ImportCreated
+				result.FileID = file.ID
+				report.Created++
+			}
+
+			report.Files = append(report.Files, result)
+		}
+
+		return nil
+	})
+	if err != nil {
+		for _, diskPath := range objects {
+			err = errors.Join(err, fs.storage.DeleteObject(diskPath))
+		}
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
+
+// ImportTar is a plain tar archive, which can be imported but not exported
+const ImportTar = "tar"
+
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// ReadArchive returns the files of a zip, tar or tar.gz archive. maxSize
+// bounds the size of the files once decompressed, as a small archive can
+// expand to many times its size; it's not bounded if maxSize is 0.
+func ReadArchive(r io.Reader, format string, maxSize int64) ([]ImportEntry, error) {
+	budget := &importBudget{left: maxSize, limited: maxSize > 0}
+
+	switch format {
+	case ExportZip:
+		return readZip(r, budget)
+	case ExportTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		return readTar(gz, budget)
+	case ImportTar:
+		return readTar(r, budget)
+	default:
+		return nil, ErrInvalidFormat
+	}
+}
+
+// importBudget is what is left of the maximum decompressed size of an
+// archive
+type importBudget struct {
+	left    int64
+	limited bool
+}
+
+// read reads an entry of the archive, size is the one declared by the
+// archive, which can't be trusted
+func (b *importBudget) read(r io.Reader, size int64) ([]byte, error) {
+	if !b.limited {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		return content, nil
+	}
+
+	if size > b.left {
+		return nil, ErrArchiveTooLarge
+	}
+
+	content, err := io.ReadAll(io.LimitReader(r, b.left+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if int64(len(content)) > b.left {
+		return nil, ErrArchiveTooLarge
+	}
+
+	b.left -= int64(len(content))
+	return content, nil
+}
+
+// readZip spools the archive to a temporary file, a zip is read from its
+// end
+func readZip(r io.Reader, budget *importBudget) ([]ImportEntry, error) {
+	tmp, err := os.CreateTemp("", "import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	var entries []ImportEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.UncompressedSize64 > math.MaxInt64 {
+			return nil, ErrArchiveTooLarge
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		content, err := budget.read(r, int64(f.UncompressedSize64))
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, ImportEntry{Path: f.Name, Content: content})
+	}
+
+	return entries, nil
+}
+
+func readTar(r io.Reader, budget *importBudget) ([]ImportEntry, error) {
+	tr := tar.NewReader(r)
+
+	var entries []ImportEntry
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := budget.read(tr, header.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, ImportEntry{Path: header.Name, Content: content})
+	}
+
+	return entries, nil
+}
+
+// ReadDir returns the regular files under dir, with their path relative to
+// it
+func ReadDir(dir string) ([]ImportEntry, error) {
+	var entries []ImportEntry
+
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, ImportEntry{
+			Path:    filepath.ToSlash(rel),
+			Content: content,
+		})
+		return nil
+	})
+
+	return entries, err
+}
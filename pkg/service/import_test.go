@@ -0,0 +1,182 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFileServiceImport(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	disk := filestorage.NewDisk(t.TempDir())
+	fs := NewFileService(db, disk)
+
+	for path, content := range map[string]string{"same.md": "same", "changed.md": "old"} {
+		diskPath, err := disk.CreateObject([]byte(content))
+		require.NoError(t, err)
+		_, err = repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      diskPath,
+			WorkspacePath: path,
+			Hash:          filestorage.GenerateHash([]byte(content)),
+			WorkspaceID:   1,
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("should create the new files and report the duplicates", func(t *testing.T) {
+		report, err := fs.Import(ctx, 1, []ImportEntry{
+			{Path: "dir/new.md", Content: []byte("new")},
+			{Path: "same.md", Content: []byte("same")},
+			{Path: "changed.md", Content: []byte("new content")},
+			{Path: "./dir/new.md", Content: []byte("new")},
+			{Path: "dir/new.md", Content: []byte("other")},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 2, report.Skipped)
+		assert.Equal(t, 2, report.Conflicts)
+
+		statuses := make([]string, 0, len(report.Files))
+		for _, result := range report.Files {
+			statuses = append(statuses, result.Status)
+		}
+		assert.Equal(t, []string{ImportCreated, ImportSkipped, ImportConflict, ImportSkipped, ImportConflict}, statuses)
+
+		file, content, err := fs.Read(ctx, 1, "dir/new.md")
+		require.NoError(t, err)
+		assert.Equal(t, report.Files[0].FileID, file.ID)
+		assert.Equal(t, "new", string(content))
+
+		_, content, err = fs.Read(ctx, 1, "changed.md")
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(content))
+	})
+
+	t.Run("should roll back and delete the objects on error", func(t *testing.T) {
+		objects, err := disk.ListObjects()
+		require.NoError(t, err)
+
+		_, err = fs.Import(ctx, 1, []ImportEntry{
+			{Path: "valid.md", Content: []byte("valid")},
+			{Path: "/", Content: []byte("invalid")},
+		})
+		assert.ErrorIs(t, err, ErrInvalidPath)
+
+		_, err = fs.Fetch(ctx, 1, "valid.md")
+		assert.ErrorIs(t, err, ErrFileNotFound)
+
+		after, err := disk.ListObjects()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, objects, after)
+	})
+}
+
+func TestReadArchive(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	fs := NewFileService(db, mockFileStorage)
+
+	_, err := repo.CreateFile(ctx, repository.CreateFileParams{
+		DiskPath:      "disk/1",
+		WorkspacePath: "dir/note.md",
+		WorkspaceID:   1,
+	})
+	require.NoError(t, err)
+	mockFileStorage.On("ReadObject", "disk/1").Return([]byte("content"), nil)
+
+	for _, format := range []string{ExportZip, ExportTarGz} {
+		t.Run("should read the exported "+format, func(t *testing.T) {
+			var archive bytes.Buffer
+			require.NoError(t, fs.Export(ctx, 1, &archive, format, nil))
+
+			entries, err := ReadArchive(&archive, format, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []ImportEntry{{Path: "dir/note.md", Content: []byte("content")}}, entries)
+		})
+	}
+
+	t.Run("should read a plain tar", func(t *testing.T) {
+		entries, err := ReadArchive(bytes.NewReader(tarArchive(t, "a.md", "b.md")), ImportTar, 0)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("should refuse an archive too large once decompressed", func(t *testing.T) {
+		// each entry fits, not both
+		_, err := ReadArchive(bytes.NewReader(tarArchive(t, "a.md", "b.md")), ImportTar, 1000)
+		assert.ErrorIs(t, err, ErrArchiveTooLarge)
+		_, err = ReadArchive(bytes.NewReader(tarArchive(t, "a.md", "b.md")), ImportTar, 1200)
+		assert.NoError(t, err)
+
+		// a zip bomb is refused from its declared size
+		var archive bytes.Buffer
+		zw := zip.NewWriter(&archive)
+		w, err := zw.Create("bomb.md")
+		require.NoError(t, err)
+		_, err = w.Write(make([]byte, 1<<20))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		require.Less(t, archive.Len(), 10<<10)
+
+		_, err = ReadArchive(bytes.NewReader(archive.Bytes()), ExportZip, 1<<10)
+		assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+		// and from its content if it lies about it
+		var lying bytes.Buffer
+		zw = zip.NewWriter(&lying)
+		w, err = zw.CreateRaw(&zip.FileHeader{Name: "bomb.md", Method: zip.Store, UncompressedSize64: 10, CompressedSize64: 1 << 11})
+		require.NoError(t, err)
+		_, err = w.Write(make([]byte, 1<<11))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		_, err = ReadArchive(bytes.NewReader(lying.Bytes()), ExportZip, 1<<10)
+		assert.ErrorIs(t, err, ErrInvalidArchive)
+	})
+
+	_, err = ReadArchive(bytes.NewReader([]byte("not an archive")), ExportZip, 0)
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+}
+
+// tarArchive returns a tar with 600 bytes in each file
+func tarArchive(t *testing.T, paths ...string) []byte {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, path := range paths {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: path, Mode: 0o644, Size: 600, Typeflag: tar.TypeReg}))
+		_, err := tw.Write(make([]byte, 600))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return archive.Bytes()
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.md"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.md"), []byte("b"), 0o644))
+
+	entries, err := ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []ImportEntry{
+		{Path: "a.md", Content: []byte("a")},
+		{Path: "sub/b.md", Content: []byte("b")},
+	}, entries)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+)
+
+// IndexService keeps the indexes built from the content of the text files:
+// the full-text index, the links, the tags and the frontmatter properties.
+// Deleted and renamed files are updated by the database, the content must be
+// indexed whenever it changes.
+type IndexService struct {
+	db *repository.Queries
+}
+
+func NewIndexService(db *sql.DB) *IndexService {
+	return &IndexService{
+		db: repository.New(db),
+	}
+}
+
+// Index indexes the content of the file, if it is a text file
+func (is *IndexService) Index(ctx context.Context, file repository.File, content string) error {
+	return indexFile(ctx, is.db, file, content)
+}
+
+// Unindexed returns the text files missing from the index
+func (is *IndexService) Unindexed(ctx context.Context) ([]repository.File, error) {
+	return is.db.FetchUnindexedFiles(ctx)
+}
+
+func indexFile(ctx context.Context, q *repository.Queries, file repository.File, content string) error {
+	if !strings.HasPrefix(file.MimeType, "text/") {
+		return nil
+	}
+
+	err := q.IndexFile(ctx, repository.IndexFileParams{
+		Rowid:         file.ID,
+		WorkspaceID:   file.WorkspaceID,
+		WorkspacePath: file.WorkspacePath,
+		Content:       content,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := indexLinks(ctx, q, file, content); err != nil {
+		return err
+	}
+
+	return indexMetadata(ctx, q, file, content)
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+)
+
+// wikilinkRegexp matches [[target#heading|alias]] and ![[embed]], the
+// groups are the embed mark, the target and the rest (heading and alias)
+var wikilinkRegexp = regexp.MustCompile(`(!?)\[\[([^\[\]|#]*)([^\[\]]*)\]\]`)
+
+// wikilink is a link found in a markdown content, start and end are its
+// byte offsets
+type wikilink struct {
+	start, end int
+	embed      bool
+	target     string
+	rest       string
+}
+
+// Link is a link of a file, the target file is set if it resolves to a file
+// of the workspace
+type Link struct {
+	Target        string `json:"target"`
+	Embed         bool   `json:"embed"`
+	FileID        int64  `json:"fileId,omitempty"`
+	WorkspacePath string `json:"workspacePath,omitempty"`
+}
+
+// FileLinks are the links of a file: the outgoing ones to existing files,
+// the ones to missing files and the links of other files to it
+type FileLinks struct {
+	Outgoing   []Link `json:"outgoing"`
+	Unresolved []Link `json:"unresolved"`
+	Backlinks  []Link `json:"backlinks"`
+}
+
+// LinkService queries the links between the files indexed by IndexService
+type LinkService struct {
+	db *repository.Queries
+}
+
+func NewLinkService(db *sql.DB) *LinkService {
+	return &LinkService{
+		db: repository.New(db),
+	}
+}
+
+// Resolver returns a resolver of the links to the files of the workspace
+func (ls *LinkService) Resolver(ctx context.Context, workspaceID int64) (LinkResolver, error) {
+	files, err := ls.db.FetchFiles(ctx, workspaceID)
+	if err != nil {
+		return LinkResolver{}, err
+	}
+	return NewLinkResolver(files), nil
+}
+
+// Links returns the links of the file
+func (ls *LinkService) Links(ctx context.Context, file repository.File) (FileLinks, error) {
+	links := FileLinks{
+		Outgoing:   []Link{},
+		Unresolved: []Link{},
+		Backlinks:  []Link{},
+	}
+
+	resolver, err := ls.Resolver(ctx, file.WorkspaceID)
+	if err != nil {
+		return links, err
+	}
+
+	outgoing, err := ls.db.FetchFileLinks(ctx, file.ID)
+	if err != nil {
+		return links, err
+	}
+
+	for _, l := range outgoing {
+		link := Link{Target: l.Target, Embed: l.Embed}
+		if target, ok := resolver.Resolve(l.Target); ok {
+			link.FileID = target.ID
+			link.WorkspacePath = target.WorkspacePath
+			links.Outgoing = append(links.Outgoing, link)
+		} else {
+			links.Unresolved = append(links.Unresolved, link)
+		}
+	}
+
+	links.Backlinks, err = ls.Backlinks(ctx, file, resolver)
+	return links, err
+}
+
+// Backlinks returns the links of the other files resolved to the file, with
+// the file they belong to
+func (ls *LinkService) Backlinks(ctx context.Context, file repository.File, resolver LinkResolver) ([]Link, error) {
+	pathKey, baseKey := fileLinkKeys(file.WorkspacePath)
+	candidates, err := ls.db.FetchLinksTo(ctx, repository.FetchLinksToParams{
+		WorkspaceID: file.WorkspaceID,
+		TargetKey:   pathKey,
+		TargetKey_2: baseKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	backlinks := []Link{}
+	for _, l := range candidates {
+		// the base name may resolve to another file with the same name
+		if target, ok := resolver.Resolve(l.Target); !ok || target.ID != file.ID {
+			continue
+		}
+
+		source, ok := resolver.byID[l.SourceID]
+		if !ok {
+			continue
+		}
+
+		backlinks = append(backlinks, Link{
+			Target:        l.Target,
+			Embed:         l.Embed,
+			FileID:        source.ID,
+			WorkspacePath: source.WorkspacePath,
+		})
+	}
+
+	return backlinks, nil
+}
+
+// LinkResolver resolves the link targets as Obsidian does: by path, with or
+// without the .md extension, or else by file name, preferring the shortest
+// path when more files have the same name
+type LinkResolver struct {
+	byID   map[int64]repository.File
+	byPath map[string]repository.File
+	byBase map[string]repository.File
+}
+
+func NewLinkResolver(files []repository.File) LinkResolver {
+	lr := LinkResolver{
+		byID:   make(map[int64]repository.File, len(files)),
+		byPath: make(map[string]repository.File, len(files)),
+		byBase: make(map[string]repository.File, len(files)),
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if len(files[i].WorkspacePath) != len(files[j].WorkspacePath) {
+			return len(files[i].WorkspacePath) < len(files[j].WorkspacePath)
+		}
+		return files[i].WorkspacePath < files[j].WorkspacePath
+	})
+
+	for _, file := range files {
+		lr.byID[file.ID] = file
+
+		pathKey, baseKey := fileLinkKeys(file.WorkspacePath)
+		if _, ok := lr.byPath[pathKey]; !ok {
+			lr.byPath[pathKey] = file
+		}
+		if _, ok := lr.byBase[baseKey]; !ok {
+			lr.byBase[baseKey] = file
+		}
+	}
+
+	return lr
+}
+
+func (lr LinkResolver) Resolve(target string) (repository.File, bool) {
+	key := linkKey(target)
+	if file, ok := lr.byPath[key]; ok {
+		return file, true
+	}
+	if strings.Contains(key, "/") {
+		return repository.File{}, false
+	}
+
+	file, ok := lr.byBase[key]
+	return file, ok
+}
+
+// RewriteLinks returns the content with the links resolved to the file
+// pointing to newPath instead. Links by name stay by name, links by path
+// stay by path.
+func RewriteLinks(content string, resolver LinkResolver, fileID int64, newPath string) string {
+	links := parseLinks(content)
+	if len(links) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, link := range links {
+		file, ok := resolver.Resolve(link.target)
+		if !ok || file.ID != fileID {
+			continue
+		}
+
+		target := newPath
+		if !strings.Contains(link.target, "/") {
+			target = path.Base(newPath)
+		}
+		if !strings.HasSuffix(strings.ToLower(link.target), ".md") {
+			target = strings.TrimSuffix(target, ".md")
+		}
+
+		b.WriteString(content[last:link.start])
+		if link.embed {
+			b.WriteString("!")
+		}
+		b.WriteString("[[" + target + link.rest + "]]")
+		last = link.end
+	}
+	b.WriteString(content[last:])
+
+	return b.String()
+}
+
+func indexLinks(ctx context.Context, q *repository.Queries, file repository.File, content string) error {
+	if err := q.DeleteFileLinks(ctx, file.ID); err != nil {
+		return err
+	}
+
+	for _, link := range parseLinks(content) {
+		err := q.CreateFileLink(ctx, repository.CreateFileLinkParams{
+			SourceID:    file.ID,
+			WorkspaceID: file.WorkspaceID,
+			Target:      link.target,
+			TargetKey:   linkKey(link.target),
+			Embed:       link.embed,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseLinks returns the wikilinks and embeds of a markdown content, except
+// the ones in code blocks and inline code
+func parseLinks(content string) []wikilink {
+	var links []wikilink
+
+	scanText(content, func(line string, offset int, code [][2]int) {
+		for _, m := range wikilinkRegexp.FindAllStringSubmatchIndex(line, -1) {
+			if inRanges(code, m[0]) || strings.TrimSpace(line[m[4]:m[5]]) == "" {
+				continue
+			}
+
+			links = append(links, wikilink{
+				start:  offset + m[0],
+				end:    offset + m[1],
+				embed:  m[3] > m[2],
+				target: strings.TrimSpace(line[m[4]:m[5]]),
+				rest:   line[m[6]:m[7]],
+			})
+		}
+	})
+
+	return links
+}
+
+// scanText calls fn with the lines of a markdown content outside the code
+// blocks, their byte offset and the ranges of their inline code
+func scanText(content string, fn func(line string, offset int, code [][2]int)) {
+	offset := 0
+	inFence := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		} else if !inFence {
+			fn(line, offset, inlineCodeRanges(line))
+		}
+
+		offset += len(line)
+	}
+}
+
+// inlineCodeRanges returns the ranges of the `code` spans of the line
+func inlineCodeRanges(line string) [][2]int {
+	var ranges [][2]int
+	start := -1
+	for i := 0; i < len(line); i++ {
+		if line[i] != '`' {
+			continue
+		}
+		if start < 0 {
+			start = i
+		} else {
+			ranges = append(ranges, [2]int{start, i})
+			start = -1
+		}
+	}
+	return ranges
+}
+
+func inRanges(ranges [][2]int, i int) bool {
+	for _, r := range ranges {
+		if i > r[0] && i < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// linkKey normalizes a link target, links are case insensitive and the .md
+// extension is optional
+func linkKey(target string) string {
+	key := strings.ToLower(strings.Trim(strings.TrimSpace(target), "/"))
+	return strings.TrimSuffix(key, ".md")
+}
+
+// fileLinkKeys returns the keys of the links to the file by path and by name
+func fileLinkKeys(workspacePath string) (string, string) {
+	pathKey := linkKey(workspacePath)
+	return pathKey, path.Base(pathKey)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseLinks(t *testing.T) {
+	content := "See [[Note]], [[folder/Other.md#Heading|alias]] and ![[image.png]].\n" +
+		"```\n[[in code block]]\n```\n" +
+		"Inline `[[code]]` and [[ ]] are ignored, [[Last]]"
+
+	links := parseLinks(content)
+	require.NotEmpty(t, links)
+	assert.Equal(t, "![[image.png]]", content[links[2].start:links[2].end])
+	assert.Equal(t, "[[Last]]", content[links[len(links)-1].start:links[len(links)-1].end])
+
+	var got []wikilink
+	for _, link := range links {
+		link.start, link.end = 0, 0
+		got = append(got, link)
+	}
+
+	assert.Equal(t, []wikilink{
+		{target: "Note"},
+		{target: "folder/Other.md", rest: "#Heading|alias"},
+		{target: "image.png", embed: true},
+		{target: "Last"},
+	}, got)
+}
+
+func TestLinkResolver(t *testing.T) {
+	resolver := NewLinkResolver([]repository.File{
+		{ID: 1, WorkspacePath: "deep/folder/Note.md"},
+		{ID: 2, WorkspacePath: "Note.md"},
+		{ID: 3, WorkspacePath: "folder/Other.md"},
+		{ID: 4, WorkspacePath: "img/image.png"},
+	})
+
+	for target, id := range map[string]int64{
+		"note":                2,
+		"Note.md":             2,
+		"deep/folder/Note":    1,
+		"Other":               3,
+		"FOLDER/other.md":     3,
+		"image.png":           4,
+		"img/image.png":       4,
+		"missing":             0,
+		"wrong/folder/Other":  0,
+		"deep/folder/Note.md": 1,
+	} {
+		file, ok := resolver.Resolve(target)
+		assert.Equal(t, id != 0, ok, target)
+		assert.Equal(t, id, file.ID, target)
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	resolver := NewLinkResolver([]repository.File{
+		{ID: 1, WorkspacePath: "folder/Note.md"},
+		{ID: 2, WorkspacePath: "Other.md"},
+	})
+
+	content := "[[Note]] [[folder/Note#Heading|alias]] ![[Note.md]] [[Other]] `[[Note]]`"
+	assert.Equal(t,
+		"[[Renamed]] [[archive/Renamed#Heading|alias]] ![[Renamed.md]] [[Other]] `[[Note]]`",
+		RewriteLinks(content, resolver, 1, "archive/Renamed.md"),
+	)
+}
+
+func TestLinkService(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	is := NewIndexService(db)
+	ls := NewLinkService(db)
+
+	create := func(workspaceID int64, path, content string) repository.File {
+		file, err := repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      fmt.Sprintf("%d/%s", workspaceID, path),
+			WorkspacePath: path,
+			MimeType:      "text/plain; charset=utf-8",
+			WorkspaceID:   workspaceID,
+		})
+		require.NoError(t, err)
+		require.NoError(t, is.Index(ctx, file, content))
+		return file
+	}
+
+	note := create(1, "Note.md", "[[Other]] [[Missing]] ![[Other#Part]]")
+	other := create(1, "folder/Other.md", "back to [[Note]]")
+	create(2, "Note.md", "[[Other]] in another workspace")
+
+	links, err := ls.Links(ctx, note)
+	require.NoError(t, err)
+	assert.Equal(t, []Link{
+		{Target: "Other", FileID: other.ID, WorkspacePath: "folder/Other.md"},
+		{Target: "Other", Embed: true, FileID: other.ID, WorkspacePath: "folder/Other.md"},
+	}, links.Outgoing)
+	assert.Equal(t, []Link{{Target: "Missing"}}, links.Unresolved)
+	assert.Equal(t, []Link{{Target: "Note", FileID: other.ID, WorkspacePath: "folder/Other.md"}}, links.Backlinks)
+
+	links, err = ls.Links(ctx, other)
+	require.NoError(t, err)
+	assert.Len(t, links.Backlinks, 2)
+
+	// the links of a reindexed or deleted file are replaced
+	require.NoError(t, is.Index(ctx, other, "no links"))
+	require.NoError(t, repo.DeleteFile(ctx, note.ID))
+
+	links, err = ls.Links(ctx, other)
+	require.NoError(t, err)
+	assert.Empty(t, links.Outgoing)
+	assert.Empty(t, links.Backlinks)
+}
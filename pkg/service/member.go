@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+)
+
+var (
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrDuplicateMember = errors.New("user is already a member")
+	ErrMemberNotFound  = errors.New("member not found")
+	ErrLastOwner       = errors.New("the workspace must keep an owner")
+)
+
+type MemberService struct {
+	sqlDB *sql.DB
+	db    *repository.Queries
+}
+
+func NewMemberService(db *sql.DB) *MemberService {
+	return &MemberService{
+		sqlDB: db,
+		db:    repository.New(db),
+	}
+}
+
+// List returns the members of the workspace
+func (ms *MemberService) List(ctx context.Context, workspaceID int64) ([]repository.FetchWorkspaceMembersRow, error) {
+	return ms.db.FetchWorkspaceMembers(ctx, workspaceID)
+}
+
+// Add makes the user a member of the workspace with the given role
+func (ms *MemberService) Add(ctx context.Context, workspaceID, userID int64, role middleware.Role) error {
+	if !role.IsValid() {
+		return ErrInvalidRole
+	}
+
+	return withTx(ctx, ms.sqlDB, func(q *repository.Queries) error {
+		// if the user isn't a member an error is returned
+		_, err := q.FetchWorkspaceMember(ctx, repository.FetchWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+		})
+		if err == nil {
+			return ErrDuplicateMember
+		}
+
+		err = q.AddWorkspaceMember(ctx, repository.AddWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        string(role),
+		})
+		if isUniqueViolation(err) {
+			return ErrDuplicateMember
+		}
+		return err
+	})
+}
+
+// SetRole changes the role of a member, the last owner can't be demoted
+func (ms *MemberService) SetRole(ctx context.Context, workspaceID, userID int64, role middleware.Role) error {
+	if !role.IsValid() {
+		return ErrInvalidRole
+	}
+
+	return withTx(ctx, ms.sqlDB, func(q *repository.Queries) error {
+		if role != middleware.RoleOwner {
+			if err := checkLastOwner(ctx, q, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+
+		updated, err := q.UpdateWorkspaceMemberRole(ctx, repository.UpdateWorkspaceMemberRoleParams{
+			Role:        string(role),
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+		})
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrMemberNotFound
+		}
+		return nil
+	})
+}
+
+// Remove removes a member from the workspace, the last owner can't be
+// removed
+func (ms *MemberService) Remove(ctx context.Context, workspaceID, userID int64) error {
+	return withTx(ctx, ms.sqlDB, func(q *repository.Queries) error {
+		if err := checkLastOwner(ctx, q, workspaceID, userID); err != nil {
+			return err
+		}
+
+		deleted, err := q.DeleteWorkspaceMember(ctx, repository.DeleteWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrMemberNotFound
+		}
+		return nil
+	})
+}
+
+// checkLastOwner returns ErrLastOwner if the user is the only owner of the
+// workspace, who can't be demoted or removed
+func checkLastOwner(ctx context.Context, q *repository.Queries, workspaceID, userID int64) error {
+	member, err := q.FetchWorkspaceMember(ctx, repository.FetchWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) || member.Role != string(middleware.RoleOwner) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	owners, err := q.CountWorkspaceOwners(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultQueryLimit is the number of results returned when no limit is given
+const DefaultQueryLimit = 100
+
+// tagRegexp matches the #tags of a text, a tag starts the line or follows a
+// space or a punctuation mark, so the anchors of the urls don't match
+var tagRegexp = regexp.MustCompile(`(?:^|[\s(,;])#([\p{L}\p{N}_\-/]+)`)
+
+// Operators of the property filters, the first matching one is used, so the
+// two characters ones come first
+var queryOperators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// PropertyFilter compares a frontmatter property with a value. Numbers are
+// compared as numbers, everything else as text, so ISO dates keep their
+// order. A list property matches when one of its values does.
+type PropertyFilter struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// MetadataQuery selects the files having all the tags, nested tags included,
+// matching all the property filters and with a path starting with
+// PathPrefix
+type MetadataQuery struct {
+	Tags       []string
+	Properties []PropertyFilter
+	PathPrefix string
+	Limit      int
+}
+
+type QueryResult struct {
+	FileID        int64          `json:"fileId"`
+	WorkspacePath string         `json:"workspacePath"`
+	Tags          []string       `json:"tags"`
+	Properties    map[string]any `json:"properties"`
+}
+
+// MetadataService queries the frontmatter properties and the tags indexed by
+// IndexService
+type MetadataService struct {
+	sqlDB *sql.DB
+	db    *repository.Queries
+}
+
+func NewMetadataService(db *sql.DB) *MetadataService {
+	return &MetadataService{
+		sqlDB: db,
+		db:    repository.New(db),
+	}
+}
+
+// ParsePropertyFilter parses a filter written as key=value, key!=value or
+// with the range operators <, <=, >, >=
+func ParsePropertyFilter(filter string) (PropertyFilter, error) {
+	for i := 0; i < len(filter); i++ {
+		for _, op := range queryOperators {
+			if !strings.HasPrefix(filter[i:], op) {
+				continue
+			}
+
+			key := strings.TrimSpace(filter[:i])
+			if key == "" {
+				return PropertyFilter{}, fmt.Errorf("%w: missing property in %q", ErrInvalidFilter, filter)
+			}
+			return PropertyFilter{
+				Key:   key,
+				Op:    op,
+				Value: strings.TrimSpace(filter[i+len(op):]),
+			}, nil
+		}
+	}
+
+	return PropertyFilter{}, fmt.Errorf("%w: missing operator in %q", ErrInvalidFilter, filter)
+}
+
+// Query returns the files of the workspace matching the query, sorted by path
+func (ms *MetadataService) Query(ctx context.Context, workspaceID int64, query MetadataQuery) ([]QueryResult, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultQueryLimit
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT f.id, f.workspace_path FROM files f WHERE f.workspace_id = ?")
+	args := []any{workspaceID}
+
+	if query.PathPrefix != "" {
+		b.WriteString(" AND instr(f.workspace_path, ?) = 1")
+		args = append(args, query.PathPrefix)
+	}
+
+	for _, tag := range query.Tags {
+		tag = normalizeTag(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("%w: empty tag", ErrInvalidFilter)
+		}
+		b.WriteString(" AND EXISTS (SELECT 1 FROM file_tags t WHERE t.file_id = f.id AND (t.tag = ? OR instr(t.tag, ?) = 1))")
+		args = append(args, tag, tag+"/")
+	}
+
+	for _, filter := range query.Properties {
+		condition, filterArgs, err := propertyCondition(filter)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(" AND " + condition)
+		args = append(args, filterArgs...)
+	}
+
+	b.WriteString(" ORDER BY f.workspace_path LIMIT ?")
+	args = append(args, query.Limit)
+
+	rows, err := ms.sqlDB.QueryContext(ctx, b.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []QueryResult{}
+	for rows.Next() {
+		var result QueryResult
+		if err := rows.Scan(&result.FileID, &result.WorkspacePath); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := ms.fillMetadata(ctx, results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// fillMetadata sets the tags and the properties of the results, loading
+// those of all the files at once
+func (ms *MetadataService) fillMetadata(ctx context.Context, results []QueryResult) error {
+	fileIDs := make([]int64, 0, len(results))
+	for i := range results {
+		results[i].Tags = []string{}
+		results[i].Properties = map[string]any{}
+		fileIDs = append(fileIDs, results[i].FileID)
+	}
+	if len(fileIDs) == 0 {
+		return nil
+	}
+
+	tags, err := ms.db.FetchFilesTags(ctx, fileIDs)
+	if err != nil {
+		return err
+	}
+
+	properties, err := ms.db.FetchFilesProperties(ctx, fileIDs)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int64]*QueryResult, len(results))
+	for i := range results {
+		byID[results[i].FileID] = &results[i]
+	}
+
+	for _, tag := range tags {
+		result := byID[tag.FileID]
+		result.Tags = append(result.Tags, tag.Tag)
+	}
+
+	for _, property := range properties {
+		values := byID[property.FileID].Properties
+
+		var value any = property.Value
+		if property.Number.Valid {
+			value = property.Number.Float64
+		}
+
+		if !property.List {
+			values[property.Key] = value
+			continue
+		}
+		list, _ := values[property.Key].([]any)
+		values[property.Key] = append(list, value)
+	}
+
+	return nil
+}
+
+// propertyCondition returns the SQL condition of the filter on the files f
+func propertyCondition(filter PropertyFilter) (string, []any, error) {
+	const exists = "EXISTS (SELECT 1 FROM file_properties p WHERE p.file_id = f.id AND p.key = ? AND %s)"
+
+	number, isNumber := parseNumber(filter.Value)
+	value := filter.Value
+	if isNumber {
+		value = formatNumber(number)
+	}
+
+	switch filter.Op {
+	case "=":
+		return fmt.Sprintf(exists, "p.value = ?"), []any{filter.Key, value}, nil
+	case "!=":
+		return "NOT " + fmt.Sprintf(exists, "p.value = ?"), []any{filter.Key, value}, nil
+	case "<", "<=", ">", ">=":
+		if isNumber {
+			return fmt.Sprintf(exists, "p.number "+filter.Op+" ?"), []any{filter.Key, number}, nil
+		}
+		return fmt.Sprintf(exists, "p.number IS NULL AND p.value "+filter.Op+" ?"), []any{filter.Key, value}, nil
+	default:
+		return "", nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, filter.Op)
+	}
+}
+
+// property is a frontmatter value, a list property has a row per value
+type property struct {
+	key    string
+	value  string
+	number sql.NullFloat64
+	list   bool
+}
+
+func indexMetadata(ctx context.Context, q *repository.Queries, file repository.File, content string) error {
+	if err := q.DeleteFileTags(ctx, file.ID); err != nil {
+		return err
+	}
+	if err := q.DeleteFileProperties(ctx, file.ID); err != nil {
+		return err
+	}
+
+	frontmatter, body := splitFrontmatter(content)
+	properties, tags := parseFrontmatter(frontmatter)
+	tags = append(tags, parseTags(body)...)
+
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		err := q.CreateFileTag(ctx, repository.CreateFileTagParams{
+			FileID:      file.ID,
+			WorkspaceID: file.WorkspaceID,
+			Tag:         tag,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range properties {
+		err := q.CreateFileProperty(ctx, repository.CreateFilePropertyParams{
+			FileID:      file.ID,
+			WorkspaceID: file.WorkspaceID,
+			Key:         p.key,
+			Value:       p.value,
+			Number:      p.number,
+			List:        p.list,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitFrontmatter returns the YAML between the --- lines opening the
+// content, if any, and the rest of the content
+func splitFrontmatter(content string) (string, string) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], "\r\n") != "---" {
+		return "", content
+	}
+
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "---" || trimmed == "..." {
+			return content[len(lines[0]):offset], content[offset+len(line):]
+		}
+		offset += len(line)
+	}
+
+	return "", content
+}
+
+// parseFrontmatter returns the properties of the frontmatter and the tags of
+// its tags property. An invalid frontmatter has no properties.
+func parseFrontmatter(frontmatter string) ([]property, []string) {
+	if strings.TrimSpace(frontmatter) == "" {
+		return nil, nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(frontmatter), &document); err != nil {
+		return nil, nil
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var properties []property
+	var tags []string
+	collectProperties(document.Content[0], "", &properties)
+	for _, p := range properties {
+		key := strings.ToLower(p.key)
+		if key != "tags" && key != "tag" {
+			continue
+		}
+		for _, tag := range strings.FieldsFunc(p.value, func(r rune) bool {
+			return r == ',' || r == ' '
+		}) {
+			if tag = normalizeTag(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return properties, tags
+}
+
+// collectProperties appends the scalar values of the mapping, the keys of the
+// nested mappings are joined with a dot
+func collectProperties(mapping *yaml.Node, prefix string, properties *[]property) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := prefix + mapping.Content[i].Value
+		value := mapping.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if p, ok := scalarProperty(key, value, false); ok {
+				*properties = append(*properties, p)
+			}
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					continue
+				}
+				if p, ok := scalarProperty(key, item, true); ok {
+					*properties = append(*properties, p)
+				}
+			}
+		case yaml.MappingNode:
+			collectProperties(value, key+".", properties)
+		}
+	}
+}
+
+func scalarProperty(key string, node *yaml.Node, list bool) (property, bool) {
+	p := property{key: key, value: node.Value, list: list}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return p, false
+	case "!!int", "!!float":
+		if number, ok := parseNumber(node.Value); ok {
+			p.value = formatNumber(number)
+			p.number = sql.NullFloat64{Float64: number, Valid: true}
+		}
+	}
+
+	return p, true
+}
+
+// parseTags returns the tags of a markdown content, except the ones in code
+// blocks and inline code
+func parseTags(content string) []string {
+	var tags []string
+
+	scanText(content, func(line string, _ int, code [][2]int) {
+		for _, m := range tagRegexp.FindAllStringSubmatchIndex(line, -1) {
+			if inRanges(code, m[2]) {
+				continue
+			}
+			if tag := normalizeTag(line[m[2]:m[3]]); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	})
+
+	return tags
+}
+
+// normalizeTag returns the tag lowercase without # and trailing slashes, or
+// an empty string if it isn't a valid tag, like the numbers
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "#"), "/"))
+	if _, err := strconv.Atoi(tag); err == nil {
+		return ""
+	}
+	return tag
+}
+
+func parseNumber(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+// formatNumber returns the canonical text of a number, so 1, 1.0 and 1e0 are
+// equal
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
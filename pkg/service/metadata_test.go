@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSplitFrontmatter(t *testing.T) {
+	frontmatter, body := splitFrontmatter("---\nstatus: done\n---\n# Title\n")
+	assert.Equal(t, "status: done\n", frontmatter)
+	assert.Equal(t, "# Title\n", body)
+
+	frontmatter, body = splitFrontmatter("---\r\nstatus: done\r\n...\r\nbody")
+	assert.Equal(t, "status: done\r\n", frontmatter)
+	assert.Equal(t, "body", body)
+
+	for _, content := range []string{"no frontmatter", "---\nnot closed", "text\n---\nstatus: done\n---\n"} {
+		frontmatter, body = splitFrontmatter(content)
+		assert.Empty(t, frontmatter)
+		assert.Equal(t, content, body)
+	}
+}
+
+func TestParseFrontmatter(t *testing.T) {
+	properties, tags := parseFrontmatter(`
+status: done
+priority: 2.0
+done: true
+owner:
+due: 2024-03-01
+tags: [Project/Alpha, "#urgent"]
+review:
+  by: anna
+`)
+
+	assert.Equal(t, []property{
+		{key: "status", value: "done"},
+		{key: "priority", value: "2", number: sql.NullFloat64{Float64: 2, Valid: true}},
+		{key: "done", value: "true"},
+		{key: "due", value: "2024-03-01"},
+		{key: "tags", value: "Project/Alpha", list: true},
+		{key: "tags", value: "#urgent", list: true},
+		{key: "review.by", value: "anna"},
+	}, properties)
+	assert.Equal(t, []string{"project/alpha", "urgent"}, tags)
+
+	_, tags = parseFrontmatter("tags: one, two")
+	assert.Equal(t, []string{"one", "two"}, tags)
+
+	properties, tags = parseFrontmatter("status: [not closed")
+	assert.Empty(t, properties)
+	assert.Empty(t, tags)
+}
+
+func TestParseTags(t *testing.T) {
+	content := "#Todo at start, #project/alpha/ and (#paren)\n" +
+		"# Heading, #123 and http://example.com/#anchor aren't tags\n" +
+		"```\n#in-code\n```\n" +
+		"`#inline` #last"
+
+	assert.Equal(t, []string{"todo", "project/alpha", "paren", "last"}, parseTags(content))
+}
+
+func TestParsePropertyFilter(t *testing.T) {
+	for filter, expected := range map[string]PropertyFilter{
+		"status=done":        {Key: "status", Op: "=", Value: "done"},
+		"status != done":     {Key: "status", Op: "!=", Value: "done"},
+		"due<=2024-01-01":    {Key: "due", Op: "<=", Value: "2024-01-01"},
+		"priority>2":         {Key: "priority", Op: ">", Value: "2"},
+		"url=http://a.b/?c=": {Key: "url", Op: "=", Value: "http://a.b/?c="},
+	} {
+		got, err := ParsePropertyFilter(filter)
+		require.NoError(t, err, filter)
+		assert.Equal(t, expected, got, filter)
+	}
+
+	for _, filter := range []string{"status", "=done", ""} {
+		_, err := ParsePropertyFilter(filter)
+		assert.ErrorIs(t, err, ErrInvalidFilter, filter)
+	}
+}
+
+func TestMetadataService(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	is := NewIndexService(db)
+	ms := NewMetadataService(db)
+
+	create := func(workspaceID int64, path, content string) repository.File {
+		file, err := repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      path,
+			WorkspacePath: path,
+			MimeType:      "text/plain; charset=utf-8",
+			WorkspaceID:   workspaceID,
+		})
+		require.NoError(t, err)
+		require.NoError(t, is.Index(ctx, file, content))
+		return file
+	}
+
+	alpha := create(1, "projects/alpha.md", "---\nstatus: doing\npriority: 1\ndue: 2024-02-01\nowners: [anna, bob]\n---\n#project/alpha")
+	beta := create(1, "projects/beta.md", "---\nstatus: done\npriority: 10\ndue: 2024-03-01\n---\n#project/beta #urgent")
+	notes := create(1, "notes.md", "#project mentioned in a note")
+	create(2, "projects/other.md", "---\nstatus: done\n---\n#project")
+
+	query := func(q MetadataQuery) []int64 {
+		results, err := ms.Query(ctx, 1, q)
+		require.NoError(t, err)
+		ids := []int64{}
+		for _, result := range results {
+			ids = append(ids, result.FileID)
+		}
+		return ids
+	}
+	filter := func(f string) PropertyFilter {
+		filter, err := ParsePropertyFilter(f)
+		require.NoError(t, err)
+		return filter
+	}
+
+	assert.Equal(t, []int64{notes.ID, alpha.ID, beta.ID}, query(MetadataQuery{Tags: []string{"#Project"}}))
+	assert.Equal(t, []int64{beta.ID}, query(MetadataQuery{Tags: []string{"project", "urgent"}}))
+	assert.Equal(t, []int64{alpha.ID}, query(MetadataQuery{Tags: []string{"project/alpha"}}))
+	assert.Equal(t, []int64{alpha.ID, beta.ID}, query(MetadataQuery{PathPrefix: "projects/"}))
+	assert.Equal(t, []int64{beta.ID}, query(MetadataQuery{Properties: []PropertyFilter{filter("status=done")}}))
+	assert.Equal(t, []int64{notes.ID, alpha.ID}, query(MetadataQuery{Properties: []PropertyFilter{filter("status!=done")}}))
+	assert.Equal(t, []int64{alpha.ID}, query(MetadataQuery{Properties: []PropertyFilter{filter("owners=bob")}}))
+	assert.Equal(t, []int64{beta.ID}, query(MetadataQuery{Properties: []PropertyFilter{filter("priority>2")}}))
+	assert.Equal(t, []int64{alpha.ID}, query(MetadataQuery{Properties: []PropertyFilter{filter("priority=1.0")}}))
+	assert.Equal(t, []int64{alpha.ID}, query(MetadataQuery{
+		PathPrefix: "projects/",
+		Properties: []PropertyFilter{filter("due>=2024-01-01"), filter("due<2024-03-01")},
+	}))
+	assert.Equal(t, []int64{alpha.ID}, query(MetadataQuery{PathPrefix: "projects/", Limit: 1}))
+
+	results, err := ms.Query(ctx, 1, MetadataQuery{Tags: []string{"project/alpha"}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, QueryResult{
+		FileID:        alpha.ID,
+		WorkspacePath: "projects/alpha.md",
+		Tags:          []string{"project/alpha"},
+		Properties: map[string]any{
+			"status":   "doing",
+			"priority": float64(1),
+			"due":      "2024-02-01",
+			"owners":   []any{"anna", "bob"},
+		},
+	}, results[0])
+
+	_, err = ms.Query(ctx, 1, MetadataQuery{Tags: []string{"#"}})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	// the metadata of a reindexed or deleted file are replaced
+	require.NoError(t, is.Index(ctx, beta, "no metadata"))
+	require.NoError(t, repo.DeleteFile(ctx, alpha.ID))
+	assert.Equal(t, []int64{notes.ID}, query(MetadataQuery{Tags: []string{"project"}}))
+	assert.Empty(t, query(MetadataQuery{Properties: []PropertyFilter{filter("status=done")}}))
+}
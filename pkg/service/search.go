@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+)
+
+// DefaultSearchLimit is the number of results returned when no limit is
+// given
+const DefaultSearchLimit = 20
+
+// Markers of the highlighted terms in the snippets returned by SQLite
+const (
+	highlightStart = '\x02'
+	highlightEnd   = '\x03'
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// SearchHighlight is a match in the snippet, as byte offsets
+type SearchHighlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type SearchResult struct {
+	FileID        int64             `json:"fileId"`
+	WorkspacePath string            `json:"workspacePath"`
+	Snippet       string            `json:"snippet"`
+	Highlights    []SearchHighlight `json:"highlights"`
+	Score         float64           `json:"score"`
+}
+
+// SearchService searches the full-text index kept by IndexService
+type SearchService struct {
+	db *repository.Queries
+}
+
+func NewSearchService(db *sql.DB) *SearchService {
+	return &SearchService{
+		db: repository.New(db),
+	}
+}
+
+// Search returns the files of the workspace matching all the words of the
+// query, a word ending with * matches as prefix. The results are sorted by
+// relevance.
+func (ss *SearchService) Search(ctx context.Context, workspaceID int64, query string, limit int) ([]SearchResult, error) {
+	match := matchQuery(query)
+	if match == "" {
+		return nil, ErrInvalidQuery
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	rows, err := ss.db.SearchFiles(ctx, repository.SearchFilesParams{
+		Query:       match,
+		WorkspaceID: workspaceID,
+		Limit:       int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		snippet, highlights := parseSnippet(row.Snippet)
+		results = append(results, SearchResult{
+			FileID:        row.FileID,
+			WorkspacePath: row.WorkspacePath,
+			Snippet:       snippet,
+			Highlights:    highlights,
+			Score:         row.Score,
+		})
+	}
+
+	return results, nil
+}
+
+// matchQuery quotes each word of the query, so that it can't be
+// interpreted as an FTS operator
+func matchQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.Trim(strings.ReplaceAll(word, `"`, ""), "*")
+		if word == "" {
+			continue
+		}
+
+		term := `"` + word + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// parseSnippet removes the markers from the snippet, returning the offsets
+// of the highlighted terms
+func parseSnippet(marked string) (string, []SearchHighlight) {
+	var (
+		snippet    strings.Builder
+		highlights = []SearchHighlight{}
+	)
+
+	for i := 0; i < len(marked); i++ {
+		switch marked[i] {
+		case highlightStart:
+			highlights = append(highlights, SearchHighlight{Start: snippet.Len()})
+		case highlightEnd:
+			if len(highlights) > 0 {
+				highlights[len(highlights)-1].End = snippet.Len()
+			}
+		default:
+			snippet.WriteByte(marked[i])
+		}
+	}
+
+	return snippet.String(), highlights
+}
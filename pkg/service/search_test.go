@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSearchService(t *testing.T) {
+	ctx := context.Background()
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	ss := NewSearchService(db)
+	is := NewIndexService(db)
+
+	create := func(workspaceID int64, path, mimeType, content string) repository.File {
+		file, err := repo.CreateFile(ctx, repository.CreateFileParams{
+			DiskPath:      path,
+			WorkspacePath: path,
+			MimeType:      mimeType,
+			WorkspaceID:   workspaceID,
+		})
+		require.NoError(t, err)
+		require.NoError(t, is.Index(ctx, file, content))
+		return file
+	}
+
+	recipes := create(1, "recipes.md", "text/plain; charset=utf-8", "A pizza needs flour, water and a hot oven.")
+	pizza := create(1, "pizza.md", "text/plain; charset=utf-8", "Pizza night: bake the pizza for ten minutes.")
+	create(1, "photo.png", "image/png", "pizza")
+	create(2, "other.md", "text/plain; charset=utf-8", "pizza in another workspace")
+
+	t.Run("should rank the matches of the workspace", func(t *testing.T) {
+		results, err := ss.Search(ctx, 1, "pizza", 0)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, pizza.ID, results[0].FileID)
+		assert.Equal(t, recipes.ID, results[1].FileID)
+		assert.Greater(t, results[0].Score, results[1].Score)
+
+		result := results[1]
+		assert.Equal(t, "A pizza needs flour, water and a hot oven.", result.Snippet)
+		require.Len(t, result.Highlights, 1)
+		highlight := result.Highlights[0]
+		assert.Equal(t, "pizza", result.Snippet[highlight.Start:highlight.End])
+	})
+
+	t.Run("should return at most limit results", func(t *testing.T) {
+		results, err := ss.Search(ctx, 1, "pizza", 1)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, pizza.ID, results[0].FileID)
+	})
+
+	t.Run("should match all the words and prefixes", func(t *testing.T) {
+		results, err := ss.Search(ctx, 1, "pizza fl*", 0)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, recipes.ID, results[0].FileID)
+	})
+
+	t.Run("should not interpret operators", func(t *testing.T) {
+		results, err := ss.Search(ctx, 1, `pizza OR "oven NEAR -`, 0)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+
+		_, err = ss.Search(ctx, 1, ` * "" `, 0)
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	})
+
+	t.Run("should follow renamed and deleted files", func(t *testing.T) {
+		require.NoError(t, repo.UpdateWorkspacePath(ctx, repository.UpdateWorkspacePathParams{
+			WorkspacePath: "italian.md",
+			ID:            pizza.ID,
+		}))
+		require.NoError(t, repo.DeleteFile(ctx, recipes.ID))
+
+		results, err := ss.Search(ctx, 1, "pizza", 0)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "italian.md", results[0].WorkspacePath)
+
+		unindexed, err := is.Unindexed(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, unindexed)
+	})
+}
@@ -0,0 +1,70 @@
+// Package service implements the operations shared by the HTTP API and the
+// admin CLI, so that both apply the same validation and side effects.
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidName        = errors.New("invalid name")
+	ErrInvalidPassword    = errors.New("invalid password")
+	ErrWrongPassword      = errors.New("wrong password")
+	ErrDuplicateWorkspace = errors.New("workspace already exists")
+	ErrWorkspaceNotFound  = errors.New("workspace not found")
+	ErrDuplicateUser      = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrFileNotFound       = errors.New("file not found")
+	ErrInvalidPath        = errors.New("invalid path")
+	ErrInvalidArchive     = errors.New("invalid archive")
+)
+
+// withTx runs fn in a transaction, which is committed only if fn succeeds
+func withTx(ctx context.Context, db *sql.DB, fn func(q *repository.Queries) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(repository.New(tx)); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err is a UNIQUE or PRIMARY KEY
+// constraint failure, the check before an insert doesn't stop a concurrent
+// one with the same key
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" || name != strings.TrimSpace(name) {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserService struct {
+	sqlDB *sql.DB
+	db    *repository.Queries
+}
+
+func NewUserService(db *sql.DB) *UserService {
+	return &UserService{
+		sqlDB: db,
+		db:    repository.New(db),
+	}
+}
+
+// Create creates the user and returns its id
+func (us *UserService) Create(ctx context.Context, name, password string) (int64, error) {
+	if err := validateName(name); err != nil {
+		return 0, err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	// if there isn't any user an error is returned
+	if _, err := us.db.FetchUser(ctx, name); err == nil {
+		return 0, ErrDuplicateUser
+	}
+
+	id, err := us.db.AddUser(ctx, repository.AddUserParams{
+		Name:     name,
+		Password: hash,
+	})
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicateUser
+	}
+	return id, err
+}
+
+// List returns all the users
+func (us *UserService) List(ctx context.Context) ([]repository.FetchUsersRow, error) {
+	return us.db.FetchUsers(ctx)
+}
+
+func (us *UserService) FetchByName(ctx context.Context, name string) (repository.FetchUserRow, error) {
+	user, err := us.db.FetchUser(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+// SetPassword replaces the password of the user without checking the
+// current one, it is meant for administrators. The sessions of the user are
+// revoked.
+func (us *UserService) SetPassword(ctx context.Context, id int64, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return us.updatePassword(ctx, id, hash)
+}
+
+// Delete deletes the user with its memberships, linked identities and
+// sessions
+func (us *UserService) Delete(ctx context.Context, id int64) error {
+	return withTx(ctx, us.sqlDB, func(q *repository.Queries) error {
+		if err := q.DeleteUserMemberships(ctx, id); err != nil {
+			return err
+		}
+		if err := q.DeleteUserIdentities(ctx, id); err != nil {
+			return err
+		}
+		if err := q.DeleteUserRefreshTokens(ctx, id); err != nil {
+			return err
+		}
+
+		deleted, err := q.DeleteUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+// ChangePassword changes the password of the user, which must prove to know
+// the current one. All the sessions of the user are revoked, the current one
+// too: whoever knew the old password must not keep a session.
+func (us *UserService) ChangePassword(ctx context.Context, id int64, current, password string) error {
+	user, err := us.db.FetchUserByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)); err != nil {
+		return ErrWrongPassword
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return us.updatePassword(ctx, id, hash)
+}
+
+// updatePassword stores the new password hash and revokes the refresh tokens
+// of the user, with the access tokens of their sessions
+func (us *UserService) updatePassword(ctx context.Context, id int64, hash string) error {
+	return withTx(ctx, us.sqlDB, func(q *repository.Queries) error {
+		updated, err := q.UpdateUserPassword(ctx, repository.UpdateUserPasswordParams{
+			Password: hash,
+			ID:       id,
+		})
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrUserNotFound
+		}
+
+		return q.RevokeUserRefreshTokens(ctx, id)
+	})
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+)
+
+type WorkspaceService struct {
+	sqlDB   *sql.DB
+	db      *repository.Queries
+	storage filestorage.Storage
+}
+
+// NewWorkspaceService returns the workspace service, storage is used only to
+// delete the objects of deleted workspaces
+func NewWorkspaceService(db *sql.DB, s filestorage.Storage) *WorkspaceService {
+	return &WorkspaceService{
+		sqlDB:   db,
+		db:      repository.New(db),
+		storage: s,
+	}
+}
+
+// Create creates the workspace, when ownerID is not 0 the user becomes its
+// owner
+func (ws *WorkspaceService) Create(
+	ctx context.Context,
+	name, password string,
+	ownerID int64,
+) (repository.CreateWorkspaceRow, error) {
+	if err := validateName(name); err != nil {
+		return repository.CreateWorkspaceRow{}, err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return repository.CreateWorkspaceRow{}, err
+	}
+
+	var workspace repository.CreateWorkspaceRow
+	err = withTx(ctx, ws.sqlDB, func(q *repository.Queries) error {
+		// if there isn't any workspace an error is returned
+		if _, err := q.FetchWorkspace(ctx, name); err == nil {
+			return ErrDuplicateWorkspace
+		}
+
+		workspace, err = q.CreateWorkspace(ctx, repository.CreateWorkspaceParams{
+			Name:     name,
+			Password: hash,
+		})
+		if isUniqueViolation(err) {
+			return ErrDuplicateWorkspace
+		}
+		if err != nil {
+			return err
+		}
+
+		if ownerID == 0 {
+			return nil
+		}
+
+		return q.AddWorkspaceMember(ctx, repository.AddWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      ownerID,
+			Role:        string(middleware.RoleOwner),
+		})
+	})
+
+	return workspace, err
+}
+
+// List returns all the workspaces
+func (ws *WorkspaceService) List(ctx context.Context) ([]repository.FetchWorkspacesRow, error) {
+	return ws.db.FetchWorkspaces(ctx)
+}
+
+// ListForUser returns the workspaces the user is a member of, with its role
+func (ws *WorkspaceService) ListForUser(ctx context.Context, userID int64) ([]repository.FetchUserWorkspacesRow, error) {
+	return ws.db.FetchUserWorkspaces(ctx, userID)
+}
+
+func (ws *WorkspaceService) FetchByName(ctx context.Context, name string) (repository.FetchWorkspaceRow, error) {
+	workspace, err := ws.db.FetchWorkspace(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workspace, ErrWorkspaceNotFound
+	}
+	return workspace, err
+}
+
+func (ws *WorkspaceService) Fetch(ctx context.Context, id int64) (repository.FetchWorkspaceByIDRow, error) {
+	workspace, err := ws.db.FetchWorkspaceByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workspace, ErrWorkspaceNotFound
+	}
+	return workspace, err
+}
+
+func (ws *WorkspaceService) Rename(ctx context.Context, id int64, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	return withTx(ctx, ws.sqlDB, func(q *repository.Queries) error {
+		if existing, err := q.FetchWorkspace(ctx, name); err == nil && existing.ID != id {
+			return ErrDuplicateWorkspace
+		}
+
+		updated, err := q.UpdateWorkspaceName(ctx, repository.UpdateWorkspaceNameParams{
+			Name: name,
+			ID:   id,
+		})
+		if isUniqueViolation(err) {
+			return ErrDuplicateWorkspace
+		}
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrWorkspaceNotFound
+		}
+		return nil
+	})
+}
+
+// ChangePassword changes the workspace password and revokes the sessions
+// opened with the old one. The sessions of the members are kept.
+func (ws *WorkspaceService) ChangePassword(ctx context.Context, id int64, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return withTx(ctx, ws.sqlDB, func(q *repository.Queries) error {
+		updated, err := q.UpdateWorkspacePassword(ctx, repository.UpdateWorkspacePasswordParams{
+			Password: hash,
+			ID:       id,
+		})
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrWorkspaceNotFound
+		}
+
+		return q.RevokeWorkspaceRefreshTokens(ctx, repository.RevokeWorkspaceRefreshTokensParams{
+			WorkspaceID: id,
+			UserID:      0,
+		})
+	})
+}
+
+// Delete deletes the workspace with its files, members, api keys and
+// sessions. The objects are deleted only once the rows are gone: a failure
+// leaves orphaned objects behind, never files without content.
+func (ws *WorkspaceService) Delete(ctx context.Context, id int64) error {
+	var files []repository.File
+	err := withTx(ctx, ws.sqlDB, func(q *repository.Queries) error {
+		var err error
+		files, err = q.FetchFiles(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := q.DeleteWorkspaceFiles(ctx, id); err != nil {
+			return err
+		}
+		if err := q.DeleteWorkspaceMembers(ctx, id); err != nil {
+			return err
+		}
+		if err := q.DeleteWorkspaceApiKeys(ctx, id); err != nil {
+			return err
+		}
+		if err := q.DeleteWorkspaceRefreshTokens(ctx, id); err != nil {
+			return err
+		}
+
+		deleted, err := q.DeleteWorkspace(ctx, id)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrWorkspaceNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ws.storage.DeleteObject(file.DiskPath); err != nil {
+			log.Printf("error while deleting object %s of workspace %d, %v\n", file.DiskPath, id, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestWorkspaceService(t *testing.T) {
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	ws := NewWorkspaceService(db, mockFileStorage)
+	ctx := context.Background()
+
+	t.Run("should validate name and password", func(t *testing.T) {
+		_, err := ws.Create(ctx, " ", "password", 0)
+		assert.ErrorIs(t, err, ErrInvalidName)
+
+		_, err = ws.Create(ctx, "workspace", "", 0)
+		assert.ErrorIs(t, err, ErrInvalidPassword)
+	})
+
+	t.Run("should not duplicate names", func(t *testing.T) {
+		first, err := ws.Create(ctx, "first", "password", 0)
+		require.NoError(t, err)
+		_, err = ws.Create(ctx, "second", "password", 0)
+		require.NoError(t, err)
+
+		_, err = ws.Create(ctx, "first", "password", 0)
+		assert.ErrorIs(t, err, ErrDuplicateWorkspace)
+
+		assert.ErrorIs(t, ws.Rename(ctx, first.ID, "second"), ErrDuplicateWorkspace)
+		assert.NoError(t, ws.Rename(ctx, first.ID, "first"))
+		assert.ErrorIs(t, ws.Rename(ctx, 999, "third"), ErrWorkspaceNotFound)
+
+		// a concurrent creation is caught by the UNIQUE constraint
+		_, err = repo.CreateWorkspace(ctx, repository.CreateWorkspaceParams{Name: "first", Password: "hash"})
+		assert.True(t, isUniqueViolation(err))
+
+		workspaces, err := ws.List(ctx)
+		require.NoError(t, err)
+		assert.Len(t, workspaces, 2)
+	})
+
+	t.Run("should roll back a failed creation", func(t *testing.T) {
+		userID, err := repo.AddUser(ctx, repository.AddUserParams{Name: "alice", Password: "hash"})
+		require.NoError(t, err)
+		// adding the owner fails after the workspace has been inserted
+		_, err = db.Exec("CREATE TRIGGER fail_members BEFORE INSERT ON workspace_members BEGIN SELECT RAISE(ABORT, 'fail'); END")
+		require.NoError(t, err)
+		t.Cleanup(func() { _, _ = db.Exec("DROP TRIGGER fail_members") })
+
+		_, err = ws.Create(ctx, "third", "password", userID)
+		assert.Error(t, err)
+
+		_, err = repo.FetchWorkspace(ctx, "third")
+		assert.Error(t, err)
+	})
+}
+
+func TestUserService(t *testing.T) {
+	db := testutils.CreateDB(t)
+	us := NewUserService(db)
+	ctx := context.Background()
+
+	id, err := us.Create(ctx, "alice", "password")
+	require.NoError(t, err)
+
+	_, err = us.Create(ctx, "alice", "password")
+	assert.ErrorIs(t, err, ErrDuplicateUser)
+
+	assert.ErrorIs(t, us.ChangePassword(ctx, id, "wrong", "new_password"), ErrWrongPassword)
+	assert.ErrorIs(t, us.ChangePassword(ctx, id, "password", ""), ErrInvalidPassword)
+	assert.NoError(t, us.ChangePassword(ctx, id, "password", "new_password"))
+	assert.ErrorIs(t, us.ChangePassword(ctx, 999, "password", "new_password"), ErrUserNotFound)
+
+	// the sessions opened with the old password are revoked
+	repo := repository.New(db)
+	require.NoError(t, repo.CreateRefreshToken(ctx, repository.CreateRefreshTokenParams{
+		TokenHash:   "hash",
+		FamilyID:    "family",
+		WorkspaceID: 1,
+		UserID:      id,
+		Role:        "viewer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}))
+	assert.NoError(t, us.ChangePassword(ctx, id, "new_password", "other_password"))
+	revoked, err := repo.IsSessionRevoked(ctx, "family")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+
+	assert.NoError(t, us.SetPassword(ctx, id, "reset_password"))
+	assert.NoError(t, us.ChangePassword(ctx, id, "reset_password", "password"))
+
+	require.NoError(t, repository.New(db).AddWorkspaceMember(ctx, repository.AddWorkspaceMemberParams{
+		WorkspaceID: 1,
+		UserID:      id,
+		Role:        "viewer",
+	}))
+	require.NoError(t, us.Delete(ctx, id))
+	assert.ErrorIs(t, us.Delete(ctx, id), ErrUserNotFound)
+
+	_, err = us.FetchByName(ctx, "alice")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	members, err := repository.New(db).FetchWorkspaceMembers(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
@@ -2,43 +2,81 @@ package rtsync
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
-	"github.com/coder/websocket/wsjson"
 	"github.com/google/uuid"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"golang.org/x/time/rate"
 )
 
+// heartbeat configures the pings to the client, a dead connection is
+// detected within interval+timeout
+type heartbeat struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
 type subscriber struct {
-	conn *websocket.Conn
-	w    http.ResponseWriter
-	r    *http.Request
-	ctx  context.Context
-
-	isConnected    atomic.Bool
-	clientId       string
-	chunkMsgQueue  chan ChunkMessage
-	eventMsgQueue  chan EventMessage
-	closeSlow      func()
-	onChunkMessage func(ChunkMessage)
-	onEventMessage func(EventMessage)
+	conn  *websocket.Conn
+	codec codec
+	w     http.ResponseWriter
+	r     *http.Request
+	ctx   context.Context
+
+	heartbeat heartbeat
+	// writeTimeout bounds the writes to the client, a client unable to
+	// receive a message for that long is disconnected
+	writeTimeout time.Duration
+	isConnected  atomic.Bool
+	compressed   bool
+	// presence is false if the client didn't ask for it in the hello
+	presence    bool
+	done        chan struct{}
+	closeOnce   sync.Once
+	clientId    string
+	userID      int64
+	workspaceID int64
+	role        middleware.Role
+	// clientLimiter and workspaceLimiter limit the operations of the
+	// client, they're set once the subscriber is added
+	clientLimiter    *rate.Limiter
+	workspaceLimiter *rate.Limiter
+	outbox           *chunkOutbox
+	presenceMsgQueue chan PresenceMessage
+	closeSlow        func()
+	onChunkMessage   func(ChunkMessage) error
+	onEventMessage   func(EventMessage) error
+	// onPresenceMessage returns the presence of the other clients when the
+	// client announces itself for the first time
+	onPresenceMessage     func(PresenceMessage) ([]PresenceMessage, error)
+	onSubscriptionMessage func(*subscriber, SubscriptionMessage) error
 }
 
+// NewSubscriber accepts the websocket connection, the request must have
+// been authenticated by middleware.IsAuthenticated
 func NewSubscriber(
 	ctx context.Context,
 	w http.ResponseWriter,
 	r *http.Request,
-	onChunkMessage func(ChunkMessage),
-	onEventMessage func(EventMessage),
+	hb heartbeat,
+	writeTimeout time.Duration,
+	onChunkMessage func(ChunkMessage) error,
+	onEventMessage func(EventMessage) error,
+	onPresenceMessage func(PresenceMessage) ([]PresenceMessage, error),
+	onSubscriptionMessage func(*subscriber, SubscriptionMessage) error,
 ) (*subscriber, error) {
 	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-		OriginPatterns: []string{"127.0.0.1", "obsidian.md"},
+		OriginPatterns:  []string{"127.0.0.1", "obsidian.md"},
+		Subprotocols:    []string{SubprotocolMsgPack, SubprotocolJSON},
+		CompressionMode: websocket.CompressionNoContextTakeover,
 	})
 	if err != nil {
 		return nil, err
@@ -46,21 +84,32 @@ func NewSubscriber(
 
 	const subscriberMessageBuffer = 8
 	s := &subscriber{
-		conn:          c,
-		w:             w,
-		r:             r,
-		ctx:           ctx,
-		isConnected:   atomic.Bool{},
-		chunkMsgQueue: make(chan ChunkMessage, subscriberMessageBuffer),
-		eventMsgQueue: make(chan EventMessage, subscriberMessageBuffer),
-		clientId:      uuid.New().String(),
+		conn:             c,
+		codec:            codecFor(c.Subprotocol()),
+		heartbeat:        hb,
+		writeTimeout:     writeTimeout,
+		w:                w,
+		r:                r,
+		ctx:              ctx,
+		isConnected:      atomic.Bool{},
+		compressed:       strings.Contains(w.Header().Get("Sec-WebSocket-Extensions"), CompressionDeflate),
+		presence:         true,
+		done:             make(chan struct{}),
+		outbox:           newChunkOutbox(),
+		presenceMsgQueue: make(chan PresenceMessage, subscriberMessageBuffer),
+		clientId:         uuid.New().String(),
+		userID:           middleware.UserIDFromCtx(r.Context()),
+		workspaceID:      middleware.WorkspaceIDFromCtx(r.Context()),
+		role:             middleware.RoleFromCtx(r.Context()),
 		closeSlow: func() {
 			if c != nil {
 				c.Close(websocket.StatusPolicyViolation, "connection too slow to keep up with messages")
 			}
 		},
-		onChunkMessage: onChunkMessage,
-		onEventMessage: onEventMessage,
+		onChunkMessage:        onChunkMessage,
+		onEventMessage:        onEventMessage,
+		onPresenceMessage:     onPresenceMessage,
+		onSubscriptionMessage: onSubscriptionMessage,
 	}
 
 	s.isConnected.Store(true)
@@ -74,163 +123,328 @@ func (s *subscriber) IsOpen() bool {
 
 func (s *subscriber) Close() error {
 	s.isConnected.Store(false)
+	s.closeOnce.Do(func() { close(s.done) })
 	return s.conn.CloseNow()
 }
 
+// Listen serves the connection until it's closed or the server stops,
+// once it returns every goroutine of the subscriber has exited
 func (s *subscriber) Listen() {
-	// on ws message
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		s.readLoop()
+	}()
+	go func() {
+		defer wg.Done()
+		s.writeLoop()
+	}()
 	go func() {
-		for {
-			if !s.IsOpen() {
+		defer wg.Done()
+		s.heartbeatLoop()
+	}()
+
+	select {
+	case <-s.ctx.Done():
+		s.Close()
+	case <-s.done:
+	}
+
+	wg.Wait()
+}
+
+// readLoop handles the messages of the client, a failed read means the
+// connection is gone
+func (s *subscriber) readLoop() {
+	first := true
+	for {
+		if !s.IsOpen() {
+			return
+		}
+
+		msgType, msg, err := s.ReadMessage()
+		if err != nil {
+			if s.IsOpen() {
+				log.Println(err)
+				continue
+			}
+			return
+		}
+
+		isFirst := first
+		first = false
+
+		switch msgType {
+		case HelloEventType:
+			var hello HelloMessage
+			err := s.codec.Unmarshal(msg, &hello)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if !isFirst {
+				s.writeError(hello.WsMessageHeader, errors.New(ErrHelloNotFirst))
+				continue
+			}
+
+			reply, err := s.negotiate(hello)
+			if err != nil {
+				s.conn.Close(StatusIncompatibleProtocol, err.Error())
+				s.Close()
 				return
 			}
 
-			msg, err := s.WaitMessage()
+			if err := s.WriteMessage(reply); err != nil {
+				log.Println("error writing message to client", err)
+			}
+		case ChunkEventType:
+			var chunk ChunkMessage
+			err := s.codec.Unmarshal(msg, &chunk)
 			if err != nil {
 				log.Println(err)
 				continue
 			}
 
-			msgType, err := s.MessageType(msg)
+			if !s.allowOp(chunk.WsMessageHeader) {
+				continue
+			}
+
+			chunk.SenderId = s.clientId
+			chunk.WorkspaceId = s.workspaceID
+			chunk.SenderRole = s.role
+
+			if err := s.onChunkMessage(chunk); err != nil {
+				s.writeError(chunk.WsMessageHeader, err)
+			}
+		case RenameEventType, CreateEventType, DeleteEventType:
+			var event EventMessage
+			err := s.codec.Unmarshal(msg, &event)
 			if err != nil {
 				log.Println(err)
 				continue
 			}
 
-			switch msgType {
-			case ChunkEventType:
-				var chunk ChunkMessage
-				err := mapToStruct(msg, &chunk)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
+			if !s.allowOp(event.WsMessageHeader) {
+				continue
+			}
 
-				chunk.SenderId = s.clientId
+			event.SenderId = s.clientId
+			event.WorkspaceId = s.workspaceID
+			event.SenderRole = s.role
 
-				s.onChunkMessage(chunk)
-			case RenameEventType, CreateEventType, DeleteEventType:
-				var event EventMessage
-				err := mapToStruct(msg, &event)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
+			if err := s.onEventMessage(event); err != nil {
+				s.writeError(event.WsMessageHeader, err)
+			}
+		case PresenceEventType:
+			var presence PresenceMessage
+			err := s.codec.Unmarshal(msg, &presence)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
 
-				event.SenderId = s.clientId
+			if !s.allowMessage(presence.WsMessageHeader) {
+				continue
+			}
 
-				s.onEventMessage(event)
+			if !s.presence {
+				s.writeError(presence.WsMessageHeader, errors.New(ErrPresenceNotEnabled))
+				continue
 			}
-		}
-	}()
 
-	// on internal queue event
-	go func() {
-		for {
-			select {
-			case chunkMsg := <-s.chunkMsgQueue:
-				if chunkMsg.SenderId == s.clientId {
-					continue
-				}
+			presence.SenderId = s.clientId
+			presence.WorkspaceId = s.workspaceID
+			presence.SenderRole = s.role
+			presence.ClientId = s.clientId
+			presence.UserId = s.userID
+			presence.Left = false
 
-				err := s.WriteMessage(chunkMsg, time.Second*1)
-				if err != nil {
+			others, err := s.onPresenceMessage(presence)
+			if err != nil {
+				s.writeError(presence.WsMessageHeader, err)
+				continue
+			}
+
+			for _, other := range others {
+				if err := s.WriteMessage(other); err != nil {
 					log.Println("error writing message to client", err)
 				}
-			case eventMsg := <-s.eventMsgQueue:
-				if eventMsg.SenderId == s.clientId {
-					continue
-				}
+			}
+		case SubscribeEventType, UnsubscribeEventType:
+			var subscription SubscriptionMessage
+			err := s.codec.Unmarshal(msg, &subscription)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if !s.allowMessage(subscription.WsMessageHeader) {
+				continue
+			}
+
+			subscription.SenderId = s.clientId
+			subscription.WorkspaceId = s.workspaceID
+			subscription.SenderRole = s.role
+
+			if err := s.onSubscriptionMessage(s, subscription); err != nil {
+				s.writeError(subscription.WsMessageHeader, err)
+			}
+		}
+	}
+}
 
-				err := s.WriteMessage(eventMsg, time.Second*1)
+// writeLoop sends the messages queued for the client, a failed write closes
+// the connection
+func (s *subscriber) writeLoop() {
+	for {
+		select {
+		case <-s.outbox.ready:
+			for _, entry := range s.outbox.pop() {
+				err := s.WriteMessage(entry.message())
 				if err != nil {
 					log.Println("error writing message to client", err)
+					s.Close()
+					return
 				}
-			case <-s.ctx.Done():
-				s.Close()
-				return
-			case <-s.r.Context().Done():
+			}
+			s.outbox.sent()
+		case presenceMsg := <-s.presenceMsgQueue:
+			if presenceMsg.SenderId == s.clientId {
+				continue
+			}
+
+			err := s.WriteMessage(presenceMsg)
+			if err != nil {
+				log.Println("error writing message to client", err)
 				s.Close()
 				return
 			}
+		case <-s.done:
+			return
+		case <-s.ctx.Done():
+			s.Close()
+			return
+		case <-s.r.Context().Done():
+			s.Close()
+			return
 		}
-	}()
-
-	<-s.ctx.Done()
+	}
 }
 
-func (s *subscriber) ParseChunkMessage() (ChunkMessage, error) {
-	var data ChunkMessage
+// heartbeatLoop pings the client, closing the connection if the pong
+// doesn't arrive in time. The pong is read by readLoop.
+func (s *subscriber) heartbeatLoop() {
+	if s.heartbeat.interval <= 0 {
+		return
+	}
 
-	err := wsjson.Read(s.ctx, s.conn, &data)
-	if err != nil {
-		if websocket.CloseStatus(err) != -1 || strings.Contains(err.Error(), "EOF") {
-			s.Close()
-			return data, fmt.Errorf("client %s disconnected", s.clientId)
-		}
+	ticker := time.NewTicker(s.heartbeat.interval)
+	defer ticker.Stop()
 
-		return data, err
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(s.ctx, s.heartbeat.timeout)
+			err := s.conn.Ping(ctx)
+			cancel()
+			if err != nil {
+				log.Printf("client %s not responding, %v", s.clientId, err)
+				s.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
 	}
-
-	return data, err
 }
 
-func (s *subscriber) ParseEventMessage() (EventMessage, error) {
-	var data EventMessage
-
-	err := wsjson.Read(s.ctx, s.conn, &data)
+// ReadMessage returns the type of the next message and the message, to be
+// decoded with the codec of the connection
+func (s *subscriber) ReadMessage() (MessageType, []byte, error) {
+	_, data, err := s.conn.Read(s.ctx)
 	if err != nil {
-		if websocket.CloseStatus(err) != -1 || strings.Contains(err.Error(), "EOF") {
-			s.Close()
-			return data, fmt.Errorf("client %s disconnected", s.clientId)
-		}
+		s.Close()
+		return 0, nil, fmt.Errorf("client %s disconnected, %w", s.clientId, err)
+	}
 
-		return data, err
+	msgType, err := decodeEnvelope(s.codec, data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid message from client %s: %w", s.clientId, err)
 	}
 
-	return data, err
+	return msgType, data, nil
 }
 
-func (s *subscriber) MessageType(data map[string]any) (int, error) {
-	msgType, ok := data["type"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("type in %+v not present", data)
+// WriteMessage sends the message, waiting at most writeTimeout for the
+// client: the connection is closed by a write running out of time, so the
+// client is given as long as it can be behind
+func (s *subscriber) WriteMessage(msg any) error {
+	data, err := s.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.ctx
+	if s.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(s.ctx, s.writeTimeout)
+		defer cancel()
 	}
 
-	return int(msgType), nil
+	return s.conn.Write(ctx, s.codec.frameType(), data)
 }
 
-func (s *subscriber) WaitMessage() (map[string]any, error) {
-	var msg map[string]any
+// allowOp reports whether the client can send an operation, which takes a
+// token from the buckets of the connection and of the workspace
+func (s *subscriber) allowOp(header WsMessageHeader) bool {
+	return s.allow(header, s.clientLimiter, s.workspaceLimiter)
+}
 
-	err := wsjson.Read(s.ctx, s.conn, &msg)
-	if err != nil {
-		if websocket.CloseStatus(err) != -1 || strings.Contains(err.Error(), "EOF") {
-			s.Close()
-			return msg, fmt.Errorf("client %s disconnected", s.clientId)
-		}
+// allowMessage reports whether the client can send a message which isn't an
+// operation on the files, like a presence or a subscription, only the
+// bucket of the connection is used
+func (s *subscriber) allowMessage(header WsMessageHeader) bool {
+	return s.allow(header, s.clientLimiter)
+}
 
-		return msg, err
+// allow takes a token from every bucket, otherwise it tells the client when
+// to retry
+func (s *subscriber) allow(header WsMessageHeader, limiters ...*rate.Limiter) bool {
+	retryAfter, ok := allowOp(time.Now(), limiters...)
+	if ok {
+		return true
 	}
 
-	return msg, nil
-}
-
-func (s *subscriber) WriteMessage(msg any, timeout time.Duration) error {
-	ctx, cancel := context.WithTimeout(s.ctx, timeout)
-	defer cancel()
+	msg := ErrorMessage{
+		WsMessageHeader: WsMessageHeader{
+			FileId: header.FileId,
+			Type:   ErrorEventType,
+		},
+		Error:      ErrRateLimited,
+		RetryAfter: retryAfter.Milliseconds(),
+	}
+	if err := s.WriteMessage(msg); err != nil {
+		log.Println("error writing message to client", err)
+	}
 
-	return wsjson.Write(ctx, s.conn, msg)
+	return false
 }
 
-func mapToStruct(data map[string]any, result interface{}) error {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return err
+// writeError notifies the client that the message with the given header
+// has been rejected
+func (s *subscriber) writeError(header WsMessageHeader, reason error) {
+	msg := ErrorMessage{
+		WsMessageHeader: WsMessageHeader{
+			FileId: header.FileId,
+			Type:   ErrorEventType,
+		},
+		Error: reason.Error(),
 	}
 
-	if err := json.Unmarshal(jsonData, &result); err != nil {
-		return err
+	if err := s.WriteMessage(msg); err != nil {
+		log.Println("error writing message to client", err)
 	}
-	return nil
 }
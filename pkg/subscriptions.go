@@ -0,0 +1,127 @@
+package rtsync
+
+import (
+	"errors"
+	"strings"
+)
+
+const ErrInvalidSubscription = "invalid subscription"
+
+// SubscriptionMessage subscribes the client to the chunks of a file, by
+// FileId, or of the files with a path starting with Prefix. Clients which
+// never subscribed receive the chunks of every file of the workspace, the
+// others only of the files they subscribed to. The events are always sent
+// for the whole workspace.
+type SubscriptionMessage struct {
+	WsMessageHeader
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// subscriptionIndex keeps the subscribers of every file and path prefix of
+// a workspace, it's guarded by its ws.subscribersMu
+type subscriptionIndex struct {
+	files    map[int64]map[*subscriber]struct{}
+	prefixes map[*subscriber]map[string]struct{}
+	// filtered are the subscribers which subscribed at least once
+	filtered map[*subscriber]struct{}
+}
+
+func newSubscriptionIndex() subscriptionIndex {
+	return subscriptionIndex{
+		files:    make(map[int64]map[*subscriber]struct{}),
+		prefixes: make(map[*subscriber]map[string]struct{}),
+		filtered: make(map[*subscriber]struct{}),
+	}
+}
+
+func (si *subscriptionIndex) subscribeFile(s *subscriber, fileID int64) {
+	si.filtered[s] = struct{}{}
+	if _, ok := si.files[fileID]; !ok {
+		si.files[fileID] = make(map[*subscriber]struct{})
+	}
+	si.files[fileID][s] = struct{}{}
+}
+
+func (si *subscriptionIndex) unsubscribeFile(s *subscriber, fileID int64) {
+	delete(si.files[fileID], s)
+	if len(si.files[fileID]) == 0 {
+		delete(si.files, fileID)
+	}
+}
+
+func (si *subscriptionIndex) subscribePrefix(s *subscriber, prefix string) {
+	si.filtered[s] = struct{}{}
+	if _, ok := si.prefixes[s]; !ok {
+		si.prefixes[s] = make(map[string]struct{})
+	}
+	si.prefixes[s][prefix] = struct{}{}
+}
+
+func (si *subscriptionIndex) unsubscribePrefix(s *subscriber, prefix string) {
+	delete(si.prefixes[s], prefix)
+	if len(si.prefixes[s]) == 0 {
+		delete(si.prefixes, s)
+	}
+}
+
+// remove deletes all the subscriptions of the subscriber
+func (si *subscriptionIndex) remove(s *subscriber) {
+	for fileID := range si.files {
+		si.unsubscribeFile(s, fileID)
+	}
+	delete(si.prefixes, s)
+	delete(si.filtered, s)
+}
+
+// receives reports if the subscriber must receive the chunks of the file
+func (si *subscriptionIndex) receives(s *subscriber, fileID int64, workspacePath string) bool {
+	if _, ok := si.filtered[s]; !ok {
+		return true
+	}
+	if _, ok := si.files[fileID][s]; ok {
+		return true
+	}
+	if workspacePath == "" {
+		return false
+	}
+	for prefix := range si.prefixes[s] {
+		if strings.HasPrefix(workspacePath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rts *realTimeSyncServer) onSubscriptionMessage(s *subscriber, msg SubscriptionMessage) error {
+	if (msg.FileId == 0) == (msg.Prefix == "") {
+		return errors.New(ErrInvalidSubscription)
+	}
+
+	ws := rts.hub.workspace(s.workspaceID)
+
+	// the subscribed file is loaded, ready to be edited
+	if msg.FileId != 0 && msg.Type == SubscribeEventType {
+		ws.mut.Lock()
+		_, err := rts.loadFile(ws, msg.FileId)
+		ws.mut.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	ws.subscribersMu.Lock()
+	defer ws.subscribersMu.Unlock()
+
+	switch {
+	case msg.Type == SubscribeEventType && msg.FileId != 0:
+		ws.subscriptions.subscribeFile(s, msg.FileId)
+	case msg.Type == SubscribeEventType:
+		ws.subscriptions.subscribePrefix(s, msg.Prefix)
+	case msg.FileId != 0:
+		ws.subscriptions.unsubscribeFile(s, msg.FileId)
+	default:
+		ws.subscriptions.unsubscribePrefix(s, msg.Prefix)
+	}
+
+	return nil
+}
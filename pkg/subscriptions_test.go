@@ -0,0 +1,149 @@
+package rtsync
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_subscriptions(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	mockFileStorage := new(filestorage.MockFileStorage)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	create := func(workspaceID int64, path string) repository.File {
+		file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+			DiskPath:      path,
+			WorkspacePath: path,
+			WorkspaceID:   workspaceID,
+		})
+		require.NoError(t, err)
+		return file
+	}
+	note := create(1, "notes/note.md")
+	journal := create(1, "journal/today.md")
+	otherWorkspace := create(2, "notes/other.md")
+	mockFileStorage.On("ReadObject", mock.Anything).Return([]byte{}, nil)
+	mockFileStorage.On("WriteObject", mock.Anything, mock.Anything).Return(nil)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	dial := func() *websocket.Conn {
+		//nolint:bodyclose
+		conn, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleEditor))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+		return conn
+	}
+
+	// subscribe waits the subscription to be applied: the messages of a
+	// client are handled in order, so the error of an invalid one comes after
+	subscribe := func(conn *websocket.Conn, msg SubscriptionMessage) ErrorMessage {
+		require.NoError(t, wsjson.Write(ctx, conn, msg))
+		require.NoError(t, wsjson.Write(ctx, conn, SubscriptionMessage{
+			WsMessageHeader: WsMessageHeader{Type: SubscribeEventType},
+		}))
+
+		var errMsg ErrorMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &errMsg))
+		if errMsg.Error != ErrInvalidSubscription {
+			var last ErrorMessage
+			require.NoError(t, wsjson.Read(ctx, conn, &last))
+			require.Equal(t, ErrInvalidSubscription, last.Error)
+		}
+		return errMsg
+	}
+	sendChunk := func(conn *websocket.Conn, fileID int64) {
+		require.NoError(t, wsjson.Write(ctx, conn, ChunkMessage{
+			WsMessageHeader: WsMessageHeader{Type: ChunkEventType, FileId: fileID},
+			Chunks:          []diff.DiffChunk{{Type: diff.DiffAdd, Position: 0, Text: "a", Len: 1}},
+		}))
+	}
+	sendEvent := func(conn *websocket.Conn) {
+		require.NoError(t, wsjson.Write(ctx, conn, EventMessage{
+			WsMessageHeader: WsMessageHeader{Type: CreateEventType, FileId: 100},
+			WorkspacePath:   "new.md",
+		}))
+	}
+	read := func(conn *websocket.Conn) WsMessageHeader {
+		var msg WsMessageHeader
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		return msg
+	}
+
+	sender := dial()
+	fileSubscriber := dial()
+	prefixSubscriber := dial()
+	everything := dial()
+
+	errMsg := subscribe(fileSubscriber, SubscriptionMessage{
+		WsMessageHeader: WsMessageHeader{Type: SubscribeEventType, FileId: note.ID},
+	})
+	require.Equal(t, ErrInvalidSubscription, errMsg.Error)
+	errMsg = subscribe(prefixSubscriber, SubscriptionMessage{
+		WsMessageHeader: WsMessageHeader{Type: SubscribeEventType},
+		Prefix:          "journal/",
+	})
+	require.Equal(t, ErrInvalidSubscription, errMsg.Error)
+
+	t.Run("should deliver the chunks only to the subscribers of the file", func(t *testing.T) {
+		sendChunk(sender, note.ID)
+		assert.Equal(t, WsMessageHeader{Type: ChunkEventType, FileId: note.ID}, read(everything))
+		assert.Equal(t, WsMessageHeader{Type: ChunkEventType, FileId: note.ID}, read(fileSubscriber))
+
+		sendChunk(sender, journal.ID)
+		assert.Equal(t, WsMessageHeader{Type: ChunkEventType, FileId: journal.ID}, read(everything))
+		assert.Equal(t, WsMessageHeader{Type: ChunkEventType, FileId: journal.ID}, read(prefixSubscriber))
+
+		// the events reach everyone, and before them no other chunk
+		sendEvent(sender)
+		for _, conn := range []*websocket.Conn{everything, fileSubscriber, prefixSubscriber} {
+			assert.Equal(t, WsMessageHeader{Type: CreateEventType, FileId: 100}, read(conn))
+		}
+	})
+
+	t.Run("should stop delivering the chunks once unsubscribed", func(t *testing.T) {
+		subscribe(fileSubscriber, SubscriptionMessage{
+			WsMessageHeader: WsMessageHeader{Type: UnsubscribeEventType, FileId: note.ID},
+		})
+
+		sendChunk(sender, note.ID)
+		assert.Equal(t, WsMessageHeader{Type: ChunkEventType, FileId: note.ID}, read(everything))
+
+		sendEvent(sender)
+		assert.Equal(t, WsMessageHeader{Type: CreateEventType, FileId: 100}, read(fileSubscriber))
+	})
+
+	t.Run("should refuse the files of other workspaces", func(t *testing.T) {
+		errMsg := subscribe(fileSubscriber, SubscriptionMessage{
+			WsMessageHeader: WsMessageHeader{Type: SubscribeEventType, FileId: otherWorkspace.ID},
+		})
+		assert.Equal(t, ErrNotExistingFile, errMsg.Error)
+	})
+}
@@ -0,0 +1,242 @@
+package rtsync
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+)
+
+const refreshTokenDuration = 30 * 24 * time.Hour
+
+type RefreshTokenBody struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+const (
+	ErrInvalidRefreshToken = "invalid refresh token"
+	ErrReusedRefreshToken  = "refresh token already used, all the session tokens have been revoked"
+)
+
+// revocationList checks the `jti` of the access tokens against the
+// revoked_tokens table, and their session against the revoked refresh token
+// families
+type revocationList struct {
+	db *repository.Queries
+}
+
+func (rl revocationList) IsRevoked(ctx context.Context, jti, session string) bool {
+	count, err := rl.db.IsTokenRevoked(ctx, jti)
+	if err == nil && count == 0 && session != "" {
+		count, err = rl.db.IsSessionRevoked(ctx, session)
+	}
+	if err != nil {
+		log.Println(err)
+		return true
+	}
+
+	return count > 0
+}
+
+func (rts *realTimeSyncServer) authOptions() middleware.AuthOptions {
+	return middleware.AuthOptions{
+		SecretKey:   rts.jwtSecret,
+		Revocations: revocationList{db: rts.db},
+		ApiKeys:     apiKeyVerifier{db: rts.db},
+		Members:     memberRoles{db: rts.db},
+		Workspaces:  deletedWorkspaces{db: rts.db},
+	}
+}
+
+// issueTokens creates an access token and a refresh token for identity.
+// The refresh token belongs to familyID, a new family is created when empty.
+func (rts *realTimeSyncServer) issueTokens(
+	ctx context.Context,
+	identity middleware.Identity,
+	familyID string,
+) (LoginResponse, error) {
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	identity.Session = familyID
+
+	token, err := middleware.CreateToken(rts.authOptions(), identity)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	refreshToken, err := randomString()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	err = rts.db.CreateRefreshToken(ctx, repository.CreateRefreshTokenParams{
+		TokenHash:   hashSecret(refreshToken),
+		FamilyID:    familyID,
+		WorkspaceID: identity.WorkspaceID,
+		UserID:      identity.UserID,
+		Role:        string(identity.Role),
+		ExpiresAt:   time.Now().Add(refreshTokenDuration),
+	})
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	return LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// refreshTokenHandler rotates the refresh token. Each refresh token can be
+// used only once, using it twice means it has been leaked and the whole
+// family is revoked, with the access tokens issued to it.
+func (rts *realTimeSyncServer) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data RefreshTokenBody
+	if err := json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := rts.db.FetchRefreshToken(r.Context(), hashSecret(data.RefreshToken))
+	if err != nil {
+		http.Error(w, ErrInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	if stored.RevokedAt.Valid || time.Now().After(stored.ExpiresAt) {
+		http.Error(w, ErrInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	used, err := rts.db.UseRefreshToken(r.Context(), stored.ID)
+	if err != nil {
+		http.Error(w, "error while creating auth token", http.StatusInternalServerError)
+		return
+	}
+
+	if used == 0 {
+		if err := rts.db.RevokeRefreshTokenFamily(r.Context(), stored.FamilyID); err != nil {
+			log.Println(err)
+		}
+		http.Error(w, ErrReusedRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	identity := middleware.Identity{
+		WorkspaceID: stored.WorkspaceID,
+		UserID:      stored.UserID,
+		Role:        middleware.Role(stored.Role),
+	}
+
+	// the membership could have been changed since the login
+	if identity.UserID != 0 {
+		member, err := rts.db.FetchWorkspaceMember(r.Context(), repository.FetchWorkspaceMemberParams{
+			WorkspaceID: identity.WorkspaceID,
+			UserID:      identity.UserID,
+		})
+		if err != nil {
+			http.Error(w, ErrNotMember, http.StatusForbidden)
+			return
+		}
+		identity.Role = middleware.Role(member.Role)
+	}
+
+	response, err := rts.issueTokens(r.Context(), identity, stored.FamilyID)
+	if err != nil {
+		http.Error(w, "error while creating auth token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// logoutHandler revokes the access token in the Authorization header and
+// the family of the refresh token in the body, both are optional
+func (rts *realTimeSyncServer) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data RefreshTokenBody
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &data); err != nil {
+			http.Error(w, "error parsing JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if encodedToken, ok := middleware.BearerToken(r); ok {
+		claims, err := middleware.ParseToken(rts.authOptions(), encodedToken)
+		if err == nil {
+			if err := rts.revokeToken(r.Context(), claims); err != nil {
+				http.Error(w, "error while revoking auth token", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if data.RefreshToken != "" {
+		stored, err := rts.db.FetchRefreshToken(r.Context(), hashSecret(data.RefreshToken))
+		if err == nil {
+			if err := rts.db.RevokeRefreshTokenFamily(r.Context(), stored.FamilyID); err != nil {
+				http.Error(w, "error while revoking auth token", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeToken adds the access token to the revocation list, dropping the
+// tokens expired in the meantime, which are refused anyway
+func (rts *realTimeSyncServer) revokeToken(ctx context.Context, claims *middleware.CustomClaims) error {
+	if err := rts.db.DeleteExpiredRevokedTokens(ctx, time.Now()); err != nil {
+		return err
+	}
+
+	return rts.db.RevokeToken(ctx, repository.RevokeTokenParams{
+		Jti:       claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+}
+
+// hashSecret returns the digest under which refresh tokens and API keys are
+// stored, they are random enough not to need a salt
+func hashSecret(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// randomString returns 256 random bits, url-safe encoded
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
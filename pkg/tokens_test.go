@@ -0,0 +1,182 @@
+package rtsync
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_refreshTokenHandler(t *testing.T) {
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	mockFileStorage := new(filestorage.MockFileStorage)
+	server := New(db, mockFileStorage, Options{JWTSecret: []byte("secret")})
+
+	t.Cleanup(func() { server.Close() })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("strong_password"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.AddWorkspace(context.Background(), repository.AddWorkspaceParams{
+		Name:     "workspace1",
+		Password: string(hash),
+	}))
+
+	login := func(t *testing.T) LoginResponse {
+		data := WorkspaceCredentials{Name: "workspace1", Password: "strong_password"}
+		res, body := testutils.DoRequest[LoginResponse](t, server, http.MethodPost, PathHttpAuth+"/login", data)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.NotEmpty(t, body.RefreshToken)
+		return body
+	}
+
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		tokens := login(t)
+
+		res, body := testutils.DoRequest[LoginResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/refresh",
+			RefreshTokenBody{RefreshToken: tokens.RefreshToken},
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.NotEmpty(t, body.Token)
+		assert.NotEqual(t, tokens.RefreshToken, body.RefreshToken)
+
+		res, _ = testutils.DoRequest[[]repository.File](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/file",
+			nil,
+			testutils.WithToken(body.Token),
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("should revoke the family on reuse", func(t *testing.T) {
+		tokens := login(t)
+
+		res, rotated := testutils.DoRequest[LoginResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/refresh",
+			RefreshTokenBody{RefreshToken: tokens.RefreshToken},
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+
+		res, errBody := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/refresh",
+			RefreshTokenBody{RefreshToken: tokens.RefreshToken},
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrReusedRefreshToken, errBody)
+
+		// the legit rotated token is revoked too
+		res, errBody = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/refresh",
+			RefreshTokenBody{RefreshToken: rotated.RefreshToken},
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrInvalidRefreshToken, errBody)
+
+		// and so are the access tokens of the family
+		for _, token := range []string{tokens.Token, rotated.Token} {
+			res, _ = testutils.DoRequest[string](
+				t,
+				server,
+				http.MethodGet,
+				PathHttpApi+"/file",
+				nil,
+				testutils.WithToken(token),
+			)
+			assert.Equal(t, http.StatusUnauthorized, res.Code)
+		}
+	})
+
+	t.Run("should reject unknown refresh tokens", func(t *testing.T) {
+		res, errBody := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/refresh",
+			RefreshTokenBody{RefreshToken: "not-a-token"},
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrInvalidRefreshToken, errBody)
+	})
+
+	t.Run("should revoke both tokens on logout", func(t *testing.T) {
+		tokens := login(t)
+
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/logout",
+			RefreshTokenBody{RefreshToken: tokens.RefreshToken},
+			testutils.WithToken(tokens.Token),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/file",
+			nil,
+			testutils.WithToken(tokens.Token),
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		res, errBody := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/refresh",
+			RefreshTokenBody{RefreshToken: tokens.RefreshToken},
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, ErrInvalidRefreshToken, errBody)
+	})
+
+	t.Run("should prune the expired revoked tokens on logout", func(t *testing.T) {
+		require.NoError(t, repo.RevokeToken(context.Background(), repository.RevokeTokenParams{
+			Jti:       "expired",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		tokens := login(t)
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/logout",
+			nil,
+			testutils.WithToken(tokens.Token),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		count, err := repo.IsTokenRevoked(context.Background(), "expired")
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
@@ -0,0 +1,236 @@
+package rtsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/coder/websocket"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/service"
+)
+
+type CreateWorkspaceBody struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// UpdateWorkspaceBody renames the workspace and/or changes its password,
+// empty fields are left unchanged
+type UpdateWorkspaceBody struct {
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type ChangePasswordBody struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+}
+
+const (
+	ErrDuplicateWorkspace   = "workspace already exists"
+	ErrInvalidWorkspaceName = "invalid workspace name"
+	ErrInvalidPassword      = "invalid password"
+	ErrInvalidWorkspace     = "impossible to update workspace"
+	ErrWrongPassword        = "wrong current password"
+	ErrNotUser              = "the session doesn't belong to a user"
+)
+
+// deletedWorkspaces reads the deleted workspaces from the workspaces table,
+// whose ids are never reused
+type deletedWorkspaces struct {
+	db *repository.Queries
+}
+
+func (dw deletedWorkspaces) IsWorkspaceDeleted(ctx context.Context, workspaceID int64) bool {
+	deleted, err := dw.db.IsWorkspaceDeleted(ctx, workspaceID)
+	return err != nil || deleted > 0
+}
+
+func (rts *realTimeSyncServer) listWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	var workspaces []repository.FetchUserWorkspacesRow
+
+	// a session opened with the workspace password sees only its workspace
+	if userID := middleware.UserIDFromCtx(r.Context()); userID != 0 {
+		var err error
+		workspaces, err = rts.workspaces.ListForUser(r.Context(), userID)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		workspace, err := rts.workspaces.Fetch(r.Context(), middleware.WorkspaceIDFromCtx(r.Context()))
+		if err != nil {
+			http.Error(w, ErrWorkspaceNotFound, http.StatusNotFound)
+			return
+		}
+
+		workspaces = append(workspaces, repository.FetchUserWorkspacesRow{
+			ID:        workspace.ID,
+			Name:      workspace.Name,
+			Role:      string(middleware.RoleFromCtx(r.Context())),
+			CreatedAt: workspace.CreatedAt,
+			UpdatedAt: workspace.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(workspaces); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// createWorkspaceHandler creates a workspace owned by the user, a session
+// opened with a workspace password can't create workspaces
+func (rts *realTimeSyncServer) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserIDFromCtx(r.Context())
+	if userID == 0 {
+		http.Error(w, ErrNotUser, http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data CreateWorkspaceBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := rts.workspaces.Create(
+		r.Context(),
+		data.Name,
+		data.Password,
+		userID,
+	)
+	if err != nil {
+		workspaceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(workspace); err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rts *realTimeSyncServer) updateWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data UpdateWorkspaceBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	if data.Name == "" && data.Password == "" {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	if data.Name != "" {
+		if err := rts.workspaces.Rename(r.Context(), workspaceID, data.Name); err != nil {
+			workspaceError(w, err)
+			return
+		}
+	}
+
+	if data.Password != "" {
+		if err := rts.workspaces.ChangePassword(r.Context(), workspaceID, data.Password); err != nil {
+			workspaceError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rts *realTimeSyncServer) deleteWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspaceID := middleware.WorkspaceIDFromCtx(r.Context())
+
+	if err := rts.workspaces.Delete(r.Context(), workspaceID); err != nil {
+		workspaceError(w, err)
+		return
+	}
+
+	ws := rts.hub.workspace(workspaceID)
+	ws.mut.Lock()
+	for fileID := range ws.files {
+		ws.forget(fileID)
+	}
+	ws.mut.Unlock()
+
+	ws.subscribersMu.Lock()
+	for s := range ws.subscribers {
+		go s.conn.Close(websocket.StatusNormalClosure, "workspace deleted")
+	}
+	ws.subscribersMu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rts *realTimeSyncServer) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserIDFromCtx(r.Context())
+	if userID == 0 {
+		http.Error(w, ErrNotUser, http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var data ChangePasswordBody
+	if err = json.Unmarshal(body, &data); err != nil {
+		http.Error(w, "error parsing JSON", http.StatusBadRequest)
+		return
+	}
+
+	err = rts.users.ChangePassword(r.Context(), userID, data.CurrentPassword, data.Password)
+	if err != nil {
+		workspaceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// workspaceError writes the response for an error of the workspace and
+// user services
+func workspaceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidName):
+		http.Error(w, ErrInvalidWorkspaceName, http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidPassword):
+		http.Error(w, ErrInvalidPassword, http.StatusBadRequest)
+	case errors.Is(err, service.ErrWrongPassword):
+		http.Error(w, ErrWrongPassword, http.StatusForbidden)
+	case errors.Is(err, service.ErrDuplicateWorkspace):
+		http.Error(w, ErrDuplicateWorkspace, http.StatusConflict)
+	case errors.Is(err, service.ErrWorkspaceNotFound):
+		http.Error(w, ErrWorkspaceNotFound, http.StatusNotFound)
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, ErrUserNotFound, http.StatusNotFound)
+	default:
+		http.Error(w, ErrInvalidWorkspace, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,262 @@
+package rtsync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/repository"
+	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_workspacesHandlers(t *testing.T) {
+	mockFileStorage := new(filestorage.MockFileStorage)
+	db := testutils.CreateDB(t)
+	repo := repository.New(db)
+	options := Options{JWTSecret: []byte("secret")}
+	server := New(db, mockFileStorage, options)
+
+	t.Cleanup(func() { server.Close() })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice_password"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	userID, err := repo.AddUser(context.Background(), repository.AddUserParams{
+		Name:     "alice",
+		Password: string(hash),
+	})
+	require.NoError(t, err)
+	// the session used to create the first workspace
+	require.NoError(t, repo.AddWorkspaceMember(context.Background(), repository.AddWorkspaceMemberParams{
+		WorkspaceID: 100,
+		UserID:      userID,
+		Role:        string(middleware.RoleOwner),
+	}))
+
+	userToken := func(workspaceID int64) string {
+		token, err := middleware.CreateToken(middleware.AuthOptions{SecretKey: options.JWTSecret}, middleware.Identity{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        middleware.RoleOwner,
+		})
+		require.NoError(t, err)
+		return token
+	}
+
+	var workspace repository.CreateWorkspaceRow
+
+	t.Run("should create a workspace owned by the user", func(t *testing.T) {
+		var res *httptest.ResponseRecorder
+		res, workspace = testutils.DoRequest[repository.CreateWorkspaceRow](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/workspace",
+			CreateWorkspaceBody{Name: "notes", Password: "strong_password"},
+			testutils.WithToken(userToken(100)),
+		)
+		require.Equal(t, http.StatusCreated, res.Code)
+		assert.Equal(t, "notes", workspace.Name)
+
+		member, err := repo.FetchWorkspaceMember(context.Background(), repository.FetchWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, string(middleware.RoleOwner), member.Role)
+
+		// duplicate
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/workspace",
+			CreateWorkspaceBody{Name: "notes", Password: "strong_password"},
+			testutils.WithToken(userToken(100)),
+		)
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Equal(t, ErrDuplicateWorkspace, body)
+
+		// invalid password
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/workspace",
+			CreateWorkspaceBody{Name: "other", Password: ""},
+			testutils.WithToken(userToken(100)),
+		)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, ErrInvalidPassword, body)
+
+		// a workspace session has no user to own the workspace
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpApi+"/workspace",
+			CreateWorkspaceBody{Name: "other", Password: "strong_password"},
+			testutils.WithAuthHeader(options.JWTSecret, 100),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrNotUser, body)
+	})
+
+	t.Run("should list the workspaces of the user", func(t *testing.T) {
+		res, body := testutils.DoRequest[[]repository.FetchUserWorkspacesRow](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/workspace",
+			nil,
+			testutils.WithToken(userToken(workspace.ID)),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Len(t, body, 1)
+		assert.Equal(t, workspace.ID, body[0].ID)
+		assert.Equal(t, string(middleware.RoleOwner), body[0].Role)
+
+		// a workspace session sees only its workspace
+		res, body = testutils.DoRequest[[]repository.FetchUserWorkspacesRow](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/workspace",
+			nil,
+			testutils.WithRoleAuthHeader(options.JWTSecret, workspace.ID, middleware.RoleViewer),
+		)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Len(t, body, 1)
+		assert.Equal(t, "notes", body[0].Name)
+		assert.Equal(t, string(middleware.RoleViewer), body[0].Role)
+	})
+
+	t.Run("should rename the workspace and change its password", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			PathHttpApi+"/workspace",
+			UpdateWorkspaceBody{Name: "journal"},
+			testutils.WithRoleAuthHeader(options.JWTSecret, workspace.ID, middleware.RoleEditor),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, middleware.ErrInsufficientRole, body)
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			PathHttpApi+"/workspace",
+			UpdateWorkspaceBody{Name: "journal", Password: "new_password"},
+			testutils.WithToken(userToken(workspace.ID)),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		res, _ = testutils.DoRequest[LoginResponse](
+			t,
+			server,
+			http.MethodPost,
+			PathHttpAuth+"/login",
+			WorkspaceCredentials{Name: "journal", Password: "new_password"},
+		)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("should change the user password", func(t *testing.T) {
+		res, body := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			PathHttpApi+"/account",
+			ChangePasswordBody{CurrentPassword: "wrong", Password: "new_password"},
+			testutils.WithToken(userToken(workspace.ID)),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrWrongPassword, body)
+
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			PathHttpApi+"/account",
+			ChangePasswordBody{CurrentPassword: "alice_password", Password: "new_password"},
+			testutils.WithToken(userToken(workspace.ID)),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+
+		// workspace sessions have no account
+		res, body = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodPatch,
+			PathHttpApi+"/account",
+			ChangePasswordBody{CurrentPassword: "alice_password", Password: "new_password"},
+			testutils.WithAuthHeader(options.JWTSecret, workspace.ID),
+		)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Equal(t, ErrNotUser, body)
+	})
+
+	t.Run("should delete the workspace with its files", func(t *testing.T) {
+		file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
+			DiskPath:      "disk/path",
+			WorkspacePath: "note.md",
+			MimeType:      "text/plain",
+			Hash:          "hash",
+			WorkspaceID:   workspace.ID,
+		})
+		require.NoError(t, err)
+
+		mockFileStorage.On("DeleteObject", file.DiskPath).Return(nil)
+
+		res, _ := testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			PathHttpApi+"/workspace",
+			nil,
+			testutils.WithToken(userToken(workspace.ID)),
+		)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		mockFileStorage.AssertExpectations(t)
+
+		_, err = repo.FetchFile(context.Background(), file.ID)
+		assert.Error(t, err)
+		_, err = repo.FetchWorkspace(context.Background(), "journal")
+		assert.Error(t, err)
+
+		members, err := repo.FetchWorkspaceMembers(context.Background(), workspace.ID)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+
+		// the members of a deleted workspace are no longer authenticated
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodDelete,
+			PathHttpApi+"/workspace",
+			nil,
+			testutils.WithToken(userToken(workspace.ID)),
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		// nor are the workspace sessions
+		res, _ = testutils.DoRequest[string](
+			t,
+			server,
+			http.MethodGet,
+			PathHttpApi+"/file",
+			nil,
+			testutils.WithAuthHeader(options.JWTSecret, workspace.ID),
+		)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+}
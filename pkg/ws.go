@@ -5,35 +5,76 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/coder/websocket"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
 )
 
 type MessageType = int
 
 const (
-	ChunkEventType  MessageType = iota
-	CreateEventType MessageType = iota
-	DeleteEventType MessageType = iota
-	RenameEventType MessageType = iota
+	ChunkEventType       MessageType = iota
+	CreateEventType      MessageType = iota
+	DeleteEventType      MessageType = iota
+	RenameEventType      MessageType = iota
+	ErrorEventType       MessageType = iota
+	ImportEventType      MessageType = iota
+	PresenceEventType    MessageType = iota
+	SubscribeEventType   MessageType = iota
+	UnsubscribeEventType MessageType = iota
+	HelloEventType       MessageType = iota
+	SnapshotEventType    MessageType = iota
 )
 
 type WsMessageHeader struct {
-	SenderId string      `json:"-"`
-	FileId   int64       `json:"fileId"`
-	Type     MessageType `json:"type"`
+	SenderId    string          `json:"-"`
+	WorkspaceId int64           `json:"-"`
+	SenderRole  middleware.Role `json:"-"`
+	FileId      int64           `json:"fileId"`
+	Type        MessageType     `json:"type"`
 }
 
 type EventMessage struct {
 	WsMessageHeader
 	WorkspacePath string `json:"workspacePath"`
 	ObjectType    string `json:"objectType"`
+	// Import is set only on ImportEventType
+	Import *ImportSummary `json:"import,omitempty"`
+}
+
+// ImportSummary is broadcast once a bulk import completes, in place of an
+// event per file: clients should fetch the files again
+type ImportSummary struct {
+	Created   int `json:"created"`
+	Skipped   int `json:"skipped"`
+	Conflicts int `json:"conflicts"`
 }
 
 type ChunkMessage struct {
 	WsMessageHeader
 	Chunks []diff.DiffChunk `json:"chunks"`
+
+	// content is the content of the file once the chunks are applied
+	content string
+}
+
+// ErrorMessage is sent back only to the sender of a rejected message
+type ErrorMessage struct {
+	WsMessageHeader
+	Error string `json:"error"`
+	// RetryAfter is set on ErrRateLimited, in milliseconds
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+func (rts *realTimeSyncServer) wsAuthHandler() http.Handler {
+	// browsers can't set the headers of a websocket upgrade
+	ao := rts.authOptions()
+	ao.QueryToken = true
+
+	auth := middleware.IsAuthenticated(ao)
+	return auth(http.HandlerFunc(rts.wsHandler))
 }
 
 func (rts *realTimeSyncServer) wsHandler(w http.ResponseWriter, r *http.Request) {
@@ -52,7 +93,7 @@ func (rts *realTimeSyncServer) wsHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (rts *realTimeSyncServer) subscribe(w http.ResponseWriter, r *http.Request) error {
-	s, err := NewSubscriber(rts.ctx, w, r, rts.onChunkMessage, rts.onEventMessage)
+	s, err := NewSubscriber(rts.ctx, w, r, rts.heartbeat, rts.slowGracePeriod, rts.onChunkMessage, rts.onEventMessage, rts.onPresenceMessage, rts.onSubscriptionMessage)
 	if err != nil {
 		return err
 	}
@@ -65,110 +106,147 @@ func (rts *realTimeSyncServer) subscribe(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-func (rts *realTimeSyncServer) onEventMessage(event EventMessage) {
-	rts.broadcastEventMessage(event)
+func (rts *realTimeSyncServer) onEventMessage(event EventMessage) error {
+	if !event.SenderRole.CanWrite() {
+		return errors.New(middleware.ErrInsufficientRole)
+	}
+
+	rts.broadcastEventMessage(rts.hub.workspace(event.WorkspaceId), event)
+	return nil
+}
+
+func (rts *realTimeSyncServer) onChunkMessage(data ChunkMessage) error {
+	if !data.SenderRole.CanWrite() {
+		return errors.New(middleware.ErrInsufficientRole)
+	}
+
+	ws := rts.hub.workspace(data.WorkspaceId)
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	return rts.applyChunks(ws, data)
 }
 
-func (rts *realTimeSyncServer) onChunkMessage(data ChunkMessage) {
-	rts.mut.Lock()
-	defer rts.mut.Unlock()
+// applyChunks applies the chunks to the file in memory, marks it to be saved
+// and broadcasts them. ws.mut must be held.
+func (rts *realTimeSyncServer) applyChunks(ws *workspaceHub, data ChunkMessage) error {
+	if data.WorkspaceId != ws.id {
+		return errors.New(ErrNotExistingFile)
+	}
+
+	file, err := rts.loadFile(ws, data.FileId)
+	if err != nil {
+		return err
+	}
 
-	file := rts.files[data.FileId]
 	localCopy := file.Content
 	for _, d := range data.Chunks {
 		localCopy = diff.ApplyDiff(localCopy, d)
 	}
-	diffs := diff.ComputeDiff(file.Content, localCopy)
-
-	file.Content = localCopy
-	rts.files[data.FileId] = file
 
-	if len(diffs) > 0 {
-		rts.storageQueue <- data
-		rts.broadcastChunkMessage(ChunkMessage{
-			WsMessageHeader: data.WsMessageHeader,
-			Chunks:          diffs,
-		})
+	if diffs := rts.replaceContent(ws, data.WsMessageHeader, file, localCopy); len(diffs) > 0 {
+		ws.markDirty(data.FileId, time.Now())
 	}
+
+	return nil
 }
 
-// broadcastPublish publishes the msg to all subscribers.
-// It never blocks and so messages to slow subscribers
-// are dropped.
-func (rts *realTimeSyncServer) broadcastChunkMessage(msg ChunkMessage) {
-	rts.subscribersMu.Lock()
-	defer rts.subscribersMu.Unlock()
+// replaceContent replaces the content of the file in memory and broadcasts
+// the chunks turning the previous content into the new one, which it
+// returns. ws.mut must be held.
+func (rts *realTimeSyncServer) replaceContent(
+	ws *workspaceHub,
+	header WsMessageHeader,
+	file FileWithContent,
+	content string,
+) []diff.DiffChunk {
+	diffs := diff.ComputeDiff(file.Content, content)
 
-	err := rts.publishLimiter.Wait(context.Background())
-	if err != nil {
-		log.Print(err)
-	}
+	file.Content = content
+	ws.store(file)
 
-	for s := range rts.subscribers {
-		select {
-		case s.chunkMsgQueue <- msg:
-		default:
-			go s.closeSlow()
-		}
+	if len(diffs) > 0 {
+		rts.transformPresences(ws, file.ID, diffs)
+		rts.broadcastChunkMessage(ws, ChunkMessage{
+			WsMessageHeader: header,
+			Chunks:          diffs,
+			content:         content,
+		}, file.WorkspacePath)
 	}
+
+	return diffs
 }
 
-func (rts *realTimeSyncServer) broadcastEventMessage(msg EventMessage) {
-	rts.subscribersMu.Lock()
-	defer rts.subscribersMu.Unlock()
+// broadcastChunkMessage queues the msg to the subscribers of the workspace
+// receiving the chunks of the file at workspacePath. It never blocks: the
+// chunks for slow subscribers are coalesced, then replaced by a snapshot of
+// the file, and a subscriber behind for longer than the grace period is
+// disconnected.
+func (rts *realTimeSyncServer) broadcastChunkMessage(ws *workspaceHub, msg ChunkMessage, workspacePath string) {
+	ws.subscribersMu.Lock()
+	defer ws.subscribersMu.Unlock()
+
+	now := time.Now()
+	for s := range ws.subscribers {
+		if s.clientId == msg.SenderId {
+			continue
+		}
+		if !ws.subscriptions.receives(s, msg.FileId, workspacePath) {
+			continue
+		}
 
-	err := rts.publishLimiter.Wait(context.Background())
-	if err != nil {
-		log.Print(err)
+		rts.queued(s, s.outbox.push(msg, now, rts.slowGracePeriod))
 	}
+}
 
-	for s := range rts.subscribers {
-		select {
-		case s.eventMsgQueue <- msg:
-		default:
-			go s.closeSlow()
+// broadcastEventMessage queues the msg to the subscribers of the workspace,
+// after the chunks already queued. Like the chunks it never blocks, and it
+// takes the hub so that it can be called holding ws.mut.
+func (rts *realTimeSyncServer) broadcastEventMessage(ws *workspaceHub, msg EventMessage) {
+	ws.subscribersMu.Lock()
+	defer ws.subscribersMu.Unlock()
+
+	now := time.Now()
+	for s := range ws.subscribers {
+		if s.clientId == msg.SenderId {
+			continue
 		}
+
+		rts.queued(s, s.outbox.pushEvent(msg, now, rts.slowGracePeriod))
 	}
 }
 
-func (rts *realTimeSyncServer) internalBusProcessor() {
-	for {
-		select {
-		case chunkMsg := <-rts.storageQueue:
-			for _, d := range chunkMsg.Chunks {
-				file, err := rts.db.FetchFile(context.Background(), chunkMsg.FileId)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-
-				err = rts.storage.PersistChunk(file.DiskPath, d)
-				if err != nil {
-					log.Println(err)
-				}
-
-				err = rts.db.UpdateUpdatedAt(context.Background(), chunkMsg.FileId)
-				if err != nil {
-					log.Println(err)
-				}
-			}
-		case event := <-rts.eventQueue:
-			rts.broadcastEventMessage(event)
-		case <-rts.ctx.Done():
-			return
-		}
+// queued counts how the message was queued for the subscriber, which is
+// disconnected if it has been behind for longer than the grace period
+func (rts *realTimeSyncServer) queued(s *subscriber, result pushResult) {
+	if result.coalesced {
+		rts.metrics.coalescedChunks.Add(1)
+	}
+	rts.metrics.snapshots.Add(int64(result.snapshots))
+	if result.slow {
+		rts.metrics.slowDisconnects.Add(1)
+		log.Printf("client %s behind for more than %v, disconnecting", s.clientId, rts.slowGracePeriod)
+		go s.closeSlow()
 	}
 }
 
 func (rts *realTimeSyncServer) addSubscriber(s *subscriber) {
-	rts.subscribersMu.Lock()
-	rts.subscribers[s] = struct{}{}
-	rts.subscribersMu.Unlock()
+	s.clientLimiter, s.workspaceLimiter = rts.opsLimiter.acquire(s.workspaceID)
+
+	ws := rts.hub.workspace(s.workspaceID)
+	ws.subscribersMu.Lock()
+	ws.subscribers[s] = struct{}{}
+	ws.subscribersMu.Unlock()
 }
 
-// deleteSubscriber deletes the given subscriber.
+// deleteSubscriber deletes the given subscriber and its presence.
 func (rts *realTimeSyncServer) deleteSubscriber(s *subscriber) {
-	rts.subscribersMu.Lock()
-	delete(rts.subscribers, s)
-	rts.subscribersMu.Unlock()
+	ws := rts.hub.workspace(s.workspaceID)
+	ws.subscribersMu.Lock()
+	delete(ws.subscribers, s)
+	ws.subscriptions.remove(s)
+	rts.leavePresence(ws, s)
+	ws.subscribersMu.Unlock()
+
+	rts.opsLimiter.release(s.workspaceID)
 }
@@ -2,6 +2,9 @@ package rtsync
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -13,6 +16,7 @@ import (
 	"github.com/hiimjako/real-time-sync-obsidian-be/internal/testutils"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/diff"
 	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/filestorage"
+	"github.com/hiimjako/real-time-sync-obsidian-be/pkg/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -24,18 +28,19 @@ func Test_wsHandler(t *testing.T) {
 
 	mockFileStorage := new(filestorage.MockFileStorage)
 	repo := repository.New(db)
-	handler := New(repo, mockFileStorage, Options{JWTSecret: []byte("secret")})
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
 	ts := httptest.NewServer(handler)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 
 	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
 	//nolint:bodyclose
-	sender, _, err := websocket.Dial(ctx, url, nil)
+	sender, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleEditor))
 	require.NoError(t, err)
 
 	//nolint:bodyclose
-	reciver, _, err := websocket.Dial(ctx, url, nil)
+	reciver, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleViewer))
 	require.NoError(t, err)
 
 	file, err := repo.CreateFile(context.Background(), repository.CreateFileParams{
@@ -62,7 +67,8 @@ func Test_wsHandler(t *testing.T) {
 		},
 	}
 
-	mockFileStorage.On("PersistChunk", file.DiskPath, msg.Chunks[0]).Return(nil)
+	mockFileStorage.On("ReadObject", file.DiskPath).Return([]byte{}, nil)
+	mockFileStorage.On("WriteObject", file.DiskPath, []byte("Hello!")).Return(nil)
 
 	err = wsjson.Write(ctx, sender, msg)
 	assert.NoError(t, err)
@@ -80,8 +86,8 @@ func Test_wsHandler(t *testing.T) {
 	msg.SenderId = recMsg.SenderId
 	assert.Equal(t, msg, recMsg)
 
-	time.Sleep(10 * time.Millisecond)
-	mockFileStorage.AssertCalled(t, "PersistChunk", file.DiskPath, msg.Chunks[0])
+	handler.hub.pause()()
+	mockFileStorage.AssertCalled(t, "WriteObject", file.DiskPath, []byte("Hello!"))
 
 	t.Cleanup(func() {
 		cancel()
@@ -92,6 +98,188 @@ func Test_wsHandler(t *testing.T) {
 	})
 }
 
+func Test_wsHandlerPermissions(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	mockFileStorage := new(filestorage.MockFileStorage)
+	options := Options{JWTSecret: []byte("secret")}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+
+	t.Run("should refuse unauthenticated clients", func(t *testing.T) {
+		//nolint:bodyclose
+		_, _, err := websocket.Dial(ctx, url, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject chunks of viewers", func(t *testing.T) {
+		//nolint:bodyclose
+		viewer, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleViewer))
+		require.NoError(t, err)
+		defer viewer.Close(websocket.StatusNormalClosure, "")
+
+		msg := ChunkMessage{
+			WsMessageHeader: WsMessageHeader{
+				Type:   ChunkEventType,
+				FileId: 1,
+			},
+			Chunks: []diff.DiffChunk{
+				{
+					Position: 0,
+					Type:     diff.DiffAdd,
+					Text:     "Hello!",
+					Len:      6,
+				},
+			},
+		}
+
+		err = wsjson.Write(ctx, viewer, msg)
+		require.NoError(t, err)
+
+		var errMsg ErrorMessage
+		err = wsjson.Read(ctx, viewer, &errMsg)
+		require.NoError(t, err)
+
+		assert.Equal(t, ErrorMessage{
+			WsMessageHeader: WsMessageHeader{
+				Type:   ErrorEventType,
+				FileId: 1,
+			},
+			Error: middleware.ErrInsufficientRole,
+		}, errMsg)
+
+		mockFileStorage.AssertNotCalled(t, "WriteObject")
+	})
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+}
+
+func Test_wsHeartbeat(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	mockFileStorage := new(filestorage.MockFileStorage)
+	options := Options{
+		JWTSecret:    []byte("secret"),
+		PingInterval: 50 * time.Millisecond,
+		PingTimeout:  50 * time.Millisecond,
+	}
+	handler := New(db, mockFileStorage, options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	subscribers := func() int {
+		ws := handler.hub.workspace(1)
+		ws.subscribersMu.Lock()
+		defer ws.subscribersMu.Unlock()
+		return len(ws.subscribers)
+	}
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+
+	// the pongs are sent while reading
+	//nolint:bodyclose
+	alive, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleEditor))
+	require.NoError(t, err)
+	defer alive.Close(websocket.StatusNormalClosure, "")
+	alive.CloseRead(ctx)
+
+	//nolint:bodyclose
+	dead, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleEditor))
+	require.NoError(t, err)
+	defer dead.CloseNow()
+
+	require.Eventually(t, func() bool { return subscribers() == 2 }, time.Second, 5*time.Millisecond)
+
+	// the subscriber is deleted once all its goroutines exited
+	require.Eventually(t, func() bool { return subscribers() == 1 }, time.Second, 5*time.Millisecond)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, subscribers())
+}
+
+func Test_wsSlowSubscriber(t *testing.T) {
+	db := testutils.CreateDB(t)
+
+	options := Options{JWTSecret: []byte("secret"), SlowGracePeriod: 10 * time.Second}
+	handler := New(db, new(filestorage.MockFileStorage), options)
+	ts := httptest.NewServer(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+		handler.Close()
+	})
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + PathWebSocket
+	//nolint:bodyclose
+	conn, _, err := websocket.Dial(ctx, url, dialOptions(options.JWTSecret, 1, middleware.RoleViewer))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+	conn.SetReadLimit(-1)
+
+	ws := handler.hub.workspace(1)
+	require.Eventually(t, func() bool {
+		ws.subscribersMu.Lock()
+		defer ws.subscribersMu.Unlock()
+		return len(ws.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("should wait for a client within the grace period", func(t *testing.T) {
+		// larger than the socket buffers, the write lasts until it's read
+		random := make([]byte, 16<<20)
+		_, err := rand.Read(random)
+		require.NoError(t, err)
+		content := hex.EncodeToString(random)
+
+		handler.broadcastChunkMessage(ws, ChunkMessage{
+			WsMessageHeader: WsMessageHeader{Type: ChunkEventType, FileId: 1},
+			Chunks:          []diff.DiffChunk{{Type: diff.DiffAdd, Position: 0, Text: content, Len: int64(len(content))}},
+			content:         content,
+		}, "note.md")
+		handler.broadcastEventMessage(ws, EventMessage{
+			WsMessageHeader: WsMessageHeader{Type: CreateEventType, FileId: 2},
+			WorkspacePath:   "other.md",
+			ObjectType:      "file",
+		})
+
+		time.Sleep(2 * time.Second)
+
+		var chunk ChunkMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &chunk))
+		require.Len(t, chunk.Chunks, 1)
+		assert.Equal(t, content, chunk.Chunks[0].Text)
+
+		var event EventMessage
+		require.NoError(t, wsjson.Read(ctx, conn, &event))
+		assert.Equal(t, "other.md", event.WorkspacePath)
+	})
+}
+
+func dialOptions(secret []byte, workspaceID int64, role middleware.Role) *websocket.DialOptions {
+	return &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"Bearer " + testutils.CreateToken(secret, workspaceID, role)},
+		},
+	}
+}
+
 // func Test_internalBusProcessor(t *testing.T) {
 //
 // }
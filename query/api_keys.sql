@@ -0,0 +1,29 @@
+-- name: CreateApiKey :one
+INSERT INTO api_keys (workspace_id, name, key_hash, prefix, scope)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, workspace_id, name, prefix, scope, last_used_at, created_at;
+
+-- name: FetchApiKeyFromHash :one
+SELECT *
+FROM api_keys
+WHERE key_hash = ?
+LIMIT 1;
+
+-- name: FetchApiKeys :many
+SELECT id, workspace_id, name, prefix, scope, last_used_at, created_at
+FROM api_keys
+WHERE workspace_id = ?;
+
+-- name: TouchApiKey :exec
+UPDATE api_keys
+SET 
+    last_used_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: DeleteApiKey :execrows
+DELETE FROM api_keys
+WHERE id = ? AND workspace_id = ?;
+
+-- name: DeleteWorkspaceApiKeys :exec
+DELETE FROM api_keys
+WHERE workspace_id = ?;
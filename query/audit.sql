@@ -0,0 +1,9 @@
+-- name: AddAuditLog :exec
+INSERT INTO audit_log (action, workspace, user, remote_addr)
+VALUES (?, ?, ?, ?);
+
+-- name: FetchAuditLog :many
+SELECT *
+FROM audit_log
+ORDER BY id DESC
+LIMIT ?;
@@ -14,11 +14,6 @@ SELECT *
 FROM files
 WHERE workspace_id = ?;
 
--- name: FetchWorkspaceFiles :many
-SELECT *
-FROM files
-WHERE workspace_id = ?;
-
 -- name: FetchAllFiles :many
 SELECT *
 FROM files;
@@ -27,21 +22,45 @@ FROM files;
 DELETE FROM files
 WHERE id = ?;
 
+-- name: CountFilesByDiskPath :one
+SELECT COUNT(*)
+FROM files
+WHERE disk_path = ?;
+
 -- name: FetchFileFromWorkspacePath :one
 SELECT *
 FROM files
 WHERE workspace_path = ?
 LIMIT 1;
 
--- name: UpdateUpdatedAt :exec
+-- name: UpdateWorkspacePath :exec
 UPDATE files
 SET 
-    updated_at = CURRENT_TIMESTAMP
+    workspace_path = ?
 WHERE id = ?;
 
--- name: UpdateWorkspacePath :exec
+
+-- name: DeleteWorkspaceFiles :exec
+DELETE FROM files
+WHERE workspace_id = ?;
+
+-- name: FetchWorkspaceFile :one
+SELECT *
+FROM files
+WHERE workspace_id = ? AND workspace_path = ?
+LIMIT 1;
+
+-- name: UpdateFileHash :exec
 UPDATE files
 SET 
-    workspace_path = ?
+    hash = ?,
+    updated_at = CURRENT_TIMESTAMP
 WHERE id = ?;
 
+-- name: UpdateDiskPath :exec
+UPDATE files
+SET 
+    disk_path = ?,
+    hash = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
@@ -0,0 +1,19 @@
+-- name: CreateFileLink :exec
+INSERT INTO file_links (source_id, workspace_id, target, target_key, embed)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: DeleteFileLinks :exec
+DELETE FROM file_links
+WHERE source_id = ?;
+
+-- name: FetchFileLinks :many
+SELECT *
+FROM file_links
+WHERE source_id = ?
+ORDER BY id;
+
+-- name: FetchLinksTo :many
+SELECT *
+FROM file_links
+WHERE workspace_id = ? AND (target_key = ? OR target_key = ?)
+ORDER BY source_id, id;
@@ -0,0 +1,38 @@
+-- name: AddWorkspaceMember :exec
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES (?, ?, ?);
+
+-- name: FetchWorkspaceMember :one
+SELECT *
+FROM workspace_members
+WHERE workspace_id = ? AND user_id = ?
+LIMIT 1;
+
+-- name: CountWorkspaceOwners :one
+SELECT COUNT(*)
+FROM workspace_members
+WHERE workspace_id = ? AND role = 'owner';
+
+-- name: FetchWorkspaceMembers :many
+SELECT workspace_members.workspace_id, workspace_members.user_id, workspace_members.role, users.name
+FROM workspace_members
+JOIN users ON users.id = workspace_members.user_id
+WHERE workspace_members.workspace_id = ?;
+
+-- name: UpdateWorkspaceMemberRole :execrows
+UPDATE workspace_members
+SET 
+    role = ?
+WHERE workspace_id = ? AND user_id = ?;
+
+-- name: DeleteWorkspaceMember :execrows
+DELETE FROM workspace_members
+WHERE workspace_id = ? AND user_id = ?;
+
+-- name: DeleteWorkspaceMembers :exec
+DELETE FROM workspace_members
+WHERE workspace_id = ?;
+
+-- name: DeleteUserMemberships :exec
+DELETE FROM workspace_members
+WHERE user_id = ?;
@@ -0,0 +1,27 @@
+-- name: CreateFileProperty :exec
+INSERT INTO file_properties (file_id, workspace_id, key, value, number, list)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: CreateFileTag :exec
+INSERT INTO file_tags (file_id, workspace_id, tag)
+VALUES (?, ?, ?);
+
+-- name: DeleteFileProperties :exec
+DELETE FROM file_properties
+WHERE file_id = ?;
+
+-- name: DeleteFileTags :exec
+DELETE FROM file_tags
+WHERE file_id = ?;
+
+-- name: FetchFilesProperties :many
+SELECT *
+FROM file_properties
+WHERE file_id IN (sqlc.slice(file_ids))
+ORDER BY file_id, id;
+
+-- name: FetchFilesTags :many
+SELECT *
+FROM file_tags
+WHERE file_id IN (sqlc.slice(file_ids))
+ORDER BY file_id, id;
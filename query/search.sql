@@ -0,0 +1,22 @@
+-- name: IndexFile :exec
+INSERT OR REPLACE INTO files_fts (rowid, workspace_id, workspace_path, content)
+VALUES (?, ?, ?, ?);
+
+-- name: SearchFiles :many
+-- ranks the matches with bm25(), a hit in the path counts twice one in
+-- the content. bm25() is lower for better matches, the score is negated so
+-- that it's higher.
+SELECT
+    rowid AS file_id,
+    workspace_path,
+    snippet(files_fts, -1, char(2), char(3), '…', 16) AS snippet,
+    CAST(-bm25(files_fts, 0.0, 2.0, 1.0) AS REAL) AS score
+FROM files_fts
+WHERE files_fts MATCH sqlc.arg(query) AND workspace_id = sqlc.arg(workspace_id)
+ORDER BY score DESC, workspace_path
+LIMIT sqlc.arg(limit);
+
+-- name: FetchUnindexedFiles :many
+SELECT *
+FROM files
+WHERE mime_type LIKE 'text/%' AND id NOT IN (SELECT rowid FROM files_fts);
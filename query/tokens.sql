@@ -0,0 +1,59 @@
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (token_hash, family_id, workspace_id, user_id, role, expires_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: FetchRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = ?
+LIMIT 1;
+
+-- name: UseRefreshToken :execrows
+UPDATE refresh_tokens
+SET 
+    used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET 
+    revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeToken :exec
+INSERT OR IGNORE INTO revoked_tokens (jti, expires_at)
+VALUES (?, ?);
+
+-- name: IsTokenRevoked :one
+SELECT COUNT(*)
+FROM revoked_tokens
+WHERE jti = ?;
+
+-- name: IsSessionRevoked :one
+SELECT COUNT(*)
+FROM refresh_tokens
+WHERE family_id = ? AND revoked_at IS NOT NULL;
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens
+WHERE expires_at < ?;
+
+-- name: RevokeWorkspaceRefreshTokens :exec
+UPDATE refresh_tokens
+SET 
+    revoked_at = CURRENT_TIMESTAMP
+WHERE workspace_id = ? AND user_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET 
+    revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: DeleteWorkspaceRefreshTokens :exec
+DELETE FROM refresh_tokens
+WHERE workspace_id = ?;
+
+-- name: DeleteUserRefreshTokens :exec
+DELETE FROM refresh_tokens
+WHERE user_id = ?;
@@ -0,0 +1,46 @@
+-- name: AddUser :one
+INSERT INTO users (name, password)
+VALUES (?, ?)
+RETURNING id;
+
+-- name: FetchUser :one
+SELECT id, name, password
+FROM users
+WHERE name = ?
+LIMIT 1;
+
+-- name: AddUserIdentity :exec
+INSERT INTO user_identities (issuer, subject, user_id)
+VALUES (?, ?, ?);
+
+-- name: FetchUserIdentity :one
+SELECT user_id
+FROM user_identities
+WHERE issuer = ? AND subject = ?
+LIMIT 1;
+
+-- name: FetchUserByID :one
+SELECT id, name, password
+FROM users
+WHERE id = ?
+LIMIT 1;
+
+-- name: UpdateUserPassword :execrows
+UPDATE users
+SET 
+    password = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: FetchUsers :many
+SELECT id, name, created_at, updated_at
+FROM users
+ORDER BY name;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = ?;
+
+-- name: DeleteUserIdentities :exec
+DELETE FROM user_identities
+WHERE user_id = ?;
@@ -6,4 +6,53 @@ VALUES (?, ?);
 SELECT id, name, password 
 FROM workspaces
 WHERE name = ?
-LIMIT 1
+LIMIT 1;
+
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (name, password)
+VALUES (?, ?)
+RETURNING id, name, created_at, updated_at;
+
+-- name: FetchWorkspaceByID :one
+SELECT id, name, created_at, updated_at
+FROM workspaces
+WHERE id = ?
+LIMIT 1;
+
+-- name: FetchWorkspaces :many
+SELECT id, name, created_at, updated_at
+FROM workspaces
+ORDER BY name;
+
+-- name: FetchUserWorkspaces :many
+SELECT workspaces.id, workspaces.name, workspace_members.role, workspaces.created_at, workspaces.updated_at
+FROM workspaces
+JOIN workspace_members ON workspace_members.workspace_id = workspaces.id
+WHERE workspace_members.user_id = ?
+ORDER BY workspaces.name;
+
+-- name: IsWorkspaceDeleted :one
+-- the ids are AUTOINCREMENT, an id up to the sequence without a row has
+-- been deleted
+SELECT COUNT(*)
+FROM sqlite_sequence
+WHERE sqlite_sequence.name = 'workspaces' AND sqlite_sequence.seq >= sqlc.arg(id)
+AND NOT EXISTS (SELECT 1 FROM workspaces WHERE workspaces.id = sqlc.arg(id));
+
+-- name: UpdateWorkspaceName :execrows
+UPDATE workspaces
+SET 
+    name = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: UpdateWorkspacePassword :execrows
+UPDATE workspaces
+SET 
+    password = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: DeleteWorkspace :execrows
+DELETE FROM workspaces
+WHERE id = ?;